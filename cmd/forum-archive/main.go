@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/archive"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"io"
+	"os"
+	"time"
+)
+
+const usage = `Usage:
+  forum-archive export [-o file] <path_to_config> <forum_slug>
+  forum-archive import [-policy fail|skip|rename] <path_to_config> <archive_file|->
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func openDB(pathToConfig string) (*database.DB, error) {
+	conf, err := config.NewConfig(pathToConfig)
+	if err != nil {
+		return nil, err
+	}
+	db := database.NewDB(conf.DBUser, conf.DBPass, conf.DBName, conf.DBHost, uint16(conf.DBPort))
+	db.SetPoolLimits(conf.DBMaxConnections, time.Duration(conf.DBAcquireTimeoutSeconds)*time.Second)
+	err = db.Start()
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "write the archive to `file` instead of stdout")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	db, err := openDB(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := archive.NewWriter(out)
+	stat := db.ExportForum(flags.Arg(1), func(kind string, data interface{}) error {
+		if writer.Records() == 0 {
+			header := archive.Header{
+				Version:  archive.Version,
+				Forum:    data.(archive.Forum).Slug,
+				Exported: time.Now().Format("2006-01-02T15:04:05.999999999Z07:00"),
+			}
+			err := writer.Write(archive.TypeHeader, header)
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Write(kind, data)
+	})
+	switch stat {
+	case database.OK:
+	case database.EmptyResult:
+		if *output != "" {
+			os.Remove(*output)
+		}
+		return fmt.Errorf("forum %s not found", flags.Arg(1))
+	default:
+		writer.Write(archive.TypeError, archive.Error{Message: "Export aborted"})
+		writer.Flush()
+		return fmt.Errorf("export of forum %s failed", flags.Arg(1))
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d records\n", writer.Records())
+	return nil
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	policy := flags.String("policy", archive.PolicyFail, "on slug and nickname collisions: fail, skip or rename")
+	flags.Parse(args)
+	if flags.NArg() != 2 || !archive.IsPolicy(*policy) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var in io.Reader = os.Stdin
+	if flags.Arg(1) != "-" {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	db, err := openDB(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, stat := db.ImportForum(archive.NewReader(in), *policy)
+	if stat != database.OK {
+		if report.Message == "" {
+			report.Message = "database error"
+		}
+		return fmt.Errorf("import failed: %s", report.Message)
+	}
+	return printReport(report)
+}
+
+func printReport(report models.ImportReport) error {
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/stats"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const usage = `Usage:
+  forum-bench [flags]
+
+Sets up users, forums and threads named after the seed, then runs the
+operation mix against -target and reports throughput and latency per
+operation. The same seed replays the same sequence of choices.
+
+Operations: ` + operationNames + `
+
+Flags:
+`
+
+const defaultMix = "post=30,vote=10,thread=2,posts_flat=10,posts_tree=10,posts_parent_tree=10," +
+	"thread_details=8,forum_threads=8,forum_users=5,post_details=5,status=2"
+
+func main() {
+	conf := benchConfig{}
+	flag.StringVar(&conf.target, "target", "http://localhost:5000", "base `url` of the server")
+	flag.Int64Var(&conf.seed, "seed", 1, "random seed; names of created objects include it")
+	flag.IntVar(&conf.workers, "c", 8, "concurrent workers")
+	flag.IntVar(&conf.requests, "n", 10000, "operations to run, split between workers")
+	flag.DurationVar(&conf.duration, "d", 0, "run for this long instead of -n operations")
+	flag.StringVar(&conf.mix, "mix", defaultMix, "operation `weights` as name=weight,...")
+	flag.IntVar(&conf.users, "users", 50, "users to create")
+	flag.IntVar(&conf.forums, "forums", 5, "forums to create")
+	flag.IntVar(&conf.threads, "threads", 50, "threads to create before the run")
+	flag.IntVar(&conf.batch, "batch", 5, "maximum posts per create request")
+	flag.Float64Var(&conf.deep, "deep", 0.7, "probability that a new post replies to the latest post of its thread")
+	flag.IntVar(&conf.pageSize, "limit", 20, "page size of list requests")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	mix, err := parseMix(conf.mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if conf.workers < 1 || conf.users < 1 || conf.forums < 1 || conf.threads < 1 || conf.batch < 1 {
+		fmt.Fprintln(os.Stderr, "-c, -users, -forums, -threads and -batch must be positive")
+		os.Exit(2)
+	}
+	conf.target = strings.TrimRight(conf.target, "/")
+
+	bench := newBench(conf, mix)
+	fmt.Fprintf(os.Stderr, "Setting up %d users, %d forums, %d threads\n", conf.users, conf.forums, conf.threads)
+	err = bench.setup()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "setup failed: "+err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Running with %d workers\n", conf.workers)
+	elapsed := bench.run()
+	bench.report(elapsed)
+}
+
+type benchConfig struct {
+	target   string
+	seed     int64
+	workers  int
+	requests int
+	duration time.Duration
+	mix      string
+	users    int
+	forums   int
+	threads  int
+	batch    int
+	deep     float64
+	pageSize int
+}
+
+type weightedOp struct {
+	name   string
+	weight int
+}
+
+func parseMix(mix string) ([]weightedOp, error) {
+	ops := make([]weightedOp, 0)
+	total := 0
+	for _, item := range strings.Split(mix, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad mix item %q, want name=weight", item)
+		}
+		if _, ok := operations[parts[0]]; !ok {
+			return nil, fmt.Errorf("unknown operation %q", parts[0])
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("bad weight in %q", item)
+		}
+		total += weight
+		ops = append(ops, weightedOp{name: parts[0], weight: weight})
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("the mix has no operations")
+	}
+	return ops, nil
+}
+
+func pick(rng *rand.Rand, mix []weightedOp) string {
+	total := 0
+	for _, op := range mix {
+		total += op.weight
+	}
+	n := rng.Intn(total)
+	for _, op := range mix {
+		if n < op.weight {
+			return op.name
+		}
+		n -= op.weight
+	}
+	return mix[len(mix)-1].name
+}
+
+type opStats struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    int
+}
+
+func (b *bench) run() time.Duration {
+	wg := sync.WaitGroup{}
+	started := time.Now()
+	deadline := time.Time{}
+	if b.conf.duration > 0 {
+		deadline = started.Add(b.conf.duration)
+	}
+	for i := 0; i < b.conf.workers; i++ {
+		count := b.conf.requests / b.conf.workers
+		if i < b.conf.requests%b.conf.workers {
+			count++
+		}
+		wg.Add(1)
+		go func(worker int, count int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(b.conf.seed*1000003 + int64(worker)))
+			for n := 0; ; n++ {
+				if deadline.IsZero() && n >= count {
+					return
+				}
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					return
+				}
+				name := pick(rng, b.mix)
+				status, latency, err := operations[name](b, rng)
+				b.record(name, status, latency, err)
+			}
+		}(i, count)
+	}
+	wg.Wait()
+	return time.Since(started)
+}
+
+func (b *bench) record(name string, status int, latency time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	op, ok := b.stats[name]
+	if !ok {
+		op = &opStats{statuses: make(map[int]int)}
+		b.stats[name] = op
+	}
+	if err != nil {
+		op.errors++
+		return
+	}
+	op.latencies = append(op.latencies, latency)
+	op.statuses[status]++
+}
+
+func (b *bench) report(elapsed time.Duration) {
+	names := make([]string, 0, len(b.stats))
+	total := 0
+	all := make([]time.Duration, 0)
+	for name, op := range b.stats {
+		names = append(names, name)
+		total += len(op.latencies) + op.errors
+		all = append(all, op.latencies...)
+	}
+	sort.Strings(names)
+	fmt.Printf("%-18s %8s %9s %9s %9s %9s %9s  %s\n", "operation", "count", "rps", "p50", "p95", "p99", "max", "statuses")
+	for _, name := range names {
+		op := b.stats[name]
+		summary := stats.Summarize(op.latencies)
+		fmt.Printf("%-18s %8d %9.1f %9s %9s %9s %9s  %s\n", name, summary.Count,
+			float64(summary.Count)/elapsed.Seconds(), ms(summary.P50), ms(summary.P95), ms(summary.P99),
+			ms(summary.Max), statusLine(op))
+	}
+	summary := stats.Summarize(all)
+	fmt.Printf("%-18s %8d %9.1f %9s %9s %9s %9s\n", "total", total, float64(total)/elapsed.Seconds(),
+		ms(summary.P50), ms(summary.P95), ms(summary.P99), ms(summary.Max))
+	fmt.Printf("\nelapsed %s, seed %d\n", elapsed.Round(time.Millisecond), b.conf.seed)
+}
+
+func statusLine(op *opStats) string {
+	codes := make([]int, 0, len(op.statuses))
+	for code := range op.statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, 0, len(codes)+1)
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%d:%d", code, op.statuses[code]))
+	}
+	if op.errors > 0 {
+		parts = append(parts, fmt.Sprintf("errors:%d", op.errors))
+	}
+	return strings.Join(parts, " ")
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const operationNames = "post, vote, thread, posts_flat, posts_tree, posts_parent_tree, thread_details, " +
+	"forum_threads, forum_users, post_details, status"
+
+type operation func(b *bench, rng *rand.Rand) (int, time.Duration, error)
+
+var operations = map[string]operation{
+	"post":              createPosts,
+	"vote":              vote,
+	"thread":            createThread,
+	"posts_flat":        threadPosts("flat"),
+	"posts_tree":        threadPosts("tree"),
+	"posts_parent_tree": threadPosts("parent_tree"),
+	"thread_details":    threadDetails,
+	"forum_threads":     forumThreads,
+	"forum_users":       forumUsers,
+	"post_details":      postDetails,
+	"status":            status,
+}
+
+type benchUser struct {
+	nickname string
+	token    string
+}
+
+type benchThread struct {
+	id    int32
+	forum string
+	posts []int64
+}
+
+type bench struct {
+	conf  benchConfig
+	mix   []weightedOp
+	users []benchUser
+	forum []string
+
+	mu      sync.Mutex
+	threads []*benchThread
+	stats   map[string]*opStats
+	created int
+}
+
+func newBench(conf benchConfig, mix []weightedOp) *bench {
+	return &bench{
+		conf:  conf,
+		mix:   mix,
+		stats: make(map[string]*opStats),
+	}
+}
+
+func (b *bench) name(kind string, n int) string {
+	return fmt.Sprintf("bench_%d_%s_%d", b.conf.seed, kind, n)
+}
+
+func (b *bench) setup() error {
+	rng := rand.New(rand.NewSource(b.conf.seed))
+	password := b.name("password", 0)
+	for i := 0; i < b.conf.users; i++ {
+		nick := b.name("user", i)
+		user := models.User{
+			About:    "Created by forum-bench",
+			Email:    nick + "@bench.example",
+			Fullname: fmt.Sprintf("Bench User %d", i),
+			Password: password,
+		}
+		status, _, err := b.call(http.MethodPost, "/user/"+nick+"/create", "", user, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusCreated && status != http.StatusConflict {
+			return fmt.Errorf("creating user %s: status %d", nick, status)
+		}
+		token := models.Token{}
+		credentials := models.Credentials{Nickname: nick, Password: password}
+		status, _, err = b.call(http.MethodPost, "/user/login", "", credentials, &token)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK && status != http.StatusCreated {
+			// users left from a run against a server without passwords can still post anonymously
+			token.Token = ""
+		}
+		b.users = append(b.users, benchUser{nickname: nick, token: token.Token})
+	}
+	for i := 0; i < b.conf.forums; i++ {
+		slug := b.name("forum", i)
+		owner := b.users[i%len(b.users)]
+		forum := models.Forum{Slug: slug, Title: fmt.Sprintf("Bench forum %d", i), User: owner.nickname}
+		status, _, err := b.call(http.MethodPost, "/forum/create", owner.token, forum, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusCreated && status != http.StatusConflict {
+			return fmt.Errorf("creating forum %s: status %d", slug, status)
+		}
+		b.forum = append(b.forum, slug)
+	}
+	for i := 0; i < b.conf.threads; i++ {
+		status, _, err := b.newThread(rng, b.name("thread", i))
+		if err != nil {
+			return err
+		}
+		if status != http.StatusCreated && status != http.StatusConflict {
+			return fmt.Errorf("creating thread %d: status %d", i, status)
+		}
+	}
+	if len(b.threads) == 0 {
+		return fmt.Errorf("no threads available")
+	}
+	return nil
+}
+
+func (b *bench) newThread(rng *rand.Rand, slug string) (int, time.Duration, error) {
+	author := b.user(rng)
+	forum := b.forum[rng.Intn(len(b.forum))]
+	thread := models.Thread{
+		Author:  author.nickname,
+		Message: sentence(rng, 20),
+		Slug:    slug,
+		Title:   sentence(rng, 5),
+	}
+	created := models.Thread{}
+	status, latency, err := b.call(http.MethodPost, "/forum/"+forum+"/create", author.token, thread, &created)
+	if err == nil && (status == http.StatusCreated || status == http.StatusConflict) && created.ID != 0 {
+		b.mu.Lock()
+		b.threads = append(b.threads, &benchThread{id: created.ID, forum: created.Forum})
+		b.mu.Unlock()
+	}
+	return status, latency, err
+}
+
+func (b *bench) user(rng *rand.Rand) benchUser {
+	return b.users[rng.Intn(len(b.users))]
+}
+
+func (b *bench) thread(rng *rand.Rand) *benchThread {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threads[rng.Intn(len(b.threads))]
+}
+
+// parent chains most posts onto the newest one so the trees grow deep rather than wide.
+func (b *bench) parent(rng *rand.Rand, thread *benchThread) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(thread.posts) == 0 || rng.Intn(10) == 0 {
+		return 0
+	}
+	if rng.Float64() < b.conf.deep {
+		return thread.posts[len(thread.posts)-1]
+	}
+	return thread.posts[rng.Intn(len(thread.posts))]
+}
+
+func (b *bench) knownPost(rng *rand.Rand, thread *benchThread) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(thread.posts) == 0 {
+		return 0
+	}
+	return thread.posts[rng.Intn(len(thread.posts))]
+}
+
+func createPosts(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	thread := b.thread(rng)
+	author := b.user(rng)
+	parent := b.parent(rng, thread)
+	posts := make(models.Posts, 1+rng.Intn(b.conf.batch))
+	for i := range posts {
+		posts[i] = &models.Post{Author: author.nickname, Message: sentence(rng, 12), Parent: parent}
+	}
+	created := models.Posts{}
+	status, latency, err := b.call(http.MethodPost, "/thread/"+strconv.Itoa(int(thread.id))+"/create",
+		author.token, posts, &created)
+	if err == nil && status == http.StatusCreated {
+		b.mu.Lock()
+		for _, post := range created {
+			if post.ID != 0 {
+				thread.posts = append(thread.posts, post.ID)
+			}
+		}
+		b.mu.Unlock()
+	}
+	return status, latency, err
+}
+
+func vote(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	thread := b.thread(rng)
+	voter := b.user(rng)
+	voice := int32(1)
+	if rng.Intn(3) == 0 {
+		voice = -1
+	}
+	return b.call(http.MethodPost, "/thread/"+strconv.Itoa(int(thread.id))+"/vote", voter.token,
+		models.Vote{Nickname: voter.nickname, Voice: voice}, nil)
+}
+
+func createThread(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	b.mu.Lock()
+	b.created++
+	slug := b.name("run_thread", b.created)
+	b.mu.Unlock()
+	return b.newThread(rng, slug)
+}
+
+func threadPosts(sort string) operation {
+	return func(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+		thread := b.thread(rng)
+		path := fmt.Sprintf("/thread/%d/posts?sort=%s&limit=%d&desc=%t", thread.id, sort, b.conf.pageSize,
+			rng.Intn(2) == 0)
+		if rng.Intn(2) == 0 {
+			if since := b.knownPost(rng, thread); since != 0 {
+				path += "&since=" + strconv.FormatInt(since, 10)
+			}
+		}
+		return b.call(http.MethodGet, path, "", nil, nil)
+	}
+}
+
+func threadDetails(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	thread := b.thread(rng)
+	return b.call(http.MethodGet, fmt.Sprintf("/thread/%d/details", thread.id), "", nil, nil)
+}
+
+func forumThreads(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	forum := b.forum[rng.Intn(len(b.forum))]
+	return b.call(http.MethodGet, fmt.Sprintf("/forum/%s/threads?limit=%d&desc=%t", forum, b.conf.pageSize,
+		rng.Intn(2) == 0), "", nil, nil)
+}
+
+func forumUsers(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	forum := b.forum[rng.Intn(len(b.forum))]
+	return b.call(http.MethodGet, fmt.Sprintf("/forum/%s/users?limit=%d&desc=%t", forum, b.conf.pageSize,
+		rng.Intn(2) == 0), "", nil, nil)
+}
+
+func postDetails(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	thread := b.thread(rng)
+	id := b.knownPost(rng, thread)
+	if id == 0 {
+		return threadDetails(b, rng)
+	}
+	return b.call(http.MethodGet, fmt.Sprintf("/post/%d/details?related=user,thread,forum", id), "", nil, nil)
+}
+
+func status(b *bench, rng *rand.Rand) (int, time.Duration, error) {
+	return b.call(http.MethodGet, "/service/status", "", nil, nil)
+}
+
+// call sends one request and measures it until the body is read; out is filled on 2xx and 409 answers.
+func (b *bench) call(method, path, token string, in interface{}, out interface{}) (int, time.Duration, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, b.conf.target+"/api"+path, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	started := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	latency := time.Since(started)
+	if err != nil {
+		return 0, 0, err
+	}
+	if out != nil && (resp.StatusCode < 300 || resp.StatusCode == http.StatusConflict) {
+		_ = json.Unmarshal(data, out)
+	}
+	return resp.StatusCode, latency, nil
+}
+
+var words = []string{
+	"forum", "thread", "reply", "post", "vote", "tree", "branch", "*bold*", "`code`", "query", "index",
+	"latency", "cache", "sort", "page", "limit", "since", "author", "message", "seed", "bench", "load",
+}
+
+func sentence(rng *rand.Rand, n int) string {
+	buf := bytes.Buffer{}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(words[rng.Intn(len(words))])
+	}
+	return buf.String()
+}
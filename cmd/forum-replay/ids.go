@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	kindThread     = "thread"
+	kindPost       = "post"
+	kindPending    = "pending"
+	kindAttachment = "attachment"
+	kindFilter     = "filter"
+	kindToken      = "token"
+)
+
+// segmentKinds names the kind of id that follows a path segment, as in
+// /thread/{id}/details or /forum/{slug}/queue/{id}/approve.
+var segmentKinds = map[string]string{
+	"thread":      kindThread,
+	"post":        kindPost,
+	"attachments": kindAttachment,
+	"filters":     kindFilter,
+	"tokens":      kindToken,
+	"queue":       kindPending,
+}
+
+// idMap follows the ids the server gave to what the recording created to
+// those it gives in the replay, by kind, so that later requests naming a
+// created thread, post or upload name the one the replay created.
+type idMap map[string]map[int64]int64
+
+// learn pairs the ids of what a create request made in the recorded and the
+// replayed response.
+func (ids idMap) learn(method string, path string, recorded string, replayed string) {
+	kind := createdKind(method, path)
+	if kind == "" {
+		return
+	}
+	recordedItems, ok := jsonItems(recorded)
+	if !ok {
+		return
+	}
+	replayedItems, ok := jsonItems(replayed)
+	if !ok || len(replayedItems) != len(recordedItems) {
+		return
+	}
+	for i, item := range recordedItems {
+		from, ok := jsonId(item["id"])
+		if !ok {
+			continue
+		}
+		to, ok := jsonId(replayedItems[i]["id"])
+		if !ok {
+			continue
+		}
+		itemKind := kind
+		if pending, _ := item["pending"].(bool); kind == kindPost && pending {
+			itemKind = kindPending
+		}
+		if ids[itemKind] == nil {
+			ids[itemKind] = make(map[int64]int64)
+		}
+		ids[itemKind][from] = to
+	}
+}
+
+// createdKind tells what kind of ids a request creates, if any.
+func createdKind(method string, path string) string {
+	if method != http.MethodPost {
+		return ""
+	}
+	segments := pathSegments(path)
+	n := len(segments)
+	switch {
+	case n >= 3 && segments[n-3] == "forum" && segments[n-1] == "create":
+		return kindThread
+	case n >= 3 && segments[n-3] == "thread" && segments[n-1] == "create":
+		return kindPost
+	case n >= 1 && segments[n-1] == "attachments":
+		return kindAttachment
+	case n >= 3 && segments[n-3] == "forum" && segments[n-1] == "filters":
+		return kindFilter
+	case n >= 3 && segments[n-3] == "user" && segments[n-1] == "tokens":
+		return kindToken
+	}
+	return ""
+}
+
+// path rewrites the recorded ids in the segments and the since parameter of
+// a request path.
+func (ids idMap) path(path string) string {
+	query := ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if kind, ok := segmentKinds[segments[i-1]]; ok {
+			segments[i] = ids.rewrite(kind, segments[i])
+		}
+	}
+	path = strings.Join(segments, "/")
+	if query == "" {
+		return path
+	}
+	values, err := url.ParseQuery(query)
+	if err == nil && strings.HasSuffix(path, "/posts") && values.Get("since") != "" {
+		since := ids.rewrite(kindPost, values.Get("since"))
+		if since != values.Get("since") {
+			values.Set("since", since)
+			query = values.Encode()
+		}
+	}
+	return path + "?" + query
+}
+
+// body rewrites the parents and attachments of new posts.
+func (ids idMap) body(method string, path string, body string) string {
+	if createdKind(method, path) != kindPost {
+		return body
+	}
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	posts := make([]map[string]interface{}, 0)
+	if decoder.Decode(&posts) != nil {
+		return body
+	}
+	for _, post := range posts {
+		ids.rewriteField(post, "parent", kindPost)
+		attachments, _ := post["attachments"].([]interface{})
+		for _, attachment := range attachments {
+			if attachment, ok := attachment.(map[string]interface{}); ok {
+				ids.rewriteField(attachment, "id", kindAttachment)
+			}
+		}
+	}
+	rewritten, err := json.Marshal(posts)
+	if err != nil {
+		return body
+	}
+	return string(rewritten)
+}
+
+func (ids idMap) rewriteField(object map[string]interface{}, key string, kind string) {
+	id, ok := jsonId(object[key])
+	if !ok {
+		return
+	}
+	if to, ok := ids[kind][id]; ok {
+		object[key] = json.Number(strconv.FormatInt(to, 10))
+	}
+}
+
+func (ids idMap) rewrite(kind string, segment string) string {
+	id, err := strconv.ParseInt(segment, 10, 64)
+	if err != nil {
+		return segment
+	}
+	if to, ok := ids[kind][id]; ok {
+		return strconv.FormatInt(to, 10)
+	}
+	return segment
+}
+
+func pathSegments(path string) []string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// jsonItems reads a JSON object, or an array of them, as a list.
+func jsonItems(body string) ([]map[string]interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil {
+		return nil, false
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, true
+	case []interface{}:
+		items := make([]map[string]interface{}, 0, len(value))
+		for _, item := range value {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			items = append(items, object)
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func jsonId(value interface{}) (int64, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	id, err := number.Int64()
+	return id, err == nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/stats"
+	"github.com/sergeychur/technopark_db/internal/traffic"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `Usage:
+  forum-replay [flags] <recording.jsonl|->
+
+Replays recorded exchanges in order against -target and compares the status
+and the JSON body of every response with the recorded one. Recordings hold
+no passwords or tokens, so requests that need them replay with -token or fail.
+
+Ids the server gives to new threads, posts, uploads, filter rules and tokens
+are followed from the recorded responses to the replayed ones, and later
+paths and new posts naming them are rewritten. Everything else, such as the
+users and forums the recording did not create, has to be in the database as
+it was when recording began.
+
+Flags:
+`
+
+// headers the client sets itself
+var skippedHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:5000", "base `url` of the server to replay against")
+	ignore := flag.String("ignore", "id,created", "comma-separated JSON `keys` not compared, at any depth")
+	token := flag.String("token", "", "bearer `token` sent with every request")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	maxDiffs := flag.Int("diffs", 5, "differences shown per exchange")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var in io.Reader = os.Stdin
+	if flag.Arg(0) != "-" {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+		in = file
+	}
+	ignored := make(map[string]bool)
+	for _, key := range strings.Split(*ignore, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			ignored[key] = true
+		}
+	}
+	replayer := &replayer{
+		client:   &http.Client{Timeout: *timeout},
+		target:   strings.TrimRight(*target, "/"),
+		token:    *token,
+		ignore:   ignored,
+		maxDiffs: *maxDiffs,
+		ids:      make(idMap),
+	}
+	err := replayer.run(traffic.NewReader(in))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	replayer.report()
+	if replayer.mismatched > 0 || replayer.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+type replayer struct {
+	client   *http.Client
+	target   string
+	token    string
+	ignore   map[string]bool
+	maxDiffs int
+	ids      idMap
+
+	total      int
+	matched    int
+	mismatched int
+	skipped    int
+	failed     int
+	recorded   []time.Duration
+	replayed   []time.Duration
+}
+
+func (rp *replayer) run(reader *traffic.Reader) error {
+	for {
+		exchange, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rp.total++
+		rp.replay(exchange)
+	}
+}
+
+func (rp *replayer) replay(exchange traffic.Exchange) {
+	name := fmt.Sprintf("#%d %s %s", rp.total, exchange.Request.Method, exchange.Request.Path)
+	if exchange.Request.Truncated {
+		rp.skipped++
+		fmt.Printf("%s: skipped, request body was not recorded in full\n", name)
+		return
+	}
+	method, path := exchange.Request.Method, exchange.Request.Path
+	request, err := http.NewRequest(method, rp.target+rp.ids.path(path),
+		bytes.NewReader([]byte(rp.ids.body(method, path, exchange.Request.Body))))
+	if err != nil {
+		rp.failed++
+		fmt.Printf("%s: %s\n", name, err.Error())
+		return
+	}
+	for header, value := range exchange.Request.Headers {
+		if !skippedHeaders[header] {
+			request.Header.Set(header, value)
+		}
+	}
+	if rp.token != "" {
+		request.Header.Set("Authorization", "Bearer "+rp.token)
+	}
+	started := time.Now()
+	response, err := rp.client.Do(request)
+	if err != nil {
+		rp.failed++
+		fmt.Printf("%s: %s\n", name, err.Error())
+		return
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	elapsed := time.Since(started)
+	if err != nil {
+		rp.failed++
+		fmt.Printf("%s: %s\n", name, err.Error())
+		return
+	}
+	rp.replayed = append(rp.replayed, elapsed)
+	rp.recorded = append(rp.recorded, time.Duration(exchange.Duration*float64(time.Millisecond)))
+
+	if response.StatusCode == exchange.Response.Status && !exchange.Response.Truncated {
+		rp.ids.learn(method, path, exchange.Response.Body, string(body))
+	}
+
+	diffs := make([]string, 0)
+	if response.StatusCode != exchange.Response.Status {
+		diffs = append(diffs, fmt.Sprintf("status %d, want %d", response.StatusCode, exchange.Response.Status))
+	}
+	if !exchange.Response.Truncated {
+		diffs = append(diffs, traffic.Diff(exchange.Response.Body, string(body), rp.ignore)...)
+	}
+	if len(diffs) == 0 {
+		rp.matched++
+		return
+	}
+	rp.mismatched++
+	fmt.Printf("%s:\n", name)
+	for i, diff := range diffs {
+		if i == rp.maxDiffs {
+			fmt.Printf("    ... %d more\n", len(diffs)-i)
+			break
+		}
+		fmt.Printf("    %s\n", diff)
+	}
+}
+
+func (rp *replayer) report() {
+	fmt.Printf("\n%d exchanges: %d matched, %d differ, %d skipped, %d failed\n",
+		rp.total, rp.matched, rp.mismatched, rp.skipped, rp.failed)
+	fmt.Printf("recorded latency: %s\n", stats.Summarize(rp.recorded))
+	fmt.Printf("replayed latency: %s\n", stats.Summarize(rp.replayed))
+}
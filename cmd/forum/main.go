@@ -1,20 +1,102 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/auth"
+	"github.com/sergeychur/technopark_db/internal/database"
 	"github.com/sergeychur/technopark_db/internal/server"
 	"os"
+	"strings"
+	"time"
 )
 
+type options struct {
+	printConfig      *bool
+	setAdminPassword *string
+}
+
+func newFlags() (*flag.FlagSet, options) {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	opts := options{
+		printConfig: flags.Bool("print-config", false, "print the effective config with secrets redacted and exit"),
+		setAdminPassword: flags.String("set-admin-password", "",
+			"read a password from stdin, set it for the admin `nickname` and exit"),
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [path_to_config]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	return flags, opts
+}
+
 func main() {
-	pathToConfig := ""
-	if len(os.Args) != 2 {
-		panic("Usage: ./main <path_to_config>")
-	} else {
-		pathToConfig = os.Args[1]
+	flags, opts := newFlags()
+	conf, err := config.Load(flags, os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if *opts.printConfig && conf != nil {
+		conf.WriteRedacted(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if *opts.printConfig {
+		return
+	}
+	if *opts.setAdminPassword != "" {
+		err = setAdminPassword(conf, *opts.setAdminPassword)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
 	}
-	serv, err := server.NewServer(pathToConfig)
+	serv, err := server.NewServer(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	// a reload reads the same file, environment and flags again
+	serv.SetConfigLoader(func() (*config.Config, error) {
+		flags, _ := newFlags()
+		return config.Load(flags, os.Args[1:])
+	})
 	err = serv.Run()
 	if err != nil {
-		panic(err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// setAdminPassword sets up the account of an admin listed in the config. The
+// account is kept apart from the users, so a clear does not remove it.
+func setAdminPassword(conf *config.Config, nick string) error {
+	if !conf.HasAdmin(nick) {
+		return fmt.Errorf("%s is not listed in admins", nick)
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return errors.New("no password on stdin")
+	}
+	passwordHash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		return err
+	}
+	db := database.NewDB(conf.DBUser, conf.DBPass, conf.DBName, conf.DBHost, uint16(conf.DBPort))
+	db.SetPoolLimits(conf.DBMaxConnections, time.Duration(conf.DBAcquireTimeoutSeconds)*time.Second)
+	err = db.Start()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if db.SetAdminCredentials(nick, passwordHash) != database.OK {
+		return errors.New("cannot store the admin password")
 	}
+	return nil
 }
@@ -1,32 +1,296 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+// Config is built in layers by Load: defaults, then the file, then FORUM_*
+// environment variables, then flags. Fields tagged secret are redacted when
+// the config is printed; fields tagged reload:"restart" keep their value on
+// a reload until the process restarts.
 type Config struct {
-	Port   string `json:"port"`
-	DBHost string `json:"dbhost"`
-	DBPort string `json:"dbport"`
-	DBUser string `json:"dbuser"`
-	DBPass string `json:"dbpassword"`
-	DBName string `json:"dbname"`
+	Port   int    `json:"port" reload:"restart"`
+	DBHost string `json:"dbhost" reload:"restart"`
+	DBPort int    `json:"dbport" reload:"restart"`
+	DBUser string `json:"dbuser" reload:"restart"`
+	DBPass string `json:"dbpassword" secret:"true" reload:"restart"`
+	DBName string `json:"dbname" reload:"restart"`
+
+	// DBMaxConnections caps the pool; a storage call waits for a free
+	// connection at most DBAcquireTimeoutSeconds.
+	DBMaxConnections        int `json:"db_max_connections" reload:"restart"`
+	DBAcquireTimeoutSeconds int `json:"db_acquire_timeout_seconds" reload:"restart"`
+
+	// AuthRequired makes writes act for the bearer of a token only. Turning
+	// it off is a compatibility mode for clients of the anonymous API, in
+	// which a caller without a token may write as any author.
+	AuthRequired bool `json:"auth_required"`
+
+	// Admins name the site admins. An admin account is not registered like
+	// users are: its password is set with forum -set-admin-password.
+	Admins      []string    `json:"admins"`
+	RateLimits  RateLimits  `json:"rate_limits"`
+	Filter      Filter      `json:"filter"`
+	Attachments Attachments `json:"attachments"`
+	Recorder    Recorder    `json:"recorder"`
+	Log         Log         `json:"log"`
+	Tracing     Tracing     `json:"tracing" reload:"restart"`
+	Shutdown    Shutdown    `json:"shutdown"`
+	TLS         TLS         `json:"tls" reload:"restart"`
+	GRPC        GRPC        `json:"grpc" reload:"restart"`
+	GraphQL     GraphQL     `json:"graphql"`
+	Responses   Responses   `json:"responses"`
+	Idempotency Idempotency `json:"idempotency"`
+}
+
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// RateLimits configure the token buckets of each route class. Buckets are
+// kept in process memory, or in Postgres with store "postgres" so that all
+// instances share them.
+type RateLimits struct {
+	Store          string    `json:"store" reload:"restart"`
+	TrustForwarded bool      `json:"trust_forwarded"`
+	Writes         RateLimit `json:"writes"`
+	Votes          RateLimit `json:"votes"`
+	Reads          RateLimit `json:"reads"`
+}
+
+// Filter holds the site-wide banned words, rejected in every forum, and the
+// size and lifetime of the per-forum rule cache.
+type Filter struct {
+	Words        []string `json:"words"`
+	CacheSize    int      `json:"cache_size"`
+	CacheSeconds int      `json:"cache_seconds"`
+}
+
+// Attachments configure uploads. Types lists the allowed MIME types, detected
+// from the content; "image/*" allows a whole family. Uploads not referenced by
+// a post within OrphanSeconds are removed.
+type Attachments struct {
+	Store          string   `json:"store" reload:"restart"`
+	Dir            string   `json:"dir" reload:"restart"`
+	MaxSize        int64    `json:"max_size"`
+	Types          []string `json:"types"`
+	OrphanSeconds  int      `json:"orphan_seconds"`
+	CleanupSeconds int      `json:"cleanup_seconds" reload:"restart"`
+}
+
+// Recorder appends API exchanges to Path as JSONL for forum-replay. An empty
+// path turns recording off. Bodies are cut at MaxBody bytes.
+type Recorder struct {
+	Path    string `json:"path" reload:"restart"`
+	MaxBody int    `json:"max_body"`
+}
+
+// Log sets the lowest level written: debug, info, warn or error.
+type Log struct {
+	Level string `json:"level"`
+}
+
+// Tracing picks where finished spans go, as lines of OTLP/JSON: "stdout",
+// "file" (appended to Path) or "none". Service names this process in the
+// spans.
+type Tracing struct {
+	Exporter string `json:"exporter"`
+	Path     string `json:"path"`
+	Service  string `json:"service"`
+}
+
+// Shutdown bounds how long in-flight requests may run after SIGTERM or
+// SIGINT before their connections are closed. For DrainSeconds before that
+// the server keeps serving while /readyz answers 503, so load balancers stop
+// sending it traffic before it stops accepting connections.
+type Shutdown struct {
+	DrainSeconds   int `json:"drain_seconds"`
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// TLS serves HTTPS, with HTTP/2, when CertFile and KeyFile are set. The files
+// are checked for changes every CheckSeconds and reloaded without a restart.
+// With ClientCAFile, client certificates signed by it are verified when
+// given; AdminClientCert then makes a verified certificate whose common name
+// is an admin the only way to admin rights: into admin routes, and over
+// forums, users and uploads for a token of the same admin. RedirectPort, when
+// set, serves plain HTTP that redirects to HTTPS.
+type TLS struct {
+	CertFile        string `json:"cert_file"`
+	KeyFile         string `json:"key_file"`
+	CheckSeconds    int    `json:"check_seconds"`
+	ClientCAFile    string `json:"client_ca_file"`
+	AdminClientCert bool   `json:"admin_client_cert"`
+	RedirectPort    int    `json:"redirect_port"`
+}
+
+// Enabled tells whether the server speaks HTTPS.
+func (conf TLS) Enabled() bool {
+	return conf.CertFile != ""
+}
+
+// GRPC serves the API of internal/grpcapi/forum.proto on Port, over TLS when
+// it is configured and unencrypted HTTP/2 otherwise. Port 0 turns it off.
+type GRPC struct {
+	Port int `json:"port"`
+}
+
+// GraphQL bounds the queries /api/graphql accepts: how deeply selections may
+// nest and how many objects a query may ask for, counting each list field as
+// its limit argument, or a typical size without one. Zero means no bound.
+type GraphQL struct {
+	MaxDepth      int `json:"max_depth"`
+	MaxComplexity int `json:"max_complexity"`
+}
+
+// Responses configure JSON responses. With ETags, successful GETs carry a
+// strong ETag and a request whose If-None-Match names it gets 304 and no
+// body. With Compress, bodies of at least CompressMinSize bytes are gzipped,
+// at CompressLevel from 1 to 9, for clients that accept it.
+type Responses struct {
+	ETags           bool `json:"etags"`
+	Compress        bool `json:"compress"`
+	CompressMinSize int  `json:"compress_min_size"`
+	CompressLevel   int  `json:"compress_level"`
 }
 
+// Idempotency keeps the first response to a create request sent with an
+// Idempotency-Key header for TTLSeconds, so that retries with the key get it
+// again. Responses are kept in process memory, or in Postgres with store
+// "postgres" so that a retry may reach any instance.
+type Idempotency struct {
+	Store      string `json:"store" reload:"restart"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+// HasAdmin tells whether nick is listed in admins.
+func (conf *Config) HasAdmin(nick string) bool {
+	for _, admin := range conf.Admins {
+		if strings.EqualFold(admin, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// Default is the configuration before any layer is applied.
+func Default() *Config {
+	return &Config{
+		Port:                    5000,
+		DBHost:                  "localhost",
+		DBPort:                  5432,
+		DBMaxConnections:        80,
+		DBAcquireTimeoutSeconds: 7,
+		AuthRequired:            true,
+		Admins:                  []string{},
+		RateLimits:              RateLimits{Store: "memory"},
+		Filter:                  Filter{Words: []string{}, CacheSize: 1000, CacheSeconds: 30},
+		Attachments: Attachments{
+			Store:          "local",
+			Dir:            "/var/lib/forum/attachments",
+			MaxSize:        10 << 20,
+			Types:          []string{"image/*", "application/pdf", "text/plain", "application/zip"},
+			OrphanSeconds:  86400,
+			CleanupSeconds: 3600,
+		},
+		Recorder: Recorder{MaxBody: 64 << 10},
+		Log:      Log{Level: "info"},
+		Tracing:  Tracing{Exporter: "none", Service: "forum"},
+		Shutdown: Shutdown{DrainSeconds: 5, TimeoutSeconds: 30},
+		TLS:      TLS{CheckSeconds: 60},
+		GraphQL:  GraphQL{MaxDepth: 10, MaxComplexity: 10000},
+		Responses: Responses{
+			ETags:           true,
+			Compress:        true,
+			CompressMinSize: 1024,
+			CompressLevel:   6,
+		},
+		Idempotency: Idempotency{Store: "memory", TTLSeconds: 86400},
+	}
+}
+
+// NewConfig loads the file at pathToConfig over the defaults and applies the
+// environment, for tools that take no configuration flags.
 func NewConfig(pathToConfig string) (*Config, error) {
-	conf := new(Config)
-	configFile, err := os.Open(pathToConfig)
+	conf := Default()
+	err := conf.readFile(pathToConfig)
 	if err != nil {
 		return nil, err
 	}
+	err = conf.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return conf, conf.Validate()
+}
 
-	defer configFile.Close()
-
-	jsonParser := json.NewDecoder(configFile)
-	err = jsonParser.Decode(&conf)
+// Load registers -config and a flag per setting on flags, parses args and
+// builds the configuration. The file may also be given as the only
+// positional argument; without one, defaults, environment and flags alone
+// make the configuration.
+func Load(flags *flag.FlagSet, args []string) (*Config, error) {
+	path := flags.String("config", "", "read settings from the JSON or YAML `file`")
+	set := newFlagSet(flags)
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case flags.NArg() > 1 || (flags.NArg() == 1 && *path != ""):
+		return nil, errors.New("config: give the config file once, as -config or as the only argument")
+	case flags.NArg() == 1:
+		*path = flags.Arg(0)
+	}
+	conf := Default()
+	if *path != "" {
+		err = conf.readFile(*path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = conf.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	err = set.apply(conf)
 	if err != nil {
 		return nil, err
 	}
-	return conf, nil
+	return conf, conf.Validate()
+}
+
+// readFile decodes JSON, or YAML for .yaml and .yml files, over conf. Keys
+// that match no setting are an error, so typos do not go unnoticed.
+func (conf *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		values, err := parseYAML(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		err = conf.applyTree(values, "")
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(conf)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
 }
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Reload compares next, freshly loaded, with the running config. It returns
+// the config to run with from now on: next, except that settings which need
+// a restart keep their running values. Changed settings are listed by path,
+// split into those that took effect and those waiting for a restart.
+func Reload(running *Config, next *Config) (effective *Config, applied []string, pending []string) {
+	effective = new(Config)
+	*effective = *next
+	runningSettings := running.settings()
+	nextSettings := next.settings()
+	effectiveSettings := effective.settings()
+	applied = []string{}
+	pending = []string{}
+	for i, s := range nextSettings {
+		if reflect.DeepEqual(s.value.Interface(), runningSettings[i].value.Interface()) {
+			continue
+		}
+		if s.restart {
+			effectiveSettings[i].value.Set(runningSettings[i].value)
+			pending = append(pending, s.path)
+			continue
+		}
+		applied = append(applied, s.path)
+	}
+	return effective, applied, pending
+}
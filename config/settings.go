@@ -0,0 +1,221 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "FORUM_"
+
+// setting is one leaf of Config, named by the path of its JSON keys, like
+// rate_limits.writes.rate.
+type setting struct {
+	path    string
+	value   reflect.Value
+	secret  bool
+	restart bool
+}
+
+// env names the variable that overrides the setting: FORUM_ and the path in
+// upper case with dots turned into underscores.
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(strings.Replace(s.path, ".", "_", -1))
+}
+
+func (conf *Config) settings() []setting {
+	var list []setting
+	collectSettings(reflect.ValueOf(conf).Elem(), "", false, &list)
+	return list
+}
+
+func collectSettings(v reflect.Value, prefix string, restart bool, list *[]setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		fieldRestart := restart || field.Tag.Get("reload") == "restart"
+		if field.Type.Kind() == reflect.Struct {
+			collectSettings(v.Field(i), path+".", fieldRestart, list)
+			continue
+		}
+		*list = append(*list, setting{
+			path:    path,
+			value:   v.Field(i),
+			secret:  field.Tag.Get("secret") == "true",
+			restart: fieldRestart,
+		})
+	}
+}
+
+func (conf *Config) setting(path string) (setting, bool) {
+	for _, s := range conf.settings() {
+		if s.path == path {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// set parses raw into the setting. Lists are comma-separated; an empty raw
+// value makes an empty list.
+func (s setting) set(raw string) error {
+	v := s.value
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("settings of kind %s cannot be set", v.Kind())
+	}
+	return nil
+}
+
+func (conf *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for _, s := range conf.settings() {
+		raw, ok := lookup(s.env())
+		if !ok {
+			continue
+		}
+		err := s.set(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.env(), err)
+		}
+	}
+	return nil
+}
+
+// applyTree sets the settings found in a decoded YAML document.
+func (conf *Config) applyTree(values map[string]interface{}, prefix string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := prefix + key
+		switch value := values[key].(type) {
+		case map[string]interface{}:
+			err := conf.applyTree(value, path+".")
+			if err != nil {
+				return err
+			}
+			continue
+		case []string:
+			s, ok := conf.setting(path)
+			if !ok {
+				return fmt.Errorf("unknown setting %s", path)
+			}
+			if s.value.Kind() != reflect.Slice {
+				return fmt.Errorf("%s: a list is given for a single value", path)
+			}
+			s.value.Set(reflect.ValueOf(append([]string{}, value...)))
+		case string:
+			s, ok := conf.setting(path)
+			if !ok {
+				return fmt.Errorf("unknown setting %s", path)
+			}
+			if s.value.Kind() == reflect.Slice {
+				return fmt.Errorf("%s: a single value is given for a list", path)
+			}
+			err := s.set(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// flagSet records the flags given on the command line, to be applied once
+// the file and the environment are.
+type flagSet struct {
+	given map[string]string
+	order []string
+}
+
+func newFlagSet(flags *flag.FlagSet) *flagSet {
+	set := &flagSet{given: make(map[string]string)}
+	for _, s := range Default().settings() {
+		usage := "sets " + s.path + ", like $" + s.env()
+		if s.value.Kind() == reflect.Slice {
+			usage += "; comma-separated"
+		}
+		flags.Var(&flagValue{set: set, path: s.path, bool: s.value.Kind() == reflect.Bool}, s.path, usage)
+	}
+	return set
+}
+
+func (set *flagSet) apply(conf *Config) error {
+	for _, path := range set.order {
+		s, _ := conf.setting(path)
+		err := s.set(set.given[path])
+		if err != nil {
+			return fmt.Errorf("-%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+type flagValue struct {
+	set  *flagSet
+	path string
+	bool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.set == nil {
+		return ""
+	}
+	return f.set.given[f.path]
+}
+
+func (f *flagValue) Set(raw string) error {
+	s, _ := Default().setting(f.path)
+	err := s.set(raw)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.set.given[f.path]; !ok {
+		f.set.order = append(f.set.order, f.path)
+	}
+	f.set.given[f.path] = raw
+	return nil
+}
+
+// IsBoolFlag lets toggles be given as -tls.admin_client_cert alone.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.bool
+}
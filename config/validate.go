@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/logging"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ValidationError lists every problem found, so a bad config is fixed in one
+// go rather than one restart per mistake.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, path string, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) port(path string, port int) {
+	v.check(port >= 1 && port <= 65535, path, "must be a port from 1 to 65535, got %d", port)
+}
+
+func (v *validator) notNegative(path string, n int64) {
+	v.check(n >= 0, path, "must not be negative, got %d", n)
+}
+
+func (v *validator) oneOf(path string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) rateLimit(path string, limit RateLimit) {
+	v.check(limit.Rate >= 0, path+".rate", "must not be negative, got %g", limit.Rate)
+	v.notNegative(path+".burst", int64(limit.Burst))
+}
+
+func (conf *Config) Validate() error {
+	v := &validator{}
+	v.port("port", conf.Port)
+	v.check(conf.DBHost != "", "dbhost", "must be set")
+	v.port("dbport", conf.DBPort)
+	v.check(conf.DBUser != "", "dbuser", "must be set")
+	v.check(conf.DBName != "", "dbname", "must be set")
+	v.check(conf.DBMaxConnections >= 1, "db_max_connections", "must be at least 1, got %d", conf.DBMaxConnections)
+	v.check(conf.DBAcquireTimeoutSeconds >= 1, "db_acquire_timeout_seconds",
+		"must be at least 1, got %d", conf.DBAcquireTimeoutSeconds)
+	for i, admin := range conf.Admins {
+		v.check(strings.TrimSpace(admin) != "", fmt.Sprintf("admins[%d]", i), "must not be empty")
+	}
+
+	v.oneOf("rate_limits.store", conf.RateLimits.Store, "memory", "postgres")
+	v.rateLimit("rate_limits.writes", conf.RateLimits.Writes)
+	v.rateLimit("rate_limits.votes", conf.RateLimits.Votes)
+	v.rateLimit("rate_limits.reads", conf.RateLimits.Reads)
+
+	v.notNegative("filter.cache_size", int64(conf.Filter.CacheSize))
+	v.notNegative("filter.cache_seconds", int64(conf.Filter.CacheSeconds))
+
+	v.oneOf("attachments.store", conf.Attachments.Store, "local")
+	v.check(conf.Attachments.Dir != "", "attachments.dir", "must be set")
+	v.check(conf.Attachments.MaxSize > 0, "attachments.max_size", "must be positive, got %d", conf.Attachments.MaxSize)
+	for i, contentType := range conf.Attachments.Types {
+		v.check(strings.Count(contentType, "/") == 1, fmt.Sprintf("attachments.types[%d]", i),
+			"must look like type/subtype or type/*, got %q", contentType)
+	}
+	v.notNegative("attachments.orphan_seconds", int64(conf.Attachments.OrphanSeconds))
+	v.notNegative("attachments.cleanup_seconds", int64(conf.Attachments.CleanupSeconds))
+
+	v.notNegative("recorder.max_body", int64(conf.Recorder.MaxBody))
+	_, err := logging.ParseLevel(conf.Log.Level)
+	v.check(err == nil, "log.level", "must be one of debug, info, warn, error, got %q", conf.Log.Level)
+	v.oneOf("tracing.exporter", conf.Tracing.Exporter, "none", "stdout", "file")
+	v.check(conf.Tracing.Exporter != "file" || conf.Tracing.Path != "", "tracing.path",
+		"must be set for the file exporter")
+	v.notNegative("shutdown.drain_seconds", int64(conf.Shutdown.DrainSeconds))
+	v.notNegative("shutdown.timeout_seconds", int64(conf.Shutdown.TimeoutSeconds))
+
+	tls := conf.TLS
+	v.check((tls.CertFile == "") == (tls.KeyFile == ""), "tls", "cert_file and key_file must be set together")
+	v.notNegative("tls.check_seconds", int64(tls.CheckSeconds))
+	v.check(tls.ClientCAFile == "" || tls.Enabled(), "tls.client_ca_file", "needs cert_file and key_file")
+	v.check(!tls.AdminClientCert || tls.ClientCAFile != "", "tls.admin_client_cert", "needs client_ca_file")
+	if tls.RedirectPort != 0 {
+		v.check(tls.Enabled(), "tls.redirect_port", "needs cert_file and key_file")
+		v.port("tls.redirect_port", tls.RedirectPort)
+		v.check(tls.RedirectPort != conf.Port, "tls.redirect_port", "must differ from port")
+	}
+	if conf.GRPC.Port != 0 {
+		v.port("grpc.port", conf.GRPC.Port)
+		v.check(conf.GRPC.Port != conf.Port && conf.GRPC.Port != tls.RedirectPort, "grpc.port",
+			"must differ from port and tls.redirect_port")
+	}
+	v.notNegative("graphql.max_depth", int64(conf.GraphQL.MaxDepth))
+	v.notNegative("graphql.max_complexity", int64(conf.GraphQL.MaxComplexity))
+	v.notNegative("responses.compress_min_size", int64(conf.Responses.CompressMinSize))
+	v.check(conf.Responses.CompressLevel >= 1 && conf.Responses.CompressLevel <= 9, "responses.compress_level",
+		"must be from 1 to 9, got %d", conf.Responses.CompressLevel)
+	v.oneOf("idempotency.store", conf.Idempotency.Store, "memory", "postgres")
+	v.check(conf.Idempotency.TTLSeconds > 0, "idempotency.ttl_seconds", "must be positive, got %d",
+		conf.Idempotency.TTLSeconds)
+
+	if len(v.problems) != 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// WriteRedacted writes the effective config as JSON with secrets masked.
+func (conf *Config) WriteRedacted(w io.Writer) error {
+	redacted := *conf
+	for _, s := range redacted.settings() {
+		if s.secret && s.value.Len() != 0 {
+			s.value.Set(reflect.ValueOf("<redacted>"))
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(&redacted)
+}
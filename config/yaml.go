@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseYAML reads the part of YAML a config file needs: nested block
+// mappings, scalars, and lists of scalars written as "- item" lines or as
+// [a, b]. Anchors, multi-line scalars and lists of mappings are rejected.
+// Scalars are kept as strings and typed by the setting they land in.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripComment(raw), " \t\r")
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if strings.HasPrefix(text[indent:], "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: indent, text: text[indent:]})
+	}
+	root, err := p.mapping(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return root, nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+		if strings.HasPrefix(line.text, "- ") || line.text == "-" {
+			return nil, fmt.Errorf("line %d: list item where a key was expected", line.number)
+		}
+		colon := keyEnd(line.text)
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		key, err := unquote(strings.TrimSpace(line.text[:colon]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.number, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: key %s repeated", line.number, key)
+		}
+		rest := strings.TrimSpace(line.text[colon+1:])
+		p.pos++
+		if rest != "" {
+			values[key], err = scalarOrFlow(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.number, err)
+			}
+			continue
+		}
+		if p.pos >= len(p.lines) || p.lines[p.pos].indent < indent ||
+			(p.lines[p.pos].indent == indent && !isListItem(p.lines[p.pos].text)) {
+			values[key] = ""
+			continue
+		}
+		next := p.lines[p.pos]
+		if isListItem(next.text) {
+			values[key], err = p.list(next.indent)
+		} else {
+			values[key], err = p.mapping(next.indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (p *yamlParser) list(indent int) ([]string, error) {
+	items := []string{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isListItem(line.text) {
+			break
+		}
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if keyEnd(item) >= 0 || strings.HasPrefix(item, "[") || strings.HasPrefix(item, "{") || item == "" {
+			return nil, fmt.Errorf("line %d: only lists of plain values are supported", line.number)
+		}
+		value, err := unquote(item)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.number, err)
+		}
+		items = append(items, value)
+		p.pos++
+	}
+	return items, nil
+}
+
+func isListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// scalarOrFlow reads a value given on the line of its key: a scalar, a flow
+// list or an empty flow mapping.
+func scalarOrFlow(text string) (interface{}, error) {
+	switch {
+	case text == "{}":
+		return map[string]interface{}{}, nil
+	case strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("flow mappings are not supported, use indented keys")
+	case strings.HasPrefix(text, "&"), strings.HasPrefix(text, "*"), text == "|", text == ">",
+		strings.HasPrefix(text, "|"), strings.HasPrefix(text, ">"):
+		return nil, fmt.Errorf("anchors, aliases and block scalars are not supported")
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated list %s", text)
+		}
+		items := []string{}
+		for _, item := range splitFlow(text[1 : len(text)-1]) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			value, err := unquote(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	}
+	if text == "~" || text == "null" {
+		return "", nil
+	}
+	return unquote(text)
+}
+
+// keyEnd finds the colon that ends a key, outside quotes and followed by a
+// space or the end of the line.
+func keyEnd(text string) int {
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func splitFlow(text string) []string {
+	var items []string
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, text[start:])
+}
+
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(text string) (string, error) {
+	if len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		var out strings.Builder
+		inner := text[1 : len(text)-1]
+		for i := 0; i < len(inner); i++ {
+			if inner[i] != '\\' {
+				out.WriteByte(inner[i])
+				continue
+			}
+			i++
+			if i == len(inner) {
+				return "", fmt.Errorf("bad escape in %s", text)
+			}
+			switch inner[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case '"', '\\', '/':
+				out.WriteByte(inner[i])
+			default:
+				return "", fmt.Errorf("unsupported escape \\%c in %s", inner[i], text)
+			}
+		}
+		return out.String(), nil
+	}
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		return "", fmt.Errorf("unterminated string %s", text)
+	}
+	return text, nil
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	source := `---
+# database
+dbhost: db.internal   # the primary
+dbport: 5432
+dbpassword: "p#ss: \"word\"\n"
+dbname: 'it''s'
+admins:
+  - alice
+  - "bob # not a comment"
+filter:
+  words: [spam, 'eggs, ham', "x"]
+  cache_size: 100
+rate_limits:
+  writes:
+    rate: 2.5
+    burst: 10
+  reads: {}
+attachments:
+  types: []
+  dir: ~
+tracing:
+  path:
+tls:
+  cert_file: null
+`
+	want := map[string]interface{}{
+		"dbhost":     "db.internal",
+		"dbport":     "5432",
+		"dbpassword": "p#ss: \"word\"\n",
+		"dbname":     "it's",
+		"admins":     []string{"alice", "bob # not a comment"},
+		"filter": map[string]interface{}{
+			"words":      []string{"spam", "eggs, ham", "x"},
+			"cache_size": "100",
+		},
+		"rate_limits": map[string]interface{}{
+			"writes": map[string]interface{}{"rate": "2.5", "burst": "10"},
+			"reads":  map[string]interface{}{},
+		},
+		"attachments": map[string]interface{}{
+			"types": []string{},
+			"dir":   "",
+		},
+		"tracing": map[string]interface{}{"path": ""},
+		"tls":     map[string]interface{}{"cert_file": ""},
+	}
+	got, err := parseYAML([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseYAMLListAtKeyIndent(t *testing.T) {
+	got, err := parseYAML([]byte("admins:\n- alice\n- bob\nlog:\n  level: debug\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"admins": []string{"alice", "bob"},
+		"log":    map[string]interface{}{"level": "debug"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"log:\n\tlevel: debug\n", "line 2: indent with spaces, not tabs"},
+		{"log:\n  level: debug\n    format: json\n", "line 3: unexpected indentation"},
+		{"  dbhost: a\ndbport: 1\n", "line 1: unexpected indentation"},
+		{"dbhost\n", `line 1: expected "key: value"`},
+		{"dbhost: a\ndbhost: b\n", "line 2: key dbhost repeated"},
+		{"- alice\n", "line 1: list item where a key was expected"},
+		{"admins:\n  - name: alice\n", "line 2: only lists of plain values are supported"},
+		{"admins:\n  - [alice]\n", "line 2: only lists of plain values are supported"},
+		{"log: {level: debug}\n", "line 1: flow mappings are not supported"},
+		{"base: &base\n", "line 1: anchors, aliases and block scalars are not supported"},
+		{"copy: *base\n", "line 1: anchors, aliases and block scalars are not supported"},
+		{"motd: |\n  hello\n", "line 1: anchors, aliases and block scalars are not supported"},
+		{"admins: [alice, bob\n", "line 1: unterminated list"},
+		{"dbhost: \"db\n", "line 1: unterminated string"},
+		{"dbhost: \"d\\x\"\n", `line 1: unsupported escape \x`},
+		{"'dbhost: a\n", `line 1: expected "key: value"`},
+	}
+	for _, test := range tests {
+		_, err := parseYAML([]byte(test.source))
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("parseYAML(%q) = %v, want %q", test.source, err, test.want)
+		}
+	}
+}
+
+func TestReadYAMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forum.yml")
+	source := `
+dbhost: db.internal
+admins: [alice]
+rate_limits:
+  trust_forwarded: true
+  writes:
+    rate: 2.5
+shutdown:
+  drain_seconds: 0
+`
+	err := os.WriteFile(path, []byte(source), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := Default()
+	err = conf.readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.DBHost != "db.internal" || !reflect.DeepEqual(conf.Admins, []string{"alice"}) ||
+		!conf.RateLimits.TrustForwarded || conf.RateLimits.Writes.Rate != 2.5 || conf.Shutdown.DrainSeconds != 0 {
+		t.Errorf("settings not read from YAML: %+v", conf)
+	}
+	if conf.RateLimits.Writes.Burst != Default().RateLimits.Writes.Burst {
+		t.Errorf("rate_limits.writes.burst = %d, want the default %d",
+			conf.RateLimits.Writes.Burst, Default().RateLimits.Writes.Burst)
+	}
+}
+
+func TestReadYAMLFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"dbhots: db\n":               "unknown setting dbhots",
+		"dbport: many\n":             "dbport: ",
+		"admins: alice\n":            "admins: a single value is given for a list",
+		"dbhost: [a, b]\n":           "dbhost: a list is given for a single value",
+		"log:\n  level:\n    a: b\n": "unknown setting log.level.a",
+	}
+	for source, want := range tests {
+		path := filepath.Join(t.TempDir(), "forum.yaml")
+		err := os.WriteFile(path, []byte(source), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Default().readFile(path)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("readFile(%q) = %v, want %q", source, err, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package archive defines the portable forum archive: newline-delimited JSON
+// records, each {"type": ..., "data": ...}. An archive starts with a header,
+// then holds the forum, its users, threads, posts in id order so that parents
+// come before replies, and votes, and ends with an end record carrying the
+// record count. A missing end record means the archive is truncated.
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+const Version = 1
+
+const (
+	TypeHeader = "header"
+	TypeForum  = "forum"
+	TypeUser   = "user"
+	TypeThread = "thread"
+	TypePost   = "post"
+	TypeVote   = "vote"
+	TypeEnd    = "end"
+	TypeError  = "error"
+)
+
+type Record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Header struct {
+	Version  int    `json:"version"`
+	Forum    string `json:"forum"`
+	Exported string `json:"exported"`
+}
+
+type Forum struct {
+	Posts   int64  `json:"posts"`
+	Slug    string `json:"slug"`
+	Threads int32  `json:"threads"`
+	Title   string `json:"title"`
+	User    string `json:"user"`
+}
+
+type User struct {
+	About    string `json:"about"`
+	Email    string `json:"email"`
+	Fullname string `json:"fullname"`
+	Nickname string `json:"nickname"`
+}
+
+type Thread struct {
+	Author  string `json:"author"`
+	Created string `json:"created"`
+	ID      int32  `json:"id"`
+	Message string `json:"message"`
+	Slug    string `json:"slug,omitempty"`
+	Title   string `json:"title"`
+	Votes   int32  `json:"votes"`
+}
+
+type Post struct {
+	Author   string `json:"author"`
+	Created  string `json:"created"`
+	ID       int64  `json:"id"`
+	IsEdited bool   `json:"isEdited"`
+	Message  string `json:"message"`
+	Parent   int64  `json:"parent"`
+	Thread   int32  `json:"thread"`
+}
+
+type Vote struct {
+	Nickname string `json:"nickname"`
+	Thread   int32  `json:"thread"`
+	Voice    int32  `json:"voice"`
+}
+
+type End struct {
+	Records int64 `json:"records"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Writer encodes records. It buffers output; call Flush to push it through.
+type Writer struct {
+	out     *bufio.Writer
+	records int64
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{out: bufio.NewWriter(w)}
+}
+
+func (w *Writer) Write(kind string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(Record{Type: kind, Data: encoded})
+	if err != nil {
+		return err
+	}
+	_, err = w.out.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	w.records++
+	return nil
+}
+
+// Records is the number of records written so far.
+func (w *Writer) Records() int64 {
+	return w.records
+}
+
+// Close writes the end record and flushes.
+func (w *Writer) Close() error {
+	err := w.Write(TypeEnd, End{Records: w.records})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (w *Writer) Flush() error {
+	return w.out.Flush()
+}
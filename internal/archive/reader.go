@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Collision policies for imports: fail aborts the import, skip keeps what is
+// already there, rename imports under a fresh slug or nickname.
+const (
+	PolicyFail   = "fail"
+	PolicySkip   = "skip"
+	PolicyRename = "rename"
+)
+
+func IsPolicy(policy string) bool {
+	return policy == PolicyFail || policy == PolicySkip || policy == PolicyRename
+}
+
+// Reader decodes records one line at a time, so archives of any size can be
+// read without holding them in memory.
+type Reader struct {
+	in   *bufio.Reader
+	line int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{in: bufio.NewReader(r)}
+}
+
+// Next returns the next record, or io.EOF after the last one.
+func (r *Reader) Next() (Record, error) {
+	for {
+		line, err := r.in.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return Record{}, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return Record{}, err
+		}
+		r.line++
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			continue
+		}
+		record := Record{}
+		err = json.Unmarshal(line, &record)
+		if err != nil || record.Type == "" {
+			return Record{}, fmt.Errorf("line %d: not an archive record", r.line)
+		}
+		return record, nil
+	}
+}
+
+// Decode unmarshals the data of record into v.
+func (r *Reader) Decode(record Record, v interface{}) error {
+	err := json.Unmarshal(record.Data, v)
+	if err != nil {
+		return fmt.Errorf("line %d: bad %s record: %s", r.line, record.Type, err.Error())
+	}
+	return nil
+}
+
+// Line is the number of the line of the last record read.
+func (r *Reader) Line() int {
+	return r.line
+}
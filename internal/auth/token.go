@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	tokenLength = 32
+
+	SessionToken  = "session"
+	PersonalToken = "personal"
+)
+
+// NewToken generates a random bearer token. Only its hash is meant to be stored.
+func NewToken() (string, error) {
+	raw := make([]byte, tokenLength)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of token, used as its storage key.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,27 @@
+// Package blobstore keeps uploaded files outside the database.
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store saves blobs under opaque keys chosen by the caller. Delete of a missing
+// key is not an error.
+type Store interface {
+	Put(key string, r io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// New returns the store of the given kind; "local" keeps blobs under dir.
+func New(kind string, dir string) (Store, error) {
+	switch kind {
+	case "", "local":
+		return NewLocalStore(dir)
+	}
+	return nil, fmt.Errorf("unknown blob store %q", kind)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"gopkg.in/jackc/pgx.v2"
+)
+
+const (
+	getPostAuthor         = "SELECT author, forum FROM posts WHERE id = $1"
+	getThreadAuthorById   = "SELECT author, forum FROM threads WHERE id = $1"
+	getThreadAuthorBySlug = "SELECT author, forum FROM threads WHERE slug = $1"
+	getForumRole          = "SELECT f.user_nick, EXISTS(SELECT 1 FROM forum_moderators m " +
+		"WHERE m.forum = f.slug AND m.user_nick = $2) FROM forum f WHERE f.slug = $1"
+)
+
+// GetPostAuthor returns the author of the post and the forum it belongs to.
+func (db *DB) GetPostAuthor(postId string) (_ string, _ string, status int) {
+	defer db.track("GetPostAuthor", &status)()
+	return db.getAuthor(getPostAuthor, postId)
+}
+
+// GetThreadAuthorById returns the author of the thread and the forum it belongs to.
+func (db *DB) GetThreadAuthorById(id string) (_ string, _ string, status int) {
+	defer db.track("GetThreadAuthorById", &status)()
+	return db.getAuthor(getThreadAuthorById, id)
+}
+
+func (db *DB) GetThreadAuthorBySlug(slug string) (_ string, _ string, status int) {
+	defer db.track("GetThreadAuthorBySlug", &status)()
+	return db.getAuthor(getThreadAuthorBySlug, slug)
+}
+
+// GetForumRole returns the owner of the forum and whether userNick moderates it.
+func (db *DB) GetForumRole(forumId string, userNick string) (_ string, _ bool, status int) {
+	defer db.track("GetForumRole", &status)()
+	owner := ""
+	isModerator := false
+	err := db.sql().QueryRow(getForumRole, forumId, userNick).Scan(&owner, &isModerator)
+	if err == pgx.ErrNoRows {
+		return "", false, EmptyResult
+	}
+	if err != nil {
+		db.logError("getForumRole", err)
+		return "", false, DBError
+	}
+	return owner, isModerator, OK
+}
+
+func (db *DB) getAuthor(query string, key string) (string, string, int) {
+	author := ""
+	forumId := ""
+	err := db.sql().QueryRow(query, key).Scan(&author, &forumId)
+	if err == pgx.ErrNoRows {
+		return "", "", EmptyResult
+	}
+	if err != nil {
+		db.logError("getAuthor", err)
+		return "", "", DBError
+	}
+	return author, forumId, OK
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+const (
+	createAttachment = "INSERT INTO attachments (blob_key, owner, name, content_type, size) " +
+		"VALUES($1, $2, $3, $4, $5) RETURNING id, created"
+	getAttachment = "SELECT a.id, a.blob_key, a.owner, a.name, a.content_type, a.size, a.created, " +
+		"COALESCE(a.post, 0), COALESCE(p.forum, '') FROM attachments a " +
+		"LEFT JOIN pending_posts p ON (p.id = a.pending) WHERE a.id = $1"
+	getPostsAttachments = "SELECT id, owner, name, content_type, size, created, post FROM attachments " +
+		"WHERE post = ANY($1) ORDER BY id"
+	claimAttachmentsForPost = "UPDATE attachments SET post = $1 WHERE id = ANY($2) AND " +
+		"owner = (SELECT nick_name FROM users WHERE nick_name = $3) AND post IS NULL AND pending IS NULL " +
+		"RETURNING id, owner, name, content_type, size, created"
+	claimAttachmentsForPending = "UPDATE attachments SET pending = $1 WHERE id = ANY($2) AND " +
+		"owner = (SELECT nick_name FROM users WHERE nick_name = $3) AND post IS NULL AND pending IS NULL " +
+		"RETURNING id, owner, name, content_type, size, created"
+	countFreeAttachments = "SELECT count(*) FROM attachments WHERE id = ANY($1) AND " +
+		"owner = (SELECT nick_name FROM users WHERE nick_name = $2) AND post IS NULL AND pending IS NULL"
+	publishPendingAttachments = "UPDATE attachments SET post = $1, pending = NULL WHERE pending = $2"
+	isOrphanAttachment        = "(post IS NULL AND pending IS NULL AND created < $1) " +
+		"OR (post IS NOT NULL AND NOT EXISTS (SELECT 1 FROM posts WHERE id = attachments.post)) " +
+		"OR (pending IS NOT NULL AND NOT EXISTS (SELECT 1 FROM pending_posts WHERE id = attachments.pending))"
+	getOrphanAttachments   = "SELECT id FROM attachments WHERE " + isOrphanAttachment + " ORDER BY id LIMIT $2"
+	deleteOrphanAttachment = "DELETE FROM attachments WHERE id = $2 AND (" + isOrphanAttachment + ") RETURNING blob_key"
+	deleteOwnAttachment    = "DELETE FROM attachments WHERE id = $1 AND owner = $2 AND post IS NULL AND pending IS NULL " +
+		"RETURNING blob_key"
+)
+
+// CreateAttachment records an uploaded blob. The attachment stays unattached
+// until a post of its owner references it.
+func (db *DB) CreateAttachment(key string, attachment models.Attachment) (_ models.Attachment, status int) {
+	defer db.track("CreateAttachment", &status)()
+	created := time.Time{}
+	err := db.sql().QueryRow(createAttachment, key, attachment.Owner, attachment.Name,
+		attachment.ContentType, attachment.Size).Scan(&attachment.ID, &created)
+	if err != nil {
+		db.logError("createAttachment", err)
+		return models.Attachment{}, DBError
+	}
+	attachment.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+	return attachment, OK
+}
+
+// GetAttachment returns the attachment, its blob key and, for attachments of
+// posts held for moderation, the forum of the pending post.
+func (db *DB) GetAttachment(id string) (_ models.Attachment, _ string, _ string, status int) {
+	defer db.track("GetAttachment", &status)()
+	attachment := models.Attachment{}
+	key := ""
+	pendingForum := ""
+	created := time.Time{}
+	err := db.sql().QueryRow(getAttachment, id).Scan(&attachment.ID, &key, &attachment.Owner, &attachment.Name,
+		&attachment.ContentType, &attachment.Size, &created, &attachment.Post, &pendingForum)
+	if err == pgx.ErrNoRows {
+		return attachment, "", "", EmptyResult
+	}
+	if err != nil {
+		db.logError("getAttachment", err)
+		return attachment, "", "", DBError
+	}
+	attachment.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+	return attachment, key, pendingForum, OK
+}
+
+// DeleteAttachment removes an upload of owner that no post references yet and
+// returns its blob key.
+func (db *DB) DeleteAttachment(id string, owner string) (_ string, status int) {
+	defer db.track("DeleteAttachment", &status)()
+	key := ""
+	err := db.sql().QueryRow(deleteOwnAttachment, id, owner).Scan(&key)
+	if err == pgx.ErrNoRows {
+		return "", EmptyResult
+	}
+	if err != nil {
+		db.logError("deleteOwnAttachment", err)
+		return "", DBError
+	}
+	return key, OK
+}
+
+// GetOrphanAttachments lists attachments that were never used before
+// unusedBefore or whose post is gone.
+func (db *DB) GetOrphanAttachments(unusedBefore time.Time, limit int) (_ []int64, status int) {
+	defer db.track("GetOrphanAttachments", &status)()
+	rows, err := db.sql().Query(getOrphanAttachments, unusedBefore, limit)
+	if err != nil {
+		db.logError("getOrphanAttachments", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		id := int64(0)
+		err := rows.Scan(&id)
+		if err != nil {
+			db.logError("getOrphanAttachments", err)
+			return nil, DBError
+		}
+		ids = append(ids, id)
+	}
+	return ids, OK
+}
+
+// DeleteOrphanAttachment removes the attachment if it is still an orphan and
+// returns its blob key.
+func (db *DB) DeleteOrphanAttachment(id int64, unusedBefore time.Time) (_ string, status int) {
+	defer db.track("DeleteOrphanAttachment", &status)()
+	key := ""
+	err := db.sql().QueryRow(deleteOrphanAttachment, unusedBefore, id).Scan(&key)
+	if err == pgx.ErrNoRows {
+		return "", EmptyResult
+	}
+	if err != nil {
+		db.logError("deleteOrphanAttachment", err)
+		return "", DBError
+	}
+	return key, OK
+}
+
+// AreAttachmentsFree reports whether all attachments are uploads of owner not
+// referenced by any post yet.
+func (db *DB) AreAttachmentsFree(owner string, attachments models.Attachments) (_ bool, status int) {
+	defer db.track("AreAttachmentsFree", &status)()
+	ids := attachmentIds(attachments)
+	count := 0
+	err := db.sql().QueryRow(countFreeAttachments, ids, owner).Scan(&count)
+	if err != nil {
+		db.logError("countFreeAttachments", err)
+		return false, DBError
+	}
+	return count == len(ids), OK
+}
+
+// claimAttachments attaches unused uploads of author to a post, or to a
+// pending post if pending is set. Conflict means some of them are not available.
+func claimAttachments(tx *Tx, itemId int64, pending bool, author string,
+	attachments models.Attachments) (models.Attachments, int) {
+	ids := attachmentIds(attachments)
+	query := claimAttachmentsForPost
+	if pending {
+		query = claimAttachmentsForPending
+	}
+	rows, err := tx.Query(query, itemId, ids, author)
+	if err != nil {
+		logStorageError("claimAttachments", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	claimed := make(models.Attachments, 0, len(ids))
+	for rows.Next() {
+		attachment := &models.Attachment{}
+		created := time.Time{}
+		err := rows.Scan(&attachment.ID, &attachment.Owner, &attachment.Name, &attachment.ContentType,
+			&attachment.Size, &created)
+		if err != nil {
+			logStorageError("claimAttachments", err)
+			return nil, DBError
+		}
+		attachment.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		if !pending {
+			attachment.Post = itemId
+		}
+		claimed = append(claimed, attachment)
+	}
+	if rows.Err() != nil {
+		return nil, DBError
+	}
+	if len(claimed) != len(ids) {
+		return nil, Conflict
+	}
+	return claimed, OK
+}
+
+func attachmentIds(attachments models.Attachments) []int64 {
+	ids := make([]int64, 0, len(attachments))
+	unique := make(map[int64]bool)
+	for _, attachment := range attachments {
+		if !unique[attachment.ID] {
+			unique[attachment.ID] = true
+			ids = append(ids, attachment.ID)
+		}
+	}
+	return ids
+}
+
+// fillAttachments loads the attachments of published posts.
+func (db *DB) fillAttachments(posts models.Posts) int {
+	if len(posts) == 0 {
+		return OK
+	}
+	ids := make([]int64, 0, len(posts))
+	byId := make(map[int64]*models.Post, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+		byId[post.ID] = post
+	}
+	rows, err := db.sql().Query(getPostsAttachments, ids)
+	if err != nil {
+		db.logError("getPostsAttachments", err)
+		return DBError
+	}
+	defer rows.Close()
+	for rows.Next() {
+		attachment := &models.Attachment{}
+		created := time.Time{}
+		err := rows.Scan(&attachment.ID, &attachment.Owner, &attachment.Name, &attachment.ContentType,
+			&attachment.Size, &created, &attachment.Post)
+		if err != nil {
+			db.logError("getPostsAttachments", err)
+			return DBError
+		}
+		attachment.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		post := byId[attachment.Post]
+		post.Attachments = append(post.Attachments, attachment)
+	}
+	return OK
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+const (
+	createCredentials = "INSERT INTO user_credentials (user_nick, password_hash) VALUES($1, $2)"
+	getCredentials    = "SELECT u.nick_name, c.password_hash FROM users u " +
+		"JOIN user_credentials c ON c.user_nick = u.nick_name WHERE u.nick_name = $1"
+	createToken = "INSERT INTO auth_tokens (token_hash, user_nick, kind, name, expires) " +
+		"VALUES($1, $2, $3, $4, $5) RETURNING id, created"
+	getTokenUser = "SELECT user_nick FROM auth_tokens " +
+		"WHERE token_hash = $1 AND (expires IS NULL OR expires > now())"
+	getUserTokens = "SELECT id, kind, name, created, expires FROM auth_tokens " +
+		"WHERE user_nick = $1 AND (expires IS NULL OR expires > now()) ORDER BY id"
+	deleteToken         = "DELETE FROM auth_tokens WHERE id = $1 AND user_nick = $2"
+	deleteTokenByHash   = "DELETE FROM auth_tokens WHERE token_hash = $1"
+	getAdminCredentials = "SELECT user_nick, password_hash FROM admin_credentials WHERE lower(user_nick) = lower($1)"
+	hasAdminCredentials = "SELECT EXISTS(SELECT 1 FROM admin_credentials WHERE lower(user_nick) = lower($1))"
+	setAdminCredentials = "INSERT INTO admin_credentials (user_nick, password_hash) VALUES($1, $2) " +
+		"ON CONFLICT (user_nick) DO UPDATE SET password_hash = $2"
+	deleteUserTokens = "DELETE FROM auth_tokens WHERE lower(user_nick) = lower($1)"
+)
+
+func (db *DB) GetCredentials(userNick string) (_ string, _ string, status int) {
+	defer db.track("GetCredentials", &status)()
+	nick := ""
+	passwordHash := ""
+	err := db.sql().QueryRow(getCredentials, userNick).Scan(&nick, &passwordHash)
+	if err == pgx.ErrNoRows {
+		return "", "", EmptyResult
+	}
+	if err != nil {
+		db.logError("getCredentials", err)
+		return "", "", DBError
+	}
+	return nick, passwordHash, OK
+}
+
+func (db *DB) CreateToken(userNick string, kind string, name string,
+	tokenHash string, expires time.Time) (_ models.Token, status int) {
+	defer db.track("CreateToken", &status)()
+	nullExpires := pgx.NullTime{Time: expires, Valid: !expires.IsZero()}
+	token := models.Token{Kind: kind, Name: name, Nickname: userNick}
+	created := time.Time{}
+	err := db.sql().QueryRow(createToken, tokenHash, userNick, kind, name, nullExpires).Scan(&token.ID, &created)
+	if err != nil {
+		db.logError("createToken", err)
+		return models.Token{}, DBError
+	}
+	token.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+	if nullExpires.Valid {
+		token.Expires = expires.Format("2006-01-02T15:04:05.999999999Z07:00")
+	}
+	return token, OK
+}
+
+func (db *DB) GetTokenUser(tokenHash string) (_ string, status int) {
+	defer db.track("GetTokenUser", &status)()
+	nick := ""
+	err := db.sql().QueryRow(getTokenUser, tokenHash).Scan(&nick)
+	if err == pgx.ErrNoRows {
+		return "", EmptyResult
+	}
+	if err != nil {
+		db.logError("getTokenUser", err)
+		return "", DBError
+	}
+	return nick, OK
+}
+
+func (db *DB) GetUserTokens(userNick string) (_ models.Tokens, status int) {
+	defer db.track("GetUserTokens", &status)()
+	rows, err := db.sql().Query(getUserTokens, userNick)
+	if err != nil {
+		db.logError("getUserTokens", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	tokens := models.Tokens{}
+	for rows.Next() {
+		token := new(models.Token)
+		created := time.Time{}
+		expires := pgx.NullTime{}
+		err := rows.Scan(&token.ID, &token.Kind, &token.Name, &created, &expires)
+		if err != nil {
+			db.logError("getUserTokens", err)
+			return models.Tokens{}, DBError
+		}
+		token.Nickname = userNick
+		token.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		if expires.Valid {
+			token.Expires = expires.Time.Format("2006-01-02T15:04:05.999999999Z07:00")
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, OK
+}
+
+func (db *DB) DeleteToken(userNick string, tokenId string) (status int) {
+	defer db.track("DeleteToken", &status)()
+	res, err := db.sql().Exec(deleteToken, tokenId, userNick)
+	if err != nil {
+		db.logError("deleteToken", err)
+		return DBError
+	}
+	if res.RowsAffected() == 0 {
+		return EmptyResult
+	}
+	return OK
+}
+
+func (db *DB) DeleteTokenByHash(tokenHash string) (status int) {
+	defer db.track("DeleteTokenByHash", &status)()
+	_, err := db.sql().Exec(deleteTokenByHash, tokenHash)
+	if err != nil {
+		db.logError("deleteTokenByHash", err)
+		return DBError
+	}
+	return OK
+}
+
+// GetAdminCredentials is GetCredentials for the accounts of site admins, which
+// are kept apart from the users and survive a clear.
+func (db *DB) GetAdminCredentials(userNick string) (_ string, _ string, status int) {
+	defer db.track("GetAdminCredentials", &status)()
+	nick := ""
+	passwordHash := ""
+	err := db.sql().QueryRow(getAdminCredentials, userNick).Scan(&nick, &passwordHash)
+	if err == pgx.ErrNoRows {
+		return "", "", EmptyResult
+	}
+	if err != nil {
+		db.logError("getAdminCredentials", err)
+		return "", "", DBError
+	}
+	return nick, passwordHash, OK
+}
+
+func (db *DB) HasAdminCredentials(userNick string) (_ bool, status int) {
+	defer db.track("HasAdminCredentials", &status)()
+	exists := false
+	err := db.sql().QueryRow(hasAdminCredentials, userNick).Scan(&exists)
+	if err != nil {
+		db.logError("hasAdminCredentials", err)
+		return false, DBError
+	}
+	return exists, OK
+}
+
+// SetAdminCredentials sets the password of the admin account userNick and
+// revokes every token issued to the nickname before.
+func (db *DB) SetAdminCredentials(userNick string, passwordHash string) (status int) {
+	defer db.track("SetAdminCredentials", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return DBError
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(setAdminCredentials, userNick, passwordHash)
+	if err != nil {
+		db.logError("setAdminCredentials", err)
+		return DBError
+	}
+	_, err = tx.Exec(deleteUserTokens, userNick)
+	if err != nil {
+		db.logError("deleteUserTokens", err)
+		return DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return DBError
+	}
+	return OK
+}
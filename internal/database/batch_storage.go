@@ -0,0 +1,294 @@
+package database
+
+import (
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+// Lookups of many rows by key in one statement, for callers that gather keys
+// first, like the GraphQL loaders. Keys with no row are left out.
+const (
+	getUsersByNicks  = "SELECT nick_name, about, email, full_name FROM users WHERE nick_name = ANY($1)"
+	getForumsBySlugs = "SELECT posts_count, slug, threads_count, title, user_nick FROM forum WHERE slug = ANY($1)"
+	getThreadsByIds  = threadColumns + "WHERE id = ANY($1)"
+	postColumns      = "SELECT id, author, created, forum, message, parent, thread, is_edited, message_html FROM posts "
+	getPostsByIds    = postColumns + "WHERE id = ANY($1)"
+	getThreadsVotes  = "SELECT thread, author, is_like FROM votes WHERE thread = ANY($1) ORDER BY thread, author"
+)
+
+// Pages of many lists in one statement: every list is numbered by a window
+// function and cut at the limit, so each gets the page a separate call would.
+// The %[1]s verbs take the sort direction and %[2]s the since condition.
+const (
+	postColumnList    = "id, author, created, forum, message, parent, thread, is_edited, message_html"
+	getPostsByParents = "SELECT " + postColumnList + " FROM (SELECT " + postColumnList + ", " +
+		"row_number() OVER (PARTITION BY parent ORDER BY id) AS n FROM posts WHERE parent = ANY($1)) AS p " +
+		"WHERE n <= $2 ORDER BY id"
+	getForumsThreads = "SELECT id, author, created, forum, message, slug, title, votes, message_html FROM (" +
+		"SELECT id, author, created, forum, message, slug, title, votes, message_html, " +
+		"row_number() OVER (PARTITION BY forum ORDER BY created %[1]s) AS n " +
+		"FROM threads WHERE forum = ANY($1) %[2]s) AS t WHERE n <= $2 ORDER BY forum, created %[1]s"
+	forumsThreadsSince = "AND created %s $3"
+	getForumsUsers     = "SELECT forum, nick_name, about, email, full_name FROM (" +
+		"SELECT f_u.forum, u.nick_name, u.about, u.email, u.full_name, " +
+		"row_number() OVER (PARTITION BY f_u.forum ORDER BY u.nick_name %[1]s) AS n " +
+		"FROM forum_to_users f_u JOIN users u ON (u.nick_name = f_u.user_nick) " +
+		"WHERE f_u.forum = ANY($1) %[2]s) AS f WHERE n <= $2 ORDER BY forum, nick_name %[1]s"
+	forumsUsersSince    = "AND u.nick_name %s $3"
+	getThreadsPostsFlat = "SELECT " + postColumnList + " FROM (SELECT " + postColumnList + ", " +
+		"row_number() OVER (PARTITION BY thread ORDER BY id %[1]s) AS n " +
+		"FROM posts WHERE thread = ANY($1) %[2]s) AS p WHERE n <= $2 ORDER BY thread, id %[1]s"
+	threadsPostsFlatSince = "AND id %s $3"
+	getThreadsPostsTree   = "SELECT " + postColumnList + " FROM (SELECT " + postColumnList + ", path, " +
+		"row_number() OVER (PARTITION BY thread ORDER BY path %[1]s) AS n " +
+		"FROM posts WHERE thread = ANY($1) %[2]s) AS p WHERE n <= $2 ORDER BY thread, path %[1]s"
+	threadsPostsTreeSince     = "AND path %s (SELECT path FROM posts WHERE id = $3)"
+	getThreadsPostsParentTree = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, " +
+		"p.is_edited, p.message_html FROM posts p JOIN (SELECT id FROM (SELECT id, " +
+		"row_number() OVER (PARTITION BY thread ORDER BY id %[1]s) AS n " +
+		"FROM posts WHERE parent = 0 AND thread = ANY($1) %[2]s) AS r WHERE n <= $2) AS sq ON sq.id = p.path[1] " +
+		"ORDER BY p.thread, p.path[1] %[1]s, p.path"
+	threadsPostsParentTreeSince = "AND id %s (SELECT path[1] FROM posts WHERE id = $3)"
+)
+
+func (db *DB) GetUsersByNicknames(nicks []string) (_ models.Users, status int) {
+	defer db.track("GetUsersByNicknames", &status)()
+	rows, err := db.sql().Query(getUsersByNicks, nicks)
+	if err != nil {
+		db.logError("getUsersByNicks", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	users := models.Users{}
+	for rows.Next() {
+		user := new(models.User)
+		err = rows.Scan(&user.Nickname, &user.About, &user.Email, &user.Fullname)
+		if err != nil {
+			db.logError("getUsersByNicks", err)
+			return nil, DBError
+		}
+		users = append(users, user)
+	}
+	return users, OK
+}
+
+func (db *DB) GetForumsBySlugs(slugs []string) (_ []*models.Forum, status int) {
+	defer db.track("GetForumsBySlugs", &status)()
+	rows, err := db.sql().Query(getForumsBySlugs, slugs)
+	if err != nil {
+		db.logError("getForumsBySlugs", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	forums := make([]*models.Forum, 0)
+	for rows.Next() {
+		forum := new(models.Forum)
+		err = rows.Scan(&forum.Posts, &forum.Slug, &forum.Threads, &forum.Title, &forum.User)
+		if err != nil {
+			db.logError("getForumsBySlugs", err)
+			return nil, DBError
+		}
+		forums = append(forums, forum)
+	}
+	return forums, OK
+}
+
+func (db *DB) GetThreadsByIds(ids []int32) (_ models.Threads, status int) {
+	defer db.track("GetThreadsByIds", &status)()
+	rows, err := db.sql().Query(getThreadsByIds, ids)
+	if err != nil {
+		db.logError("getThreadsByIds", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	threads := models.Threads{}
+	for rows.Next() {
+		thread := new(models.Thread)
+		slug := pgx.NullString{}
+		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
+		err = rows.Scan(&thread.ID, &thread.Author, &timeStamp, &thread.Forum,
+			&thread.Message, &slug, &thread.Title, &thread.Votes, &messageHtml)
+		if err != nil {
+			db.logError("getThreadsByIds", err)
+			return nil, DBError
+		}
+		thread.Slug = slug.String
+		thread.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		thread.MessageHTML = renderedMessage(messageHtml, thread.Message)
+		threads = append(threads, thread)
+	}
+	return threads, OK
+}
+
+func (db *DB) GetPostsByIds(ids []int64) (_ models.Posts, status int) {
+	defer db.track("GetPostsByIds", &status)()
+	return db.queryPosts("getPostsByIds", getPostsByIds, ids)
+}
+
+// GetPostsByParents returns the first limit direct answers to each of the
+// posts, oldest first.
+func (db *DB) GetPostsByParents(parents []int64, limit string) (_ models.Posts, status int) {
+	defer db.track("GetPostsByParents", &status)()
+	return db.queryPosts("getPostsByParents", getPostsByParents, parents, limit)
+}
+
+// GetThreadsPosts returns a page of the posts of each of the threads, as
+// GetPostsById would for each thread alone, without attachments.
+func (db *DB) GetThreadsPosts(threads []int32, limit string, since string,
+	sort string, desc bool) (_ map[int32]models.Posts, status int) {
+	defer db.track("GetThreadsPosts", &status)()
+	name, query, sinceCondition := "", "", ""
+	switch sort {
+	case "flat":
+		name, query, sinceCondition = "getThreadsPostsFlat", getThreadsPostsFlat, threadsPostsFlatSince
+	case "tree":
+		name, query, sinceCondition = "getThreadsPostsTree", getThreadsPostsTree, threadsPostsTreeSince
+	case "parent_tree":
+		name, query, sinceCondition = "getThreadsPostsParentTree", getThreadsPostsParentTree,
+			threadsPostsParentTreeSince
+	default:
+		return nil, Invalid
+	}
+	query, args := pageQuery(query, sinceCondition, ">", "<", threads, limit, since, desc)
+	posts, stat := db.queryPosts(name, query, args...)
+	if stat != OK {
+		return nil, stat
+	}
+	byThread := map[int32]models.Posts{}
+	for _, post := range posts {
+		byThread[post.Thread] = append(byThread[post.Thread], post)
+	}
+	return byThread, OK
+}
+
+// GetForumsThreads returns a page of the threads of each of the forums, as
+// GetForumThreads would for each forum alone; since is a creation time.
+func (db *DB) GetForumsThreads(forums []string, limit string, since string,
+	desc bool) (_ map[string]models.Threads, status int) {
+	defer db.track("GetForumsThreads", &status)()
+	query, args := pageQuery(getForumsThreads, forumsThreadsSince, ">=", "<=", forums, limit, since, desc)
+	rows, err := db.sql().Query(query, args...)
+	if err != nil {
+		db.logError("getForumsThreads", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	byForum := map[string]models.Threads{}
+	for rows.Next() {
+		thread := new(models.Thread)
+		slug := pgx.NullString{}
+		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
+		err = rows.Scan(&thread.ID, &thread.Author, &timeStamp, &thread.Forum,
+			&thread.Message, &slug, &thread.Title, &thread.Votes, &messageHtml)
+		if err != nil {
+			db.logError("getForumsThreads", err)
+			return nil, DBError
+		}
+		thread.Slug = slug.String
+		thread.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		thread.MessageHTML = renderedMessage(messageHtml, thread.Message)
+		byForum[thread.Forum] = append(byForum[thread.Forum], thread)
+	}
+	return byForum, OK
+}
+
+// GetForumsUsers returns a page of the users of each of the forums, as
+// GetForumUsers would for each forum alone; since is a nickname.
+func (db *DB) GetForumsUsers(forums []string, limit string, since string,
+	desc bool) (_ map[string]models.Users, status int) {
+	defer db.track("GetForumsUsers", &status)()
+	query, args := pageQuery(getForumsUsers, forumsUsersSince, ">", "<", forums, limit, since, desc)
+	rows, err := db.sql().Query(query, args...)
+	if err != nil {
+		db.logError("getForumsUsers", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	byForum := map[string]models.Users{}
+	for rows.Next() {
+		forum := ""
+		user := new(models.User)
+		err = rows.Scan(&forum, &user.Nickname, &user.About, &user.Email, &user.Fullname)
+		if err != nil {
+			db.logError("getForumsUsers", err)
+			return nil, DBError
+		}
+		byForum[forum] = append(byForum[forum], user)
+	}
+	return byForum, OK
+}
+
+// pageQuery fills the direction and since condition of a windowed page query
+// and returns it with its arguments. after and before compare with since in
+// ascending and descending order.
+func pageQuery(query string, sinceCondition string, after string, before string,
+	keys interface{}, limit string, since string, desc bool) (string, []interface{}) {
+	direction, compare := "ASC", after
+	if desc {
+		direction, compare = "DESC", before
+	}
+	args := []interface{}{keys, limit}
+	condition := ""
+	if since != "" {
+		condition = fmt.Sprintf(sinceCondition, compare)
+		args = append(args, since)
+	}
+	return fmt.Sprintf(query, direction, condition), args
+}
+
+func (db *DB) queryPosts(name string, query string, args ...interface{}) (models.Posts, int) {
+	rows, err := db.sql().Query(query, args...)
+	if err != nil {
+		db.logError(name, err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	posts := models.Posts{}
+	for rows.Next() {
+		post := new(models.Post)
+		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
+		err = rows.Scan(&post.ID, &post.Author, &timeStamp, &post.Forum, &post.Message,
+			&post.Parent, &post.Thread, &post.IsEdited, &messageHtml)
+		if err != nil {
+			db.logError(name, err)
+			return nil, DBError
+		}
+		post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		post.MessageHTML = renderedMessage(messageHtml, post.Message)
+		posts = append(posts, post)
+	}
+	return posts, OK
+}
+
+// GetThreadsVotes returns the votes cast in each of the threads, by voter.
+func (db *DB) GetThreadsVotes(threads []int32) (_ map[int32][]*models.Vote, status int) {
+	defer db.track("GetThreadsVotes", &status)()
+	rows, err := db.sql().Query(getThreadsVotes, threads)
+	if err != nil {
+		db.logError("getThreadsVotes", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	votes := map[int32][]*models.Vote{}
+	for rows.Next() {
+		thread := int32(0)
+		isLike := false
+		vote := new(models.Vote)
+		err = rows.Scan(&thread, &vote.Nickname, &isLike)
+		if err != nil {
+			db.logError("getThreadsVotes", err)
+			return nil, DBError
+		}
+		vote.Voice = -1
+		if isLike == LIKE {
+			vote.Voice = 1
+		}
+		votes[thread] = append(votes[thread], vote)
+	}
+	return votes, OK
+}
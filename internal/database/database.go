@@ -3,6 +3,8 @@ package database
 import (
 	_ "github.com/lib/pq"
 	"gopkg.in/jackc/pgx.v2"
+	"github.com/sergeychur/technopark_db/internal/tracing"
+	"log/slog"
 	"time"
 )
 
@@ -11,6 +13,8 @@ const (
 	DBError     = 1
 	EmptyResult = 2
 	Conflict    = 3
+	Forbidden   = 4
+	Invalid     = 5
 )
 
 
@@ -21,6 +25,11 @@ type DB struct {
 	databaseName string
 	host         string
 	port         uint16
+	log          *slog.Logger
+	maxConns     int
+	acquireWait  time.Duration
+	metrics      *storageMetrics
+	span         *tracing.Span
 }
 
 func NewDB(user string, password string, dataBaseName string,
@@ -31,9 +40,18 @@ func NewDB(user string, password string, dataBaseName string,
 	db.password = password
 	db.host = host
 	db.port = port
+	db.maxConns = 80
+	db.acquireWait = 7 * time.Second
 	return db
 }
 
+// SetPoolLimits sizes the pool Start opens and bounds how long a storage call
+// waits for a free connection.
+func (db *DB) SetPoolLimits(maxConnections int, acquireTimeout time.Duration) {
+	db.maxConns = maxConnections
+	db.acquireWait = acquireTimeout
+}
+
 func (db *DB) Start() error {
 	conf := pgx.ConnConfig{
 		Host:     db.host,
@@ -44,14 +62,19 @@ func (db *DB) Start() error {
 	}
 	poolConf := pgx.ConnPoolConfig{
 		ConnConfig:     conf,
-		MaxConnections: 80,
-		AcquireTimeout: time.Duration(7 * time.Second),
+		MaxConnections: db.maxConns,
+		AcquireTimeout: db.acquireWait,
 	}
 	dataBase, err := pgx.NewConnPool(poolConf)
 	if err != nil {
 		return err
 	}
 	db.db = dataBase
+	err = db.migrate()
+	if err != nil {
+		db.db.Close()
+		return err
+	}
 	return nil
 }
 
@@ -59,7 +82,4 @@ func (db *DB) Close() {
 	db.db.Close()
 }
 
-func (db *DB) StartTransaction() (*pgx.Tx, error) {
-	return db.db.Begin()
-}
 
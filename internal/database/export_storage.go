@@ -0,0 +1,159 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/archive"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+const (
+	exportForum = "SELECT slug, title, user_nick, posts_count, threads_count FROM forum WHERE slug = $1"
+	exportUsers = "SELECT nick_name, about, email, full_name FROM users WHERE nick_name IN (" +
+		"SELECT user_nick FROM forum WHERE slug = $1 " +
+		"UNION SELECT user_nick FROM forum_to_users WHERE forum = $1 " +
+		"UNION SELECT author FROM threads WHERE forum = $1 " +
+		"UNION SELECT v.author FROM votes v JOIN threads t ON (t.id = v.thread) WHERE t.forum = $1) " +
+		"ORDER BY nick_name"
+	exportThreads = "SELECT id, slug, title, author, created, message, votes FROM threads WHERE forum = $1 ORDER BY id"
+	exportPosts   = "SELECT id, parent, thread, author, created, message, is_edited FROM posts " +
+		"WHERE forum = $1 ORDER BY id"
+	exportVotes = "SELECT v.thread, v.author, v.is_like FROM votes v JOIN threads t ON (t.id = v.thread) " +
+		"WHERE t.forum = $1 ORDER BY v.thread, v.author"
+)
+
+// ExportForum passes the archive records of the forum to emit, in archive
+// order, streaming rows from a single read-only repeatable read snapshot.
+// Nothing is emitted for a missing forum. An error from emit stops the export.
+func (db *DB) ExportForum(slug string, emit func(kind string, data interface{}) error) (status int) {
+	defer db.track("ExportForum", &status)()
+	tx, err := db.startTransactionIso(pgx.RepeatableRead)
+	if err != nil {
+		db.logError("begin", err)
+		return DBError
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("SET TRANSACTION READ ONLY")
+	if err != nil {
+		db.logError("setReadOnly", err)
+		return DBError
+	}
+	forum := archive.Forum{}
+	err = tx.QueryRow(exportForum, slug).Scan(&forum.Slug, &forum.Title, &forum.User, &forum.Posts, &forum.Threads)
+	if err == pgx.ErrNoRows {
+		return EmptyResult
+	}
+	if err != nil {
+		db.logError("exportForum", err)
+		return DBError
+	}
+	err = emit(archive.TypeForum, forum)
+	if err != nil {
+		return DBError
+	}
+	steps := []func(*Tx, string, func(string, interface{}) error) error{
+		exportForumUsers,
+		exportForumThreads,
+		exportForumPosts,
+		exportForumVotes,
+	}
+	for _, step := range steps {
+		err = step(tx, forum.Slug, emit)
+		if err != nil {
+			db.logError("exportForum", err)
+			return DBError
+		}
+	}
+	return OK
+}
+
+func exportForumUsers(tx *Tx, slug string, emit func(string, interface{}) error) error {
+	rows, err := tx.Query(exportUsers, slug)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := archive.User{}
+		err := rows.Scan(&user.Nickname, &user.About, &user.Email, &user.Fullname)
+		if err != nil {
+			return err
+		}
+		err = emit(archive.TypeUser, user)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func exportForumThreads(tx *Tx, slug string, emit func(string, interface{}) error) error {
+	rows, err := tx.Query(exportThreads, slug)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		thread := archive.Thread{}
+		threadSlug := pgx.NullString{}
+		created := time.Time{}
+		err := rows.Scan(&thread.ID, &threadSlug, &thread.Title, &thread.Author, &created,
+			&thread.Message, &thread.Votes)
+		if err != nil {
+			return err
+		}
+		thread.Slug = threadSlug.String
+		thread.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		err = emit(archive.TypeThread, thread)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func exportForumPosts(tx *Tx, slug string, emit func(string, interface{}) error) error {
+	rows, err := tx.Query(exportPosts, slug)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		post := archive.Post{}
+		created := time.Time{}
+		err := rows.Scan(&post.ID, &post.Parent, &post.Thread, &post.Author, &created,
+			&post.Message, &post.IsEdited)
+		if err != nil {
+			return err
+		}
+		post.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		err = emit(archive.TypePost, post)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func exportForumVotes(tx *Tx, slug string, emit func(string, interface{}) error) error {
+	rows, err := tx.Query(exportVotes, slug)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		vote := archive.Vote{Voice: -1}
+		isLike := false
+		err := rows.Scan(&vote.Thread, &vote.Nickname, &isLike)
+		if err != nil {
+			return err
+		}
+		if isLike == LIKE {
+			vote.Voice = 1
+		}
+		err = emit(archive.TypeVote, vote)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
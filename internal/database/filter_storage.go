@@ -0,0 +1,170 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+const (
+	getFilterRules = "SELECT id, kind, action, pattern, value, created_by, created FROM filter_rules " +
+		"WHERE forum = $1 ORDER BY id"
+	createFilterRule = "INSERT INTO filter_rules (forum, kind, action, pattern, value, created_by) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created"
+	deleteFilterRule   = "DELETE FROM filter_rules WHERE forum = $1 AND id = $2"
+	getUserCreated     = "SELECT created FROM users WHERE nick_name = $1"
+	hasRecentDuplicate = "SELECT EXISTS (SELECT 1 FROM posts WHERE author = $1 AND message = $2 AND created > $3) " +
+		"OR EXISTS (SELECT 1 FROM pending_posts WHERE author = $1 AND message = $2 AND created > $3)"
+	lockAuthors = "SELECT pg_advisory_xact_lock(hashtext(a)) FROM " +
+		"(SELECT DISTINCT lower(a) AS a FROM unnest($1::text[]) AS a ORDER BY 1) AS sorted"
+)
+
+func (db *DB) GetFilterRules(forumId string) (_ models.FilterRules, status int) {
+	defer db.track("GetFilterRules", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return nil, stat
+	}
+	rules, err := readFilterRules(db.sql(), forumId)
+	if err != nil {
+		db.logError("getFilterRules", err)
+		return nil, DBError
+	}
+	return rules, OK
+}
+
+// GetFilterRules is the GetFilterRules storage call inside tx, for a forum id
+// as stored.
+func GetFilterRules(tx *Tx, forumId string) (models.FilterRules, int) {
+	rules, err := readFilterRules(tx.statements(), forumId)
+	if err != nil {
+		logStorageError("getFilterRules", err)
+		return nil, DBError
+	}
+	return rules, OK
+}
+
+func readFilterRules(q statements, forumId string) (models.FilterRules, error) {
+	rows, err := q.Query(getFilterRules, forumId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := models.FilterRules{}
+	for rows.Next() {
+		rule := &models.FilterRule{Forum: forumId}
+		created := time.Time{}
+		err := rows.Scan(&rule.ID, &rule.Kind, &rule.Action, &rule.Pattern, &rule.Value, &rule.CreatedBy, &created)
+		if err != nil {
+			return nil, err
+		}
+		rule.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (db *DB) CreateFilterRule(forumId string, rule models.FilterRule) (_ models.FilterRule, status int) {
+	defer db.track("CreateFilterRule", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return models.FilterRule{}, stat
+	}
+	rule.Forum = forumId
+	created := time.Time{}
+	err := db.sql().QueryRow(createFilterRule, forumId, rule.Kind, rule.Action, rule.Pattern,
+		rule.Value, rule.CreatedBy).Scan(&rule.ID, &created)
+	if err != nil {
+		db.logError("createFilterRule", err)
+		return models.FilterRule{}, DBError
+	}
+	rule.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+	return rule, OK
+}
+
+func (db *DB) DeleteFilterRule(forumId string, id int64) (status int) {
+	defer db.track("DeleteFilterRule", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return stat
+	}
+	res, err := db.sql().Exec(deleteFilterRule, forumId, id)
+	if err != nil {
+		db.logError("deleteFilterRule", err)
+		return DBError
+	}
+	if res.RowsAffected() == 0 {
+		return EmptyResult
+	}
+	return OK
+}
+
+func (db *DB) GetUserCreated(userNick string) (_ time.Time, status int) {
+	defer db.track("GetUserCreated", &status)()
+	created, err := readUserCreated(db.sql(), userNick)
+	if err == pgx.ErrNoRows {
+		return created, EmptyResult
+	}
+	if err != nil {
+		db.logError("getUserCreated", err)
+		return created, DBError
+	}
+	return created, OK
+}
+
+// GetUserCreated is the GetUserCreated storage call inside tx.
+func GetUserCreated(tx *Tx, userNick string) (time.Time, int) {
+	created, err := readUserCreated(tx.statements(), userNick)
+	if err == pgx.ErrNoRows {
+		return created, EmptyResult
+	}
+	if err != nil {
+		logStorageError("getUserCreated", err)
+		return created, DBError
+	}
+	return created, OK
+}
+
+func readUserCreated(q statements, userNick string) (time.Time, error) {
+	created := time.Time{}
+	err := q.QueryRow(getUserCreated, userNick).Scan(&created)
+	return created, err
+}
+
+// HasRecentDuplicate reports whether the author posted the same message,
+// published or held for moderation, after since.
+func (db *DB) HasRecentDuplicate(userNick string, message string, since time.Time) (_ bool, status int) {
+	defer db.track("HasRecentDuplicate", &status)()
+	ifDuplicate := false
+	err := db.sql().QueryRow(hasRecentDuplicate, userNick, message, since).Scan(&ifDuplicate)
+	if err != nil {
+		db.logError("hasRecentDuplicate", err)
+		return false, DBError
+	}
+	return ifDuplicate, OK
+}
+
+// LockAuthors holds the authors until tx ends, so that concurrent batches of
+// the same authors run their duplicate checks one after another and each sees
+// the posts of the one before. The locks are taken in one order to keep
+// batches from deadlocking.
+func LockAuthors(tx *Tx, userNicks []string) int {
+	_, err := tx.Exec(lockAuthors, userNicks)
+	if err != nil {
+		logStorageError("lockAuthors", err)
+		return DBError
+	}
+	return OK
+}
+
+// HasRecentDuplicate is the HasRecentDuplicate storage call inside tx, which
+// also sees the posts tx has created.
+func HasRecentDuplicate(tx *Tx, userNick string, message string, since time.Time) (bool, int) {
+	ifDuplicate := false
+	err := tx.QueryRow(hasRecentDuplicate, userNick, message, since).Scan(&ifDuplicate)
+	if err != nil {
+		logStorageError("hasRecentDuplicate", err)
+		return false, DBError
+	}
+	return ifDuplicate, OK
+}
@@ -3,7 +3,6 @@ package database
 import (
 	"github.com/sergeychur/technopark_db/internal/models"
 	"gopkg.in/jackc/pgx.v2"
-	"log"
 )
 
 const (
@@ -14,9 +13,11 @@ const (
 	CreateForum = "INSERT INTO forum (slug, title, user_nick) VALUES($1, $2, $3)"
 )
 
-func (db *DB) CreateForum(forum models.Forum) (models.Forum, int) {
+func (db *DB) CreateForum(forum models.Forum) (_ models.Forum, status int) {
+	defer db.track("CreateForum", &status)()
 	tx, err := db.StartTransaction()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Forum{}, DBError
 	}
 	defer tx.Rollback()
@@ -32,7 +33,7 @@ func (db *DB) CreateForum(forum models.Forum) (models.Forum, int) {
 	if ifExistsUser {
 		ifExistsForum, err = IsForumExist(tx, forum.Slug)
 		if err != nil {
-			log.Println(err.Error())
+			db.logError("isForumExist", err)
 			return forum, DBError
 		}
 	}
@@ -50,12 +51,13 @@ func (db *DB) CreateForum(forum models.Forum) (models.Forum, int) {
 		_, err := tx.Exec(CreateForum, forum.Slug, forum.Title, nick)
 
 		if err != nil {
-			log.Println(err)
+			db.logError("createForum", err)
 			return forum, DBError
 		}
 		err = tx.Commit()
 		forum, resVal := db.GetForum(forum.Slug)
 		if err != nil {
+			db.logError("commit", err)
 			return forum, DBError
 		}
 		return forum, resVal
@@ -63,15 +65,16 @@ func (db *DB) CreateForum(forum models.Forum) (models.Forum, int) {
 	return models.Forum{}, EmptyResult
 }
 
-func (db *DB) GetForum(ForumId string) (models.Forum, int) {
-	row := db.db.QueryRow(GetForum, ForumId)
+func (db *DB) GetForum(ForumId string) (_ models.Forum, status int) {
+	defer db.track("GetForum", &status)()
+	row := db.sql().QueryRow(GetForum, ForumId)
 	forum := models.Forum{}
 	err := row.Scan(&forum.Posts, &forum.Slug, &forum.Threads, &forum.Title, &forum.User)
 	if err == pgx.ErrNoRows {
 		return forum, EmptyResult
 	}
 	if err != nil {
-		log.Println(err.Error())
+		db.logError("getForum", err)
 		return forum, DBError
 	}
 	return forum, OK
@@ -0,0 +1,26 @@
+package database
+
+const (
+	getSchemaVersion = "SELECT COALESCE(max(version), 0) FROM schema_migrations"
+)
+
+// GetSchemaVersion returns the last migration applied to the database. It
+// fails with DBError before Start and whenever the database cannot be reached.
+func (db *DB) GetSchemaVersion() (_ int, status int) {
+	defer db.track("GetSchemaVersion", &status)()
+	if db.db == nil {
+		return 0, DBError
+	}
+	version := 0
+	err := db.sql().QueryRow(getSchemaVersion).Scan(&version)
+	if err != nil {
+		db.logError("getSchemaVersion", err)
+		return 0, DBError
+	}
+	return version, OK
+}
+
+// LatestSchemaVersion is the version Start migrates the database to.
+func (db *DB) LatestSchemaVersion() int {
+	return len(migrations)
+}
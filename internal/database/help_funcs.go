@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"github.com/sergeychur/technopark_db/internal/markdown"
 	"gopkg.in/jackc/pgx.v2"
 	"strconv"
 )
@@ -15,7 +16,7 @@ const (
 	getForumId           = "SELECT slug FROM forum WHERE slug = $1"
 )
 
-func IsExist(tx *pgx.Tx, pk string, pkName string, table string) (bool, error) {
+func IsExist(tx *Tx, pk string, pkName string, table string) (bool, error) {
 	ifExists := false
 	row := tx.QueryRow(fmt.Sprintf(Check, table, pkName), pk)
 	err := row.Scan(&ifExists)
@@ -28,27 +29,27 @@ func IsExist(tx *pgx.Tx, pk string, pkName string, table string) (bool, error) {
 	return ifExists, nil
 }
 
-func IsUserExist(tx *pgx.Tx, userNick string) (bool, error) {
+func IsUserExist(tx *Tx, userNick string) (bool, error) {
 	return IsExist(tx, userNick, "nick_name", "users")
 }
 
-func IsForumExist(tx *pgx.Tx, slug string) (bool, error) {
+func IsForumExist(tx *Tx, slug string) (bool, error) {
 	return IsExist(tx, slug, "slug", "forum")
 }
 
-func IsThreadExistBySlug(tx *pgx.Tx, slug string) (bool, error) {
+func IsThreadExistBySlug(tx *Tx, slug string) (bool, error) {
 	return IsExist(tx, slug, "slug", "threads")
 }
 
-func IsThreadExistById(tx *pgx.Tx, id string) (bool, error) {
+func IsThreadExistById(tx *Tx, id string) (bool, error) {
 	return IsExist(tx, id, "id", "threads")
 }
 
-func IsPostExist(tx *pgx.Tx, id string) (bool, error) {
+func IsPostExist(tx *Tx, id string) (bool, error) {
 	return IsExist(tx, id, "id", "posts")
 }
 
-func GetThreadForumBySlug(tx *pgx.Tx, slug string) (string, int, int) {
+func GetThreadForumBySlug(tx *Tx, slug string) (string, int, int) {
 	ForumId := ""
 	threadId := 0
 	row := tx.QueryRow(getThreadForumBySlug, slug)
@@ -62,7 +63,7 @@ func GetThreadForumBySlug(tx *pgx.Tx, slug string) (string, int, int) {
 	return ForumId, threadId, OK
 }
 
-func GetThreadForumById(tx *pgx.Tx, id string) (string, int) {
+func GetThreadForumById(tx *Tx, id string) (string, int) {
 	ForumId := ""
 	row := tx.QueryRow(getThreadForumById, id)
 	err := row.Scan(&ForumId)
@@ -75,7 +76,7 @@ func GetThreadForumById(tx *pgx.Tx, id string) (string, int) {
 	return ForumId, OK
 }
 
-func GetThreadIdBySlug(tx *pgx.Tx, slug string) (string, int) {
+func GetThreadIdBySlug(tx *Tx, slug string) (string, int) {
 	id := 0
 	row := tx.QueryRow(getThreadIdBySlug, slug)
 	err := row.Scan(&id)
@@ -88,7 +89,7 @@ func GetThreadIdBySlug(tx *pgx.Tx, slug string) (string, int) {
 	return strconv.Itoa(id), OK
 }
 
-func GetUserNick(tx *pgx.Tx, nick string) (string, int) {
+func GetUserNick(tx *Tx, nick string) (string, int) {
 	nickName := ""
 	row := tx.QueryRow(getUserNick, nick)
 	err := row.Scan(&nickName)
@@ -101,7 +102,7 @@ func GetUserNick(tx *pgx.Tx, nick string) (string, int) {
 	return nickName, OK
 }
 
-func GetForumId(tx *pgx.Tx, forumId string) (string, int) {
+func GetForumId(tx *Tx, forumId string) (string, int) {
 	retForumId := ""
 	row := tx.QueryRow(getForumId, forumId)
 	err := row.Scan(&retForumId)
@@ -113,3 +114,12 @@ func GetForumId(tx *pgx.Tx, forumId string) (string, int) {
 	}
 	return retForumId, OK
 }
+
+// renderedMessage returns the stored HTML of a message, rendering it for rows
+// written before messages were rendered on write.
+func renderedMessage(messageHtml pgx.NullString, message string) string {
+	if messageHtml.Valid {
+		return messageHtml.String
+	}
+	return markdown.Render(message)
+}
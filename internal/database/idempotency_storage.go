@@ -0,0 +1,75 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/idempotency"
+	"gopkg.in/jackc/pgx.v2"
+)
+
+const (
+	claimIdempotencyKey = "INSERT INTO idempotency_keys AS k (key, fingerprint, expires) " +
+		"VALUES($1, $2, now() + $3::float8 * interval '1 second') " +
+		"ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status = 0, content_type = '', " +
+		"body = '', expires = EXCLUDED.expires WHERE k.expires <= now() " +
+		"RETURNING true"
+	getIdempotencyKey            = "SELECT fingerprint, status, content_type, body FROM idempotency_keys WHERE key = $1"
+	completeIdempotencyKey       = "UPDATE idempotency_keys SET status = $2, content_type = $3, body = $4 WHERE key = $1"
+	releaseIdempotencyKey        = "DELETE FROM idempotency_keys WHERE key = $1 AND status = 0"
+	deleteExpiredIdempotencyKeys = "DELETE FROM idempotency_keys WHERE expires <= now()"
+)
+
+// ClaimIdempotencyKey claims key for ttlSeconds unless it is claimed and not
+// expired, in which case it returns what is stored under it. A key released
+// between the claim and the read is claimed again.
+func (db *DB) ClaimIdempotencyKey(key string, fingerprint string, ttlSeconds float64) (_ *idempotency.Response, failure error) {
+	defer db.trackErr("ClaimIdempotencyKey", &failure)()
+	for {
+		claimed := false
+		err := db.sql().QueryRow(claimIdempotencyKey, key, fingerprint, ttlSeconds).Scan(&claimed)
+		if err == nil {
+			return nil, nil
+		}
+		if err != pgx.ErrNoRows {
+			db.logError("claimIdempotencyKey", err)
+			return nil, err
+		}
+		stored := new(idempotency.Response)
+		status := int32(0)
+		err = db.sql().QueryRow(getIdempotencyKey, key).Scan(&stored.Fingerprint, &status, &stored.ContentType, &stored.Body)
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			db.logError("getIdempotencyKey", err)
+			return nil, err
+		}
+		stored.Status = int(status)
+		return stored, nil
+	}
+}
+
+func (db *DB) CompleteIdempotencyKey(key string, stored idempotency.Response) (failure error) {
+	defer db.trackErr("CompleteIdempotencyKey", &failure)()
+	_, err := db.sql().Exec(completeIdempotencyKey, key, int32(stored.Status), stored.ContentType, stored.Body)
+	if err != nil {
+		db.logError("completeIdempotencyKey", err)
+	}
+	return err
+}
+
+func (db *DB) ReleaseIdempotencyKey(key string) (failure error) {
+	defer db.trackErr("ReleaseIdempotencyKey", &failure)()
+	_, err := db.sql().Exec(releaseIdempotencyKey, key)
+	if err != nil {
+		db.logError("releaseIdempotencyKey", err)
+	}
+	return err
+}
+
+func (db *DB) DeleteExpiredIdempotencyKeys() (failure error) {
+	defer db.trackErr("DeleteExpiredIdempotencyKeys", &failure)()
+	_, err := db.sql().Exec(deleteExpiredIdempotencyKeys)
+	if err != nil {
+		db.logError("deleteExpiredIdempotencyKeys", err)
+	}
+	return err
+}
@@ -0,0 +1,479 @@
+package database
+
+import (
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/archive"
+	"github.com/sergeychur/technopark_db/internal/markdown"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	findImportUser = "SELECT nick_name FROM users WHERE nick_name = $1 OR email = $2 " +
+		"ORDER BY nick_name = $1 DESC LIMIT 1"
+	isEmailTaken = "SELECT true FROM users WHERE email = $1"
+	importPost   = "INSERT INTO posts (message, forum, thread, author, parent, created, is_edited, message_html) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	importVote = "INSERT INTO votes (thread, author, is_like) VALUES($1, $2, $3) " +
+		"ON CONFLICT (thread, author) DO UPDATE SET is_like = $3"
+	recountForum = "UPDATE forum SET posts_count = (SELECT count(*) FROM posts WHERE forum = $1), " +
+		"threads_count = (SELECT count(*) FROM threads WHERE forum = $1) WHERE slug = $1"
+	recountThreadVotes = "UPDATE threads t SET votes = (SELECT COALESCE(sum(CASE WHEN v.is_like THEN 1 ELSE -1 END), 0) " +
+		"FROM votes v WHERE v.thread = t.id) WHERE t.forum = $1"
+	refillForumUsers = "INSERT INTO forum_to_users (forum, user_nick) " +
+		"SELECT $1, author FROM posts WHERE forum = $1 UNION SELECT $1, author FROM threads WHERE forum = $1 " +
+		"ON CONFLICT DO NOTHING"
+)
+
+// archive record order; a record may not come after one of a later stage
+var importStages = map[string]int{
+	archive.TypeHeader: 0,
+	archive.TypeForum:  1,
+	archive.TypeUser:   2,
+	archive.TypeThread: 3,
+	archive.TypePost:   4,
+	archive.TypeVote:   5,
+	archive.TypeEnd:    6,
+}
+
+type importError struct {
+	stat    int
+	message string
+}
+
+func (e *importError) Error() string {
+	return e.message
+}
+
+func invalidArchive(format string, args ...interface{}) error {
+	return &importError{stat: Invalid, message: fmt.Sprintf(format, args...)}
+}
+
+func importConflict(format string, args ...interface{}) error {
+	return &importError{stat: Conflict, message: fmt.Sprintf(format, args...)}
+}
+
+// importedPost is where a post of the archive went: its new id and the
+// archive thread it belongs to.
+type importedPost struct {
+	id     int64
+	thread int32
+}
+
+type forumImport struct {
+	tx       *Tx
+	reader   *archive.Reader
+	policy   string
+	report   models.ImportReport
+	forum    *archive.Forum
+	created  bool
+	users    map[string]string
+	threads  map[int32]int32
+	skipped  map[int32]bool
+	posts    map[int64]importedPost
+	stage    int
+	records  int64
+	finished bool
+}
+
+// ImportForum recreates a forum from an archive in one transaction. Ids are
+// reassigned, timestamps kept, post paths rebuilt by inserting parents first
+// and forum counters and participants recounted. Collisions with existing
+// forums, users and thread slugs are handled by policy. On failure the report
+// message says why; the status is Invalid for a malformed archive.
+func (db *DB) ImportForum(reader *archive.Reader, policy string) (_ models.ImportReport, status int) {
+	defer db.track("ImportForum", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.ImportReport{}, DBError
+	}
+	defer tx.Rollback()
+	imp := &forumImport{
+		tx:      tx,
+		reader:  reader,
+		policy:  policy,
+		users:   make(map[string]string),
+		threads: make(map[int32]int32),
+		skipped: make(map[int32]bool),
+		posts:   make(map[int64]importedPost),
+		stage:   -1,
+	}
+	err = imp.run()
+	if err != nil {
+		imp.report.Message = err.Error()
+		if importErr, ok := err.(*importError); ok {
+			return imp.report, importErr.stat
+		}
+		db.logError("begin", err)
+		return imp.report, DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return imp.report, DBError
+	}
+	return imp.report, OK
+}
+
+func (imp *forumImport) run() error {
+	for !imp.finished {
+		record, err := imp.reader.Next()
+		if err == io.EOF {
+			return invalidArchive("archive is truncated: no end record")
+		}
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		if record.Type == archive.TypeError {
+			return invalidArchive("archive ends with an export error")
+		}
+		stage, ok := importStages[record.Type]
+		if !ok {
+			return invalidArchive("line %d: unknown record type %q", imp.reader.Line(), record.Type)
+		}
+		if stage < imp.stage || (stage == imp.stage && stage <= importStages[archive.TypeForum]) ||
+			(stage > 0 && imp.stage < 0) || (stage > importStages[archive.TypeForum] && imp.forum == nil) {
+			return invalidArchive("line %d: %s record out of order", imp.reader.Line(), record.Type)
+		}
+		imp.stage = stage
+		if stage > importStages[archive.TypeUser] {
+			err = imp.createForum()
+			if err != nil {
+				return err
+			}
+		}
+		err = imp.apply(record)
+		if err != nil {
+			return err
+		}
+		imp.records++
+	}
+	return nil
+}
+
+func (imp *forumImport) apply(record archive.Record) error {
+	switch record.Type {
+	case archive.TypeHeader:
+		header := archive.Header{}
+		err := imp.reader.Decode(record, &header)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		if header.Version != archive.Version {
+			return invalidArchive("unsupported archive version %d", header.Version)
+		}
+		return nil
+	case archive.TypeForum:
+		forum := &archive.Forum{}
+		err := imp.reader.Decode(record, forum)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		return imp.checkForum(forum)
+	case archive.TypeUser:
+		user := archive.User{}
+		err := imp.reader.Decode(record, &user)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		return imp.importUser(user)
+	case archive.TypeThread:
+		thread := archive.Thread{}
+		err := imp.reader.Decode(record, &thread)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		return imp.importThread(thread)
+	case archive.TypePost:
+		post := archive.Post{}
+		err := imp.reader.Decode(record, &post)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		return imp.importPost(post)
+	case archive.TypeVote:
+		vote := archive.Vote{}
+		err := imp.reader.Decode(record, &vote)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		return imp.importVote(vote)
+	case archive.TypeEnd:
+		end := archive.End{}
+		err := imp.reader.Decode(record, &end)
+		if err != nil {
+			return invalidArchive("%s", err.Error())
+		}
+		if end.Records != imp.records {
+			return invalidArchive("archive holds %d records, end record says %d", imp.records, end.Records)
+		}
+		imp.finished = true
+		return imp.recount()
+	}
+	return nil
+}
+
+func (imp *forumImport) checkForum(forum *archive.Forum) error {
+	slug := forum.Slug
+	ifExists, err := IsForumExist(imp.tx, slug)
+	if err != nil {
+		return err
+	}
+	if ifExists {
+		switch imp.policy {
+		case archive.PolicyFail:
+			return importConflict("forum %s already exists", slug)
+		case archive.PolicySkip:
+			imp.report.Forum = slug
+			imp.report.SkippedForum = true
+			imp.report.Message = "forum " + slug + " already exists, nothing imported"
+			imp.finished = true
+			return nil
+		}
+		slug, err = imp.freeName(forum.Slug, "-", func(candidate string) (bool, error) {
+			return IsForumExist(imp.tx, candidate)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	forum.Slug = slug
+	imp.forum = forum
+	imp.report.Forum = slug
+	return nil
+}
+
+// createForum inserts the forum once its owner has been imported.
+func (imp *forumImport) createForum() error {
+	if imp.created {
+		return nil
+	}
+	owner, ok := imp.users[strings.ToLower(imp.forum.User)]
+	if !ok {
+		return invalidArchive("forum owner %s is not in the archive", imp.forum.User)
+	}
+	_, err := imp.tx.Exec(CreateForum, imp.forum.Slug, imp.forum.Title, owner)
+	if err != nil {
+		return err
+	}
+	imp.created = true
+	return nil
+}
+
+func (imp *forumImport) importUser(user archive.User) error {
+	if user.Nickname == "" {
+		return invalidArchive("line %d: user without nickname", imp.reader.Line())
+	}
+	key := strings.ToLower(user.Nickname)
+	existing := ""
+	err := imp.tx.QueryRow(findImportUser, user.Nickname, user.Email).Scan(&existing)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+	if existing != "" {
+		switch imp.policy {
+		case archive.PolicyFail:
+			return importConflict("user %s already exists", existing)
+		case archive.PolicySkip:
+			imp.users[key] = existing
+			imp.report.ReusedUsers = append(imp.report.ReusedUsers, existing)
+			return nil
+		}
+		nick := user.Nickname
+		if strings.EqualFold(existing, nick) {
+			nick, err = imp.freeName(user.Nickname, "_", func(candidate string) (bool, error) {
+				return IsUserExist(imp.tx, candidate)
+			})
+			if err != nil {
+				return err
+			}
+			if imp.report.RenamedUsers == nil {
+				imp.report.RenamedUsers = make(map[string]string)
+			}
+			imp.report.RenamedUsers[user.Nickname] = nick
+		}
+		email, err := imp.freeEmail(user.Email)
+		if err != nil {
+			return err
+		}
+		user.Nickname = nick
+		user.Email = email
+	}
+	_, err = imp.tx.Exec(createUser, user.Nickname, user.Email, user.Fullname, user.About)
+	if err != nil {
+		return err
+	}
+	imp.users[key] = user.Nickname
+	imp.report.Users++
+	return nil
+}
+
+func (imp *forumImport) importThread(thread archive.Thread) error {
+	author, err := imp.user(thread.Author)
+	if err != nil {
+		return err
+	}
+	if thread.Slug != "" {
+		ifExists, err := IsThreadExistBySlug(imp.tx, thread.Slug)
+		if err != nil {
+			return err
+		}
+		if ifExists {
+			switch imp.policy {
+			case archive.PolicyFail:
+				return importConflict("thread %s already exists", thread.Slug)
+			case archive.PolicySkip:
+				imp.skipped[thread.ID] = true
+				imp.report.SkippedThreads = append(imp.report.SkippedThreads, thread.Slug)
+				return nil
+			}
+			slug, err := imp.freeName(thread.Slug, "-", func(candidate string) (bool, error) {
+				return IsThreadExistBySlug(imp.tx, candidate)
+			})
+			if err != nil {
+				return err
+			}
+			if imp.report.RenamedThreads == nil {
+				imp.report.RenamedThreads = make(map[string]string)
+			}
+			imp.report.RenamedThreads[thread.Slug] = slug
+			thread.Slug = slug
+		}
+	}
+	created, err := parseArchiveTime(thread.Created)
+	if err != nil {
+		return err
+	}
+	newId := int32(0)
+	err = imp.tx.QueryRow(createThreadWithTime, thread.Slug, created, thread.Title, author,
+		imp.forum.Slug, thread.Message, markdown.Render(thread.Message)).Scan(&newId)
+	if err != nil {
+		return err
+	}
+	imp.threads[thread.ID] = newId
+	imp.report.Threads++
+	return nil
+}
+
+func (imp *forumImport) importPost(post archive.Post) error {
+	if imp.skipped[post.Thread] {
+		return nil
+	}
+	threadId, ok := imp.threads[post.Thread]
+	if !ok {
+		return invalidArchive("line %d: post %d of unknown thread %d", imp.reader.Line(), post.ID, post.Thread)
+	}
+	parent := int64(0)
+	if post.Parent != 0 {
+		imported, ok := imp.posts[post.Parent]
+		if !ok {
+			return invalidArchive("line %d: post %d comes before its parent %d", imp.reader.Line(), post.ID, post.Parent)
+		}
+		if imported.thread != post.Thread {
+			return invalidArchive("line %d: post %d answers post %d of another thread", imp.reader.Line(), post.ID, post.Parent)
+		}
+		parent = imported.id
+	}
+	author, err := imp.user(post.Author)
+	if err != nil {
+		return err
+	}
+	created, err := parseArchiveTime(post.Created)
+	if err != nil {
+		return err
+	}
+	newId := int64(0)
+	err = imp.tx.QueryRow(importPost, post.Message, imp.forum.Slug, threadId, author, parent, created,
+		post.IsEdited, markdown.Render(post.Message)).Scan(&newId)
+	if err != nil {
+		return err
+	}
+	imp.posts[post.ID] = importedPost{id: newId, thread: post.Thread}
+	imp.report.Posts++
+	return nil
+}
+
+func (imp *forumImport) importVote(vote archive.Vote) error {
+	if imp.skipped[vote.Thread] {
+		return nil
+	}
+	threadId, ok := imp.threads[vote.Thread]
+	if !ok {
+		return invalidArchive("line %d: vote in unknown thread %d", imp.reader.Line(), vote.Thread)
+	}
+	author, err := imp.user(vote.Nickname)
+	if err != nil {
+		return err
+	}
+	_, err = imp.tx.Exec(importVote, threadId, author, vote.Voice > 0)
+	if err != nil {
+		return err
+	}
+	imp.report.Votes++
+	return nil
+}
+
+// recount replaces whatever triggers accumulated during the import with
+// counters computed from the imported rows.
+func (imp *forumImport) recount() error {
+	for _, statement := range []string{recountForum, recountThreadVotes, refillForumUsers} {
+		_, err := imp.tx.Exec(statement, imp.forum.Slug)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imp *forumImport) user(nick string) (string, error) {
+	user, ok := imp.users[strings.ToLower(nick)]
+	if !ok {
+		return "", invalidArchive("line %d: user %s is not in the archive", imp.reader.Line(), nick)
+	}
+	return user, nil
+}
+
+func (imp *forumImport) freeName(name string, separator string, taken func(string) (bool, error)) (string, error) {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s%s%d", name, separator, i)
+		ifTaken, err := taken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !ifTaken {
+			return candidate, nil
+		}
+	}
+}
+
+func (imp *forumImport) freeEmail(email string) (string, error) {
+	local, domain := email, ""
+	at := strings.LastIndex(email, "@")
+	if at >= 0 {
+		local, domain = email[:at], email[at:]
+	}
+	candidate := email
+	for i := 2; ; i++ {
+		ifTaken := false
+		err := imp.tx.QueryRow(isEmailTaken, candidate).Scan(&ifTaken)
+		if err == pgx.ErrNoRows {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s+%d%s", local, i, domain)
+	}
+}
+
+func parseArchiveTime(value string) (time.Time, error) {
+	created, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", value)
+	if err != nil {
+		return created, invalidArchive("bad timestamp %q", value)
+	}
+	return created, nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"gopkg.in/jackc/pgx.v2"
+	"log/slog"
+)
+
+// WithLogger returns a copy of db that logs to logger, so storage errors carry
+// the fields of the request that ran the statement.
+func (db *DB) WithLogger(logger *slog.Logger) *DB {
+	scoped := *db
+	scoped.log = logger
+	return &scoped
+}
+
+func (db *DB) logger() *slog.Logger {
+	if db.log == nil {
+		return slog.Default()
+	}
+	return db.log
+}
+
+func (db *DB) logError(statement string, err error) {
+	storageError(db.logger(), statement, err)
+}
+
+// storageError logs a failed statement by the name it has in this package,
+// with the Postgres error code when the server sent one.
+func storageError(logger *slog.Logger, statement string, err error) {
+	attrs := []interface{}{"statement", statement, "error", err.Error()}
+	if pgErr, ok := err.(pgx.PgError); ok {
+		attrs = append(attrs, "code", pgErr.Code)
+		if pgErr.ConstraintName != "" {
+			attrs = append(attrs, "constraint", pgErr.ConstraintName)
+		}
+	}
+	logger.Error("storage error", attrs...)
+}
+
+// logStorageError is for helpers that run on a transaction handed to them and
+// have no DB to take a request logger from.
+func logStorageError(statement string, err error) {
+	storageError(slog.Default(), statement, err)
+}
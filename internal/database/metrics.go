@@ -0,0 +1,124 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/metrics"
+	"github.com/sergeychur/technopark_db/internal/tracing"
+	"time"
+)
+
+type storageMetrics struct {
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+	waits    *metrics.CounterVec
+	posts    *metrics.CounterVec
+	threads  *metrics.CounterVec
+	votes    *metrics.CounterVec
+}
+
+// Instrument registers the storage and connection pool metrics in registry and
+// starts recording them for db and every copy made from it afterwards.
+func (db *DB) Instrument(registry *metrics.Registry) {
+	db.metrics = &storageMetrics{
+		duration: registry.NewHistogram("forum_storage_duration_seconds",
+			"Time spent in a storage method, including every query it ran.",
+			metrics.DefaultBuckets, "method"),
+		errors: registry.NewCounter("forum_storage_errors_total",
+			"Storage method calls that failed with a database error.", "method"),
+		// pgx.v2 keeps no wait counter of its own, so a wait is a call that
+		// started while every connection the pool may open was in use.
+		waits: registry.NewCounter("forum_db_pool_waits_total",
+			"Storage method calls that started with no free pool connection."),
+		posts: registry.NewCounter("forum_posts_created_total",
+			"Posts created, by whether they were published or held for moderation.", "state"),
+		threads: registry.NewCounter("forum_threads_created_total", "Threads created."),
+		votes:   registry.NewCounter("forum_votes_total", "Votes cast or changed."),
+	}
+	registry.NewGaugeFunc("forum_db_pool_max_connections",
+		"Connections the pool may open.", db.poolStat(func(acquired, available, max int) int { return max }))
+	registry.NewGaugeFunc("forum_db_pool_acquired_connections",
+		"Pool connections in use.", db.poolStat(func(acquired, available, max int) int { return acquired }))
+	registry.NewGaugeFunc("forum_db_pool_available_connections",
+		"Open pool connections waiting to be acquired.", db.poolStat(func(acquired, available, max int) int { return available }))
+}
+
+func (db *DB) poolStat(pick func(acquired, available, max int) int) func() float64 {
+	return func() float64 {
+		if db.db == nil {
+			return 0
+		}
+		stat := db.db.Stat()
+		acquired := stat.CurrentConnections - stat.AvailableConnections
+		return float64(pick(acquired, stat.AvailableConnections, stat.MaxConnections))
+	}
+}
+
+func (db *DB) poolExhausted() bool {
+	if db.db == nil {
+		return false
+	}
+	stat := db.db.Stat()
+	return stat.AvailableConnections == 0 && stat.CurrentConnections >= stat.MaxConnections
+}
+
+// track is deferred at the top of a storage method. It opens the span of the
+// call, which parents the statements the method runs, and the returned func
+// records the duration and, once status is final, whether the call failed.
+func (db *DB) track(method string, status *int) func() {
+	return db.observe(method, func() bool { return *status == DBError })
+}
+
+func (db *DB) trackErr(method string, failure *error) func() {
+	return db.observe(method, func() bool { return *failure != nil })
+}
+
+func (db *DB) observe(method string, failed func() bool) func() {
+	parent := db.span
+	span := parent.Child("storage."+method, tracing.KindInternal)
+	if span != nil {
+		db.span = span
+	}
+	m := db.metrics
+	if m != nil && db.poolExhausted() {
+		m.waits.Inc()
+	}
+	started := time.Now()
+	return func() {
+		isFailed := failed()
+		if m != nil {
+			m.duration.Observe(time.Since(started).Seconds(), method)
+			if isFailed {
+				m.errors.Inc(method)
+			}
+		}
+		if span != nil {
+			if isFailed {
+				span.SetError("storage error")
+			}
+			span.End()
+			db.span = parent
+		}
+	}
+}
+
+// The business counters are bumped only after the transaction that made the
+// rows has committed.
+
+func (db *DB) countPosts(published int, pending int) {
+	if db.metrics == nil {
+		return
+	}
+	db.metrics.posts.Add(float64(published), "published")
+	db.metrics.posts.Add(float64(pending), "pending")
+}
+
+func (db *DB) countThread() {
+	if db.metrics != nil {
+		db.metrics.threads.Inc()
+	}
+}
+
+func (db *DB) countVote() {
+	if db.metrics != nil {
+		db.metrics.votes.Inc()
+	}
+}
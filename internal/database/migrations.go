@@ -0,0 +1,158 @@
+package database
+
+import (
+	"gopkg.in/jackc/pgx.v2"
+	"strconv"
+)
+
+const (
+	createMigrationsTable = "CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version INTEGER PRIMARY KEY, applied TIMESTAMPTZ NOT NULL DEFAULT now())"
+	lockMigrations       = "SELECT pg_advisory_xact_lock(7531)"
+	isMigrationApplied   = "SELECT true FROM schema_migrations WHERE version = $1"
+	markMigrationApplied = "INSERT INTO schema_migrations (version) VALUES($1)"
+)
+
+// migrations extend the base forum schema. They are applied in order on Start,
+// each exactly once; append new statements, never edit applied ones.
+var migrations = []string{
+	"CREATE TABLE IF NOT EXISTS user_credentials (" +
+		"user_nick TEXT PRIMARY KEY, " +
+		"password_hash TEXT NOT NULL)",
+	"CREATE TABLE IF NOT EXISTS auth_tokens (" +
+		"id BIGSERIAL PRIMARY KEY, " +
+		"token_hash TEXT NOT NULL UNIQUE, " +
+		"user_nick TEXT NOT NULL, " +
+		"kind TEXT NOT NULL, " +
+		"name TEXT NOT NULL DEFAULT '', " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now(), " +
+		"expires TIMESTAMPTZ)",
+	"CREATE INDEX IF NOT EXISTS auth_tokens_user_nick ON auth_tokens (user_nick)",
+	"CREATE TABLE IF NOT EXISTS forum_moderators (" +
+		"forum TEXT NOT NULL, " +
+		"user_nick TEXT NOT NULL, " +
+		"granted_by TEXT NOT NULL, " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now(), " +
+		"PRIMARY KEY (forum, user_nick))",
+	"CREATE TABLE IF NOT EXISTS forum_bans (" +
+		"forum TEXT NOT NULL, " +
+		"user_nick TEXT NOT NULL, " +
+		"reason TEXT NOT NULL DEFAULT '', " +
+		"banned_by TEXT NOT NULL, " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now(), " +
+		"expires TIMESTAMPTZ, " +
+		"PRIMARY KEY (forum, user_nick))",
+	"CREATE TABLE IF NOT EXISTS forum_settings (" +
+		"forum TEXT PRIMARY KEY, " +
+		"premoderation BOOLEAN NOT NULL DEFAULT false, " +
+		"trusted_after INTEGER NOT NULL DEFAULT 1)",
+	"CREATE TABLE IF NOT EXISTS pending_posts (" +
+		"id BIGSERIAL PRIMARY KEY, " +
+		"forum TEXT NOT NULL, " +
+		"thread INTEGER NOT NULL, " +
+		"author TEXT NOT NULL, " +
+		"parent BIGINT NOT NULL DEFAULT 0, " +
+		"message TEXT NOT NULL, " +
+		"created TIMESTAMPTZ NOT NULL)",
+	"CREATE INDEX IF NOT EXISTS pending_posts_forum ON pending_posts (forum, id)",
+	"CREATE TABLE IF NOT EXISTS reports (" +
+		"id BIGSERIAL PRIMARY KEY, " +
+		"kind TEXT NOT NULL, " +
+		"item_id BIGINT NOT NULL, " +
+		"forum TEXT NOT NULL, " +
+		"reporter TEXT NOT NULL, " +
+		"reason TEXT NOT NULL DEFAULT '', " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now(), " +
+		"resolved BOOLEAN NOT NULL DEFAULT false)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS reports_open ON reports (kind, item_id, reporter) WHERE NOT resolved",
+	"CREATE INDEX IF NOT EXISTS reports_forum ON reports (forum) WHERE NOT resolved",
+	"CREATE TABLE IF NOT EXISTS moderation_log (" +
+		"id BIGSERIAL PRIMARY KEY, " +
+		"forum TEXT NOT NULL, " +
+		"moderator TEXT NOT NULL, " +
+		"action TEXT NOT NULL, " +
+		"kind TEXT NOT NULL DEFAULT '', " +
+		"item_id BIGINT NOT NULL DEFAULT 0, " +
+		"target TEXT NOT NULL DEFAULT '', " +
+		"reason TEXT NOT NULL DEFAULT '', " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now())",
+	"CREATE INDEX IF NOT EXISTS moderation_log_forum ON moderation_log (forum, id)",
+	"CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (" +
+		"key TEXT PRIMARY KEY, " +
+		"tokens DOUBLE PRECISION NOT NULL, " +
+		"allowed BOOLEAN NOT NULL, " +
+		"updated TIMESTAMPTZ NOT NULL)",
+	"ALTER TABLE users ADD COLUMN IF NOT EXISTS created TIMESTAMPTZ NOT NULL DEFAULT now()",
+	"CREATE TABLE IF NOT EXISTS filter_rules (" +
+		"id BIGSERIAL PRIMARY KEY, " +
+		"forum TEXT NOT NULL, " +
+		"kind TEXT NOT NULL, " +
+		"action TEXT NOT NULL, " +
+		"pattern TEXT NOT NULL DEFAULT '', " +
+		"value BIGINT NOT NULL DEFAULT 0, " +
+		"created_by TEXT NOT NULL, " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now())",
+	"CREATE INDEX IF NOT EXISTS filter_rules_forum ON filter_rules (forum, id)",
+	"CREATE INDEX IF NOT EXISTS posts_author_created ON posts (author, created)",
+	"CREATE TABLE IF NOT EXISTS attachments (" +
+		"id BIGSERIAL PRIMARY KEY, " +
+		"blob_key TEXT NOT NULL UNIQUE, " +
+		"owner TEXT NOT NULL, " +
+		"name TEXT NOT NULL, " +
+		"content_type TEXT NOT NULL, " +
+		"size BIGINT NOT NULL, " +
+		"created TIMESTAMPTZ NOT NULL DEFAULT now(), " +
+		"post BIGINT, " +
+		"pending BIGINT)",
+	"CREATE INDEX IF NOT EXISTS attachments_post ON attachments (post) WHERE post IS NOT NULL",
+	"CREATE INDEX IF NOT EXISTS attachments_pending ON attachments (pending) WHERE pending IS NOT NULL",
+	"ALTER TABLE posts ADD COLUMN IF NOT EXISTS message_html TEXT",
+	"ALTER TABLE threads ADD COLUMN IF NOT EXISTS message_html TEXT",
+	"CREATE TABLE IF NOT EXISTS idempotency_keys (" +
+		"key TEXT PRIMARY KEY, " +
+		"fingerprint TEXT NOT NULL, " +
+		"status INTEGER NOT NULL DEFAULT 0, " +
+		"content_type TEXT NOT NULL DEFAULT '', " +
+		"body BYTEA NOT NULL DEFAULT '', " +
+		"expires TIMESTAMPTZ NOT NULL)",
+	"CREATE TABLE IF NOT EXISTS admin_credentials (" +
+		"user_nick TEXT PRIMARY KEY, " +
+		"password_hash TEXT NOT NULL)",
+}
+
+func (db *DB) migrate() error {
+	tx, err := db.StartTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(createMigrationsTable)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(lockMigrations)
+	if err != nil {
+		return err
+	}
+	for i, statement := range migrations {
+		version := i + 1
+		ifApplied := false
+		err := tx.QueryRow(isMigrationApplied, version).Scan(&ifApplied)
+		if err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+		if ifApplied {
+			continue
+		}
+		_, err = tx.Exec(statement)
+		if err != nil {
+			db.logError("migration "+strconv.Itoa(version), err)
+			return err
+		}
+		_, err = tx.Exec(markMigrationApplied, version)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,412 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/markdown"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+const (
+	isUserBanned = "SELECT true FROM forum_bans WHERE forum = $1 AND " +
+		"user_nick = (SELECT nick_name FROM users WHERE nick_name = $2) AND (expires IS NULL OR expires > now())"
+	getForumBans = "SELECT user_nick, reason, banned_by, created, expires FROM forum_bans " +
+		"WHERE forum = $1 AND (expires IS NULL OR expires > now()) ORDER BY created"
+	banUser = "INSERT INTO forum_bans (forum, user_nick, reason, banned_by, expires) VALUES($1, $2, $3, $4, $5) " +
+		"ON CONFLICT (forum, user_nick) DO UPDATE SET reason = $3, banned_by = $4, expires = $5, created = now() " +
+		"RETURNING created"
+	unbanUser = "DELETE FROM forum_bans WHERE forum = $1 AND " +
+		"user_nick = (SELECT nick_name FROM users WHERE nick_name = $2)"
+	getForumSettings = "SELECT premoderation, trusted_after FROM forum_settings WHERE forum = $1"
+	setForumSettings = "INSERT INTO forum_settings (forum, premoderation, trusted_after) VALUES($1, $2, $3) " +
+		"ON CONFLICT (forum) DO UPDATE SET premoderation = $2, trusted_after = $3"
+	isTrustedAuthor = "SELECT (SELECT count(*) FROM (SELECT 1 FROM posts WHERE forum = $1 AND author = $2 LIMIT $3) AS p) >= $3 " +
+		"OR EXISTS (SELECT 1 FROM forum WHERE slug = $1 AND user_nick = $2) " +
+		"OR EXISTS (SELECT 1 FROM forum_moderators WHERE forum = $1 AND user_nick = $2)"
+	createPendingPost = "INSERT INTO pending_posts (forum, thread, author, parent, message, created) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created"
+	getPendingPosts = "SELECT id, author, created, forum, message, parent, thread FROM pending_posts " +
+		"WHERE forum = $1 AND id > $2 ORDER BY id LIMIT $3"
+	takePendingPost = "DELETE FROM pending_posts WHERE id = $1 AND forum = $2 " +
+		"RETURNING author, created, message, parent, thread"
+)
+
+func IsUserBanned(tx *Tx, forumId string, userNick string) (bool, error) {
+	ifBanned := false
+	err := tx.QueryRow(isUserBanned, forumId, userNick).Scan(&ifBanned)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logStorageError("isUserBanned", err)
+		return false, err
+	}
+	return ifBanned, nil
+}
+
+// IsTrustedAuthor reports whether posts of userNick skip premoderation: the forum
+// owner, its moderators and users with at least trustedAfter published posts.
+func IsTrustedAuthor(tx *Tx, forumId string, userNick string, trustedAfter int32) (bool, error) {
+	ifTrusted := false
+	err := tx.QueryRow(isTrustedAuthor, forumId, userNick, trustedAfter).Scan(&ifTrusted)
+	if err != nil {
+		logStorageError("isTrustedAuthor", err)
+		return false, err
+	}
+	return ifTrusted, nil
+}
+
+func GetForumSettings(tx *Tx, forumId string) (models.ForumSettings, int) {
+	settings := models.ForumSettings{Forum: forumId, TrustedAfter: 1}
+	err := tx.QueryRow(getForumSettings, forumId).Scan(&settings.Premoderation, &settings.TrustedAfter)
+	if err == pgx.ErrNoRows {
+		return settings, OK
+	}
+	if err != nil {
+		logStorageError("getForumSettings", err)
+		return settings, DBError
+	}
+	return settings, OK
+}
+
+// insertPendingPost queues the post for premoderation. Pending ids come from
+// their own sequence and may equal ids of published posts, so they never
+// stand for a parent: the parent of a post, pending or not, is always a
+// published post.
+func insertPendingPost(tx *Tx, forumId string, threadId int,
+	post *models.Post, timeString string) (*models.Post, int) {
+	pendingPost := &models.Post{
+		Author:  post.Author,
+		Forum:   forumId,
+		Message: post.Message,
+		Parent:  post.Parent,
+		Pending: true,
+		Thread:  int32(threadId),
+	}
+	timeStamp := time.Time{}
+	err := tx.QueryRow(createPendingPost, forumId, threadId, post.Author, post.Parent,
+		post.Message, timeString).Scan(&pendingPost.ID, &timeStamp)
+	if err != nil {
+		logStorageError("createPendingPost", err)
+		return nil, DBError
+	}
+	pendingPost.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+	return pendingPost, OK
+}
+
+func (db *DB) GetForumBans(forumId string) (_ models.Bans, status int) {
+	defer db.track("GetForumBans", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return nil, stat
+	}
+	rows, err := db.sql().Query(getForumBans, forumId)
+	if err != nil {
+		db.logError("getForumBans", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	bans := models.Bans{}
+	for rows.Next() {
+		ban := &models.Ban{Forum: forumId}
+		created := time.Time{}
+		expires := pgx.NullTime{}
+		err := rows.Scan(&ban.Nickname, &ban.Reason, &ban.BannedBy, &created, &expires)
+		if err != nil {
+			db.logError("getForumBans", err)
+			return models.Bans{}, DBError
+		}
+		ban.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		if expires.Valid {
+			ban.Expires = expires.Time.Format("2006-01-02T15:04:05.999999999Z07:00")
+		}
+		bans = append(bans, ban)
+	}
+	return bans, OK
+}
+
+// BanUser bans the user from the forum until expires, forever for the zero time.
+// Banning an already banned user replaces the ban.
+func (db *DB) BanUser(forumId string, userNick string, reason string,
+	bannedBy string, expires time.Time) (_ models.Ban, status int) {
+	defer db.track("BanUser", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.Ban{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return models.Ban{}, stat
+	}
+	nick, stat := GetUserNick(tx, userNick)
+	if stat != OK {
+		return models.Ban{}, stat
+	}
+	nullExpires := pgx.NullTime{Time: expires, Valid: !expires.IsZero()}
+	created := time.Time{}
+	err = tx.QueryRow(banUser, forumId, nick, reason, bannedBy, nullExpires).Scan(&created)
+	if err != nil {
+		db.logError("banUser", err)
+		return models.Ban{}, DBError
+	}
+	action := models.ModerationAction{
+		Action:    ActionBan,
+		Forum:     forumId,
+		Moderator: bannedBy,
+		Reason:    reason,
+		Target:    nick,
+	}
+	err = LogModerationAction(tx, action)
+	if err != nil {
+		return models.Ban{}, DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return models.Ban{}, DBError
+	}
+	ban := models.Ban{
+		BannedBy: bannedBy,
+		Created:  created.Format("2006-01-02T15:04:05.999999999Z07:00"),
+		Forum:    forumId,
+		Nickname: nick,
+		Reason:   reason,
+	}
+	if nullExpires.Valid {
+		ban.Expires = expires.Format("2006-01-02T15:04:05.999999999Z07:00")
+	}
+	return ban, OK
+}
+
+func (db *DB) UnbanUser(forumId string, userNick string, moderator string) (status int) {
+	defer db.track("UnbanUser", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return stat
+	}
+	res, err := tx.Exec(unbanUser, forumId, userNick)
+	if err != nil {
+		db.logError("unbanUser", err)
+		return DBError
+	}
+	if res.RowsAffected() == 0 {
+		return EmptyResult
+	}
+	action := models.ModerationAction{
+		Action:    ActionUnban,
+		Forum:     forumId,
+		Moderator: moderator,
+		Target:    userNick,
+	}
+	err = LogModerationAction(tx, action)
+	if err != nil {
+		return DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return DBError
+	}
+	return OK
+}
+
+func (db *DB) GetForumSettings(forumId string) (_ models.ForumSettings, status int) {
+	defer db.track("GetForumSettings", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.ForumSettings{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return models.ForumSettings{}, stat
+	}
+	return GetForumSettings(tx, forumId)
+}
+
+func (db *DB) UpdateForumSettings(forumId string, settings models.ForumSettings) (_ models.ForumSettings, status int) {
+	defer db.track("UpdateForumSettings", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.ForumSettings{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return models.ForumSettings{}, stat
+	}
+	_, err = tx.Exec(setForumSettings, forumId, settings.Premoderation, settings.TrustedAfter)
+	if err != nil {
+		db.logError("setForumSettings", err)
+		return models.ForumSettings{}, DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return models.ForumSettings{}, DBError
+	}
+	settings.Forum = forumId
+	return settings, OK
+}
+
+func (db *DB) GetPendingPosts(forumId string, limit string, since string) (_ models.Posts, status int) {
+	defer db.track("GetPendingPosts", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return nil, stat
+	}
+	if limit == "" {
+		limit = "100"
+	}
+	if since == "" {
+		since = "0"
+	}
+	rows, err := db.sql().Query(getPendingPosts, forumId, since, limit)
+	if err != nil {
+		db.logError("getPendingPosts", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	posts := make(models.Posts, 0)
+	for rows.Next() {
+		post := &models.Post{Pending: true}
+		timeStamp := time.Time{}
+		err := rows.Scan(&post.ID, &post.Author, &timeStamp, &post.Forum, &post.Message,
+			&post.Parent, &post.Thread)
+		if err != nil {
+			db.logError("getPendingPosts", err)
+			return models.Posts{}, DBError
+		}
+		post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		posts = append(posts, post)
+	}
+	return posts, OK
+}
+
+// ApprovePendingPost publishes the queued post keeping its original creation time.
+// The post gets a new post id. A post whose parent is gone can only be rejected.
+func (db *DB) ApprovePendingPost(forumId string, pendingId string, moderator string) (_ models.Post, status int) {
+	defer db.track("ApprovePendingPost", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.Post{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return models.Post{}, stat
+	}
+	pending := models.Post{}
+	created := time.Time{}
+	err = tx.QueryRow(takePendingPost, pendingId, forumId).Scan(&pending.Author, &created,
+		&pending.Message, &pending.Parent, &pending.Thread)
+	if err == pgx.ErrNoRows {
+		return models.Post{}, EmptyResult
+	}
+	if err != nil {
+		db.logError("takePendingPost", err)
+		return models.Post{}, DBError
+	}
+	if pending.Parent != 0 {
+		ifParentExist := false
+		err := tx.QueryRow("SELECT true FROM POSTS WHERE id = $1 AND thread = $2",
+			pending.Parent, pending.Thread).Scan(&ifParentExist)
+		if err != nil && err != pgx.ErrNoRows {
+			db.logError("checkParent", err)
+			return models.Post{}, DBError
+		}
+		if err == pgx.ErrNoRows || !ifParentExist {
+			return models.Post{}, Conflict
+		}
+	}
+	post := models.Post{}
+	timeStamp := time.Time{}
+	err = tx.QueryRow(InsertPost, pending.Message, forumId, pending.Thread, pending.Author,
+		pending.Parent, created, markdown.Render(pending.Message)).Scan(&post.ID, &post.Author, &timeStamp, &post.Forum,
+		&post.Message, &post.Parent, &post.Thread, &post.IsEdited, &post.MessageHTML)
+	if err != nil {
+		db.logError("insertPost", err)
+		return models.Post{}, DBError
+	}
+	post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+	_, err = tx.Exec(publishPendingAttachments, post.ID, pendingId)
+	if err != nil {
+		db.logError("publishPendingAttachments", err)
+		return models.Post{}, DBError
+	}
+	err = addForumPosts(tx, forumId, []string{post.Author})
+	if err != nil {
+		db.logError("addForumPosts", err)
+		return models.Post{}, DBError
+	}
+	action := models.ModerationAction{
+		Action:    ActionApprove,
+		Forum:     forumId,
+		Item:      post.ID,
+		Kind:      ItemPost,
+		Moderator: moderator,
+		Target:    post.Author,
+	}
+	err = LogModerationAction(tx, action)
+	if err != nil {
+		return models.Post{}, DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return models.Post{}, DBError
+	}
+	return post, OK
+}
+
+func (db *DB) RejectPendingPost(forumId string, pendingId string, moderator string) (status int) {
+	defer db.track("RejectPendingPost", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return stat
+	}
+	author := ""
+	err = tx.QueryRow("DELETE FROM pending_posts WHERE id = $1 AND forum = $2 RETURNING author",
+		pendingId, forumId).Scan(&author)
+	if err == pgx.ErrNoRows {
+		return EmptyResult
+	}
+	if err != nil {
+		db.logError("deletePendingPost", err)
+		return DBError
+	}
+	action := models.ModerationAction{
+		Action:    ActionReject,
+		Forum:     forumId,
+		Moderator: moderator,
+		Reason:    "pending post " + pendingId,
+		Target:    author,
+	}
+	err = LogModerationAction(tx, action)
+	if err != nil {
+		return DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return DBError
+	}
+	return OK
+}
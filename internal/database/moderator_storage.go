@@ -0,0 +1,116 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"time"
+)
+
+const (
+	getForumModerators = "SELECT user_nick, granted_by, created FROM forum_moderators " +
+		"WHERE forum = $1 ORDER BY user_nick"
+	getForumModerator = "SELECT user_nick, granted_by, created FROM forum_moderators " +
+		"WHERE forum = $1 AND user_nick = $2"
+	addForumModerator = "INSERT INTO forum_moderators (forum, user_nick, granted_by) VALUES($1, $2, $3) " +
+		"ON CONFLICT DO NOTHING"
+	removeForumModerator = "DELETE FROM forum_moderators WHERE forum = $1 AND " +
+		"user_nick = (SELECT nick_name FROM users WHERE nick_name = $2)"
+)
+
+func (db *DB) GetForumModerators(forumId string) (_ models.Moderators, status int) {
+	defer db.track("GetForumModerators", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return nil, stat
+	}
+	rows, err := db.sql().Query(getForumModerators, forumId)
+	if err != nil {
+		db.logError("getForumModerators", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	moderators := models.Moderators{}
+	for rows.Next() {
+		moderator := &models.Moderator{Forum: forumId}
+		created := time.Time{}
+		err := rows.Scan(&moderator.Nickname, &moderator.GrantedBy, &created)
+		if err != nil {
+			db.logError("getForumModerators", err)
+			return models.Moderators{}, DBError
+		}
+		moderator.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		moderators = append(moderators, moderator)
+	}
+	return moderators, OK
+}
+
+func (db *DB) AddForumModerator(forumId string, userNick string, grantedBy string) (_ models.Moderator, status int) {
+	defer db.track("AddForumModerator", &status)()
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.Moderator{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return models.Moderator{}, stat
+	}
+	nick, stat := GetUserNick(tx, userNick)
+	if stat != OK {
+		return models.Moderator{}, stat
+	}
+	res, err := tx.Exec(addForumModerator, forumId, nick, grantedBy)
+	if err != nil {
+		db.logError("addForumModerator", err)
+		return models.Moderator{}, DBError
+	}
+	retStat := OK
+	if res.RowsAffected() == 0 {
+		retStat = Conflict
+	}
+	moderator := models.Moderator{Forum: forumId}
+	created := time.Time{}
+	err = tx.QueryRow(getForumModerator, forumId, nick).Scan(&moderator.Nickname, &moderator.GrantedBy, &created)
+	if err != nil {
+		db.logError("getForumModerator", err)
+		return models.Moderator{}, DBError
+	}
+	moderator.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return models.Moderator{}, DBError
+	}
+	return moderator, retStat
+}
+
+func (db *DB) RemoveForumModerator(forumId string, userNick string) (status int) {
+	defer db.track("RemoveForumModerator", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return stat
+	}
+	res, err := db.sql().Exec(removeForumModerator, forumId, userNick)
+	if err != nil {
+		db.logError("removeForumModerator", err)
+		return DBError
+	}
+	if res.RowsAffected() == 0 {
+		return EmptyResult
+	}
+	return OK
+}
+
+func (db *DB) getForumId(forumId string) (string, int) {
+	retForumId := ""
+	err := db.sql().QueryRow(getForumId, forumId).Scan(&retForumId)
+	if err == pgx.ErrNoRows {
+		return "", EmptyResult
+	}
+	if err != nil {
+		db.logError("getForumId", err)
+		return "", DBError
+	}
+	return retForumId, OK
+}
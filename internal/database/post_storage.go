@@ -3,6 +3,7 @@ package database
 import (
 	"errors"
 	"fmt"
+	"github.com/sergeychur/technopark_db/internal/markdown"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"gopkg.in/jackc/pgx.v2"
 	"strconv"
@@ -10,42 +11,51 @@ import (
 )
 
 var (
-	GetPost    = "SELECT id, author, created, forum, message, parent, thread, is_edited from posts where id = $1"
+	GetPost    = "SELECT id, author, created, forum, message, parent, thread, is_edited, message_html from posts where id = $1"
 	UpdatePost = "UPDATE posts SET message=CASE WHEN $1=''THEN message ELSE $1 END, " +
+		"message_html=CASE WHEN $1='' OR $1=message THEN message_html ELSE $3 END, " +
 		"is_edited=CASE WHEN $1='' OR $1=message THEN is_edited ELSE true END WHERE id=$2"
-	InsertPost = "INSERT INTO POSTS (message, forum, thread, author, parent, created) VALUES($1, $2, $3, $4, $5, $6) " +
-		"RETURNING id, author, created, forum, message, parent, thread, is_edited"
-	GetPostsFlatPart1 = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, p.is_edited FROM posts p JOIN " +
+	InsertPost = "INSERT INTO POSTS (message, forum, thread, author, parent, created, message_html) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7) " +
+		"RETURNING id, author, created, forum, message, parent, thread, is_edited, message_html"
+	GetPostsFlatPart1 = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, p.is_edited, p.message_html " +
+		"FROM posts p JOIN " +
 		"(SELECT id FROM posts WHERE thread = $1 %s ORDER BY id %s LIMIT $2) AS sq ON sq.id = p.id "
 	GetPostsFlatSincePart = "AND id %s $3 "
 	GetPostsFlatPart2     = "ORDER BY id %s "
-	GetPostsTree          = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, p.is_edited FROM posts p " +
+	GetPostsTree          = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, p.is_edited, p.message_html FROM posts p " +
 		"JOIN (SELECT id FROM posts WHERE thread = $1 %s ORDER BY path %s LIMIT $2) AS sq ON sq.id = p.id ORDER BY path %s "
 	GetPostsTreeSincePart = "AND path %s (SELECT path FROM posts WHERE id = $3) "
-	GetPostsParentTree    = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, p.is_edited FROM posts p JOIN ( " +
+	GetPostsParentTree    = "SELECT p.id, p.author, p.created, p.forum, p.message, p.parent, p.thread, p.is_edited, p.message_html " +
+		"FROM posts p JOIN ( " +
 		"SELECT id FROM posts WHERE parent = 0 AND thread = $1 %s ORDER BY id %s LIMIT $2) AS sq ON sq.id=p.path[1] "
 	ParentTreeSincePart        = "AND id %s (SELECT path[1] FROM posts WHERE id=$3)"
 	GetPostsParentTreePart2Alt = "ORDER BY path[1] %s, path "
 )
 
-func (db *DB) GetPost(postId string) (models.Post, int) {
+func (db *DB) GetPost(postId string) (_ models.Post, status int) {
+	defer db.track("GetPost", &status)()
 	post := models.Post{}
-	row := db.db.QueryRow(GetPost, postId)
+	row := db.sql().QueryRow(GetPost, postId)
 	timeStamp := time.Time{}
+	messageHtml := pgx.NullString{}
 	err := row.Scan(&post.ID, &post.Author, &timeStamp,
 		&post.Forum, &post.Message, &post.Parent,
-		&post.Thread, &post.IsEdited)
+		&post.Thread, &post.IsEdited, &messageHtml)
 	if err == pgx.ErrNoRows {
 		return post, EmptyResult
 	}
 	post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+	post.MessageHTML = renderedMessage(messageHtml, post.Message)
 	if err != nil {
+		db.logError("getPost", err)
 		return post, DBError
 	}
-	return post, OK
+	return post, db.fillAttachments(models.Posts{&post})
 }
 
-func (db *DB) GetPostInfo(postId string, related []string) (models.PostFull, int) {
+func (db *DB) GetPostInfo(postId string, related []string) (_ models.PostFull, status int) {
+	defer db.track("GetPostInfo", &status)()
 	subqueries := map[string]bool{
 		"user":   false,
 		"forum":  false,
@@ -95,32 +105,44 @@ func (db *DB) GetPostInfo(postId string, related []string) (models.PostFull, int
 	return post, OK
 }
 
-func (db *DB) UpdatePost(postId string, update models.PostUpdate) (models.Post, int) {
+func (db *DB) UpdatePost(postId string, update models.PostUpdate) (_ models.Post, status int) {
+	defer db.track("UpdatePost", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Post{}, DBError
 	}
 	ifPostExist, err := IsPostExist(tx, postId)
 	if !ifPostExist {
 		return models.Post{}, EmptyResult
 	}
-	_, err = tx.Exec(UpdatePost, update.Message, postId)
+	_, err = tx.Exec(UpdatePost, update.Message, postId, markdown.Render(update.Message))
 	if err != nil {
+		db.logError("updatePost", err)
 		return models.Post{}, DBError
 	}
 
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return models.Post{}, DBError
 	}
 
 	return db.GetPost(postId)
 }
 
-func (db *DB) CreatePostsBySlug(slug string, posts models.Posts) (models.Posts, int) {
+// PostsFilter checks a batch of posts against the rules of the forum they go
+// to, masking messages and marking held posts in place. It runs inside the
+// create transaction tx and reads what it needs through it. A status other
+// than OK stops the batch and is what the create call returns.
+type PostsFilter func(tx *Tx, forumId string, posts models.Posts) int
+
+func (db *DB) CreatePostsBySlug(slug string, posts models.Posts, check PostsFilter) (_ models.Posts, status int) {
+	defer db.track("CreatePostsBySlug", &status)()
 	tx, err := db.StartTransaction()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Posts{}, DBError
 	}
 	defer tx.Rollback()
@@ -128,70 +150,14 @@ func (db *DB) CreatePostsBySlug(slug string, posts models.Posts) (models.Posts,
 	if retVal != OK {
 		return nil, retVal
 	}
-	postsToReturn := make(models.Posts, 0)
-	currentTime := time.Now()
-	timeString := currentTime.Format(time.RFC3339)
-	authors := make([]string, 0)
-	_, err = tx.Prepare("insert_posts", InsertPost)
-	for _, post := range posts {
-		ifUserExist, err := IsUserExist(tx, post.Author)
-		if post.Parent != 0 {
-			ifParentExist := false
-			err := tx.QueryRow("SELECT true FROM POSTS WHERE id = $1 AND thread = $2", post.Parent, threadId).Scan(&ifParentExist)
-			if err == pgx.ErrNoRows {
-				return nil, Conflict
-			}
-			if err != nil {
-				return nil, DBError
-			}
-			if !ifParentExist {
-				return nil, Conflict
-			}
-		}
-
-		if !ifUserExist {
-			return nil, EmptyResult
-		}
-		curPost := models.Post{}
-		timeStamp := time.Time{}
-		err = tx.QueryRow("insert_posts", post.Message, forumId, threadId, post.Author, post.Parent,
-			timeString).Scan(&curPost.ID, &curPost.Author, &timeStamp,
-			&curPost.Forum, &curPost.Message, &curPost.Parent, &curPost.Thread, &curPost.IsEdited)
-		if err != nil {
-			return nil, DBError
-		}
-		curPost.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
-		postsToReturn = append(postsToReturn, &curPost)
-		authors = append(authors, curPost.Author)
-	}
-	postsLen := len(postsToReturn)
-	if postsLen > 0 {
-		_, err = tx.Exec("UPDATE forum SET posts_count = posts_count + $1 WHERE slug = $2", len(postsToReturn), postsToReturn[0].Forum)
-		if err != nil {
-			return nil, DBError
-		}
-		_, err := tx.Prepare("insert_authors", "INSERT INTO forum_to_users(forum, user_nick) VALUES ($1, $2) ON CONFLICT DO NOTHING;")
-		if err != nil {
-			return nil, DBError
-		}
-		for _, author := range authors {
-			_, err = tx.Exec("insert_authors", forumId, author)
-			if err != nil {
-				return nil, DBError
-			}
-		}
-	}
-	err = tx.Commit()
-	if err != nil {
-		return nil, DBError
-	}
-
-	return postsToReturn, OK
+	return db.insertPosts(tx, forumId, threadId, posts, check)
 }
 
-func (db *DB) CreatePostsById(id string, posts models.Posts) (models.Posts, int) {
+func (db *DB) CreatePostsById(id string, posts models.Posts, check PostsFilter) (_ models.Posts, status int) {
+	defer db.track("CreatePostsById", &status)()
 	tx, err := db.StartTransaction()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Posts{}, DBError
 	}
 	defer tx.Rollback()
@@ -199,23 +165,52 @@ func (db *DB) CreatePostsById(id string, posts models.Posts) (models.Posts, int)
 	if retVal != OK {
 		return nil, retVal
 	}
+	threadId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, EmptyResult
+	}
+	return db.insertPosts(tx, forumId, threadId, posts, check)
+}
+
+// insertPosts checks the batch of posts with check, if given, creates them in
+// the thread and commits tx. Posts held by a filter rule and posts of
+// untrusted authors in premoderated forums go to the moderation queue instead.
+func (db *DB) insertPosts(tx *Tx, forumId string, threadId int, posts models.Posts, check PostsFilter) (models.Posts, int) {
+	if check != nil {
+		stat := check(tx, forumId, posts)
+		if stat != OK {
+			return nil, stat
+		}
+	}
 	postsToReturn := make(models.Posts, 0)
 	currentTime := time.Now()
 	timeString := currentTime.Format(time.RFC3339)
 	authors := make([]string, 0)
-	_, err = tx.Prepare("insert_posts", InsertPost)
+	_, err := tx.Prepare("insert_posts", InsertPost)
+	if err != nil {
+		db.logError("insert_posts", err)
+		return nil, DBError
+	}
+	settings, retVal := GetForumSettings(tx, forumId)
+	if retVal != OK {
+		return nil, retVal
+	}
+	banned := make(map[string]bool)
+	trusted := make(map[string]bool)
 	for _, post := range posts {
 		ifUserExist, err := IsUserExist(tx, post.Author)
 		if err != nil {
+			db.logError("isUserExist", err)
 			return nil, DBError
 		}
 		if post.Parent != 0 {
 			ifParentExist := false
-			err := tx.QueryRow("SELECT true FROM POSTS WHERE id = $1 AND thread = $2", post.Parent, id).Scan(&ifParentExist)
+			err := tx.QueryRow("SELECT true FROM POSTS WHERE id = $1 AND thread = $2", post.Parent, threadId).Scan(&ifParentExist)
 			if err == pgx.ErrNoRows {
 				return nil, Conflict
 			}
 			if err != nil {
+				db.logError("checkParent", err)
 				return nil, DBError
 			}
 			if !ifParentExist {
@@ -225,46 +220,102 @@ func (db *DB) CreatePostsById(id string, posts models.Posts) (models.Posts, int)
 		if !ifUserExist {
 			return nil, EmptyResult
 		}
+		ifBanned, ok := banned[post.Author]
+		if !ok {
+			ifBanned, err = IsUserBanned(tx, forumId, post.Author)
+			if err != nil {
+				return nil, DBError
+			}
+			banned[post.Author] = ifBanned
+		}
+		if ifBanned {
+			return nil, Forbidden
+		}
+		ifHeld := post.Hold
+		if !ifHeld && settings.Premoderation {
+			ifTrusted, ok := trusted[post.Author]
+			if !ok {
+				ifTrusted, err = IsTrustedAuthor(tx, forumId, post.Author, settings.TrustedAfter)
+				if err != nil {
+					return nil, DBError
+				}
+				trusted[post.Author] = ifTrusted
+			}
+			ifHeld = !ifTrusted
+		}
+		if ifHeld {
+			pendingPost, retVal := insertPendingPost(tx, forumId, threadId, post, timeString)
+			if retVal != OK {
+				return nil, retVal
+			}
+			if len(post.Attachments) > 0 {
+				pendingPost.Attachments, retVal = claimAttachments(tx, pendingPost.ID, true, post.Author, post.Attachments)
+				if retVal != OK {
+					return nil, retVal
+				}
+			}
+			postsToReturn = append(postsToReturn, pendingPost)
+			continue
+		}
 		curPost := models.Post{}
 		timeStamp := time.Time{}
-		err = tx.QueryRow("insert_posts", post.Message, forumId, id, post.Author, post.Parent,
-			timeString).Scan(&curPost.ID, &curPost.Author, &timeStamp,
-			&curPost.Forum, &curPost.Message, &curPost.Parent, &curPost.Thread, &curPost.IsEdited)
+		err = tx.QueryRow("insert_posts", post.Message, forumId, threadId, post.Author, post.Parent,
+			timeString, markdown.Render(post.Message)).Scan(&curPost.ID, &curPost.Author, &timeStamp,
+			&curPost.Forum, &curPost.Message, &curPost.Parent, &curPost.Thread, &curPost.IsEdited, &curPost.MessageHTML)
 		if err != nil {
+			db.logError("insert_posts", err)
 			return nil, DBError
 		}
 		curPost.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		if len(post.Attachments) > 0 {
+			curPost.Attachments, retVal = claimAttachments(tx, curPost.ID, false, post.Author, post.Attachments)
+			if retVal != OK {
+				return nil, retVal
+			}
+		}
 		postsToReturn = append(postsToReturn, &curPost)
 		authors = append(authors, curPost.Author)
 	}
-	postsLen := len(postsToReturn)
-	if postsLen > 0 {
-		_, err = tx.Exec("UPDATE forum SET posts_count = posts_count + $1 WHERE slug = $2", len(postsToReturn), postsToReturn[0].Forum)
+	if len(authors) > 0 {
+		err = addForumPosts(tx, forumId, authors)
 		if err != nil {
+			db.logError("addForumPosts", err)
 			return nil, DBError
 		}
-		_, err := tx.Prepare("insert_authors", "INSERT INTO forum_to_users(forum, user_nick) VALUES ($1, $2) ON CONFLICT DO NOTHING;")
-		if err != nil {
-			return nil, DBError
-		}
-		for _, author := range authors {
-			_, err = tx.Exec("insert_authors", forumId, author)
-			if err != nil {
-				return nil, DBError
-			}
-		}
 	}
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return nil, DBError
 	}
+	db.countPosts(len(authors), len(postsToReturn)-len(authors))
 	return postsToReturn, OK
 }
 
+// addForumPosts updates the forum counters after its posts by authors were published.
+func addForumPosts(tx *Tx, forumId string, authors []string) error {
+	_, err := tx.Exec("UPDATE forum SET posts_count = posts_count + $1 WHERE slug = $2", len(authors), forumId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Prepare("insert_authors", "INSERT INTO forum_to_users(forum, user_nick) VALUES ($1, $2) ON CONFLICT DO NOTHING;")
+	if err != nil {
+		return err
+	}
+	for _, author := range authors {
+		_, err = tx.Exec("insert_authors", forumId, author)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *DB) GetPostsBySlug(slug string, limit string, since string,
-	sort string, desc string) (models.Posts, int) {
+	sort string, desc string) (_ models.Posts, status int) {
+	defer db.track("GetPostsBySlug", &status)()
 	id := 0
-	row := db.db.QueryRow(getThreadIdBySlug, slug)
+	row := db.sql().QueryRow(getThreadIdBySlug, slug)
 	err := row.Scan(&id)
 	if err == pgx.ErrNoRows {
 		return nil, EmptyResult
@@ -272,48 +323,52 @@ func (db *DB) GetPostsBySlug(slug string, limit string, since string,
 	if err != nil {
 		return nil, DBError
 	}
-	switch sort {
-	case "flat":
-		return db.GetPostsFlat(strconv.Itoa(id), limit, since, desc)
-	case "tree":
-		return db.GetPostsTree(strconv.Itoa(id), limit, since, desc)
-	case "parent_tree":
-		return db.GetPostsParentTree(strconv.Itoa(id), limit, since, desc)
-	}
-	return models.Posts{}, OK
+	return db.getThreadPosts(strconv.Itoa(id), limit, since, sort, desc)
 }
 
 func (db *DB) GetPostsById(id string, limit string, since string,
-	sort string, desc string) (models.Posts, int) {
+	sort string, desc string) (_ models.Posts, status int) {
+	defer db.track("GetPostsById", &status)()
 	ifThreadExists := false
-	err := db.db.QueryRow("SELECT true FROM threads WHERE id = $1", id).Scan(&ifThreadExists)
+	err := db.sql().QueryRow("SELECT true FROM threads WHERE id = $1", id).Scan(&ifThreadExists)
 	if err == pgx.ErrNoRows {
 		return models.Posts{}, EmptyResult
 	}
 	if err != nil {
+		db.logError("checkThread", err)
 		return nil, DBError
 	}
 	if !ifThreadExists {
 		return models.Posts{}, EmptyResult
 	}
+	return db.getThreadPosts(id, limit, since, sort, desc)
+}
+
+func (db *DB) getThreadPosts(id string, limit string, since string,
+	sort string, desc string) (models.Posts, int) {
+	posts, stat := models.Posts{}, OK
 	switch sort {
 	case "flat":
-		return db.GetPostsFlat(id, limit, since, desc)
+		posts, stat = db.GetPostsFlat(id, limit, since, desc)
 	case "tree":
-		return db.GetPostsTree(id, limit, since, desc)
+		posts, stat = db.GetPostsTree(id, limit, since, desc)
 	case "parent_tree":
-		return db.GetPostsParentTree(id, limit, since, desc)
+		posts, stat = db.GetPostsParentTree(id, limit, since, desc)
+	}
+	if stat != OK {
+		return posts, stat
 	}
-	return models.Posts{}, OK
+	return posts, db.fillAttachments(posts)
 }
 
-func (db *DB) GetPostsFlat(id string, limit string, since string, desc string) (models.Posts, int) {
+func (db *DB) GetPostsFlat(id string, limit string, since string, desc string) (_ models.Posts, status int) {
+	defer db.track("GetPostsFlat", &status)()
 	ifDesc, _ := strconv.ParseBool(desc)
 	strDesc := "ASC"
 	if ifDesc {
 		strDesc = "DESC"
 	}
-	rows := &pgx.Rows{}
+	rows := &Rows{}
 	err := errors.New("")
 	if since != "" {
 		actualSince := ""
@@ -323,12 +378,13 @@ func (db *DB) GetPostsFlat(id string, limit string, since string, desc string) (
 			actualSince = fmt.Sprintf(GetPostsFlatSincePart, ">")
 		}
 		query := fmt.Sprintf(GetPostsFlatPart1, actualSince, strDesc) + GetPostsFlatPart2
-		rows, err = db.db.Query(fmt.Sprintf(query, strDesc), id, limit, since)
+		rows, err = db.sql().Query(fmt.Sprintf(query, strDesc), id, limit, since)
 	} else {
 		query := fmt.Sprintf(GetPostsFlatPart1, "", strDesc) + GetPostsFlatPart2
-		rows, err = db.db.Query(fmt.Sprintf(query, strDesc), id, limit)
+		rows, err = db.sql().Query(fmt.Sprintf(query, strDesc), id, limit)
 	}
 	if err != nil {
+		db.logError("getPostsFlat", err)
 		return nil, DBError
 	}
 	defer rows.Close()
@@ -336,24 +392,28 @@ func (db *DB) GetPostsFlat(id string, limit string, since string, desc string) (
 	for rows.Next() {
 		post := new(models.Post)
 		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
 		err := rows.Scan(&post.ID, &post.Author, &timeStamp, &post.Forum, &post.Message,
-			&post.Parent, &post.Thread, &post.IsEdited)
+			&post.Parent, &post.Thread, &post.IsEdited, &messageHtml)
 		if err != nil {
+			db.logError("getPostsFlat", err)
 			return models.Posts{}, DBError
 		}
 		post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		post.MessageHTML = renderedMessage(messageHtml, post.Message)
 		posts = append(posts, post)
 	}
 	return posts, OK
 }
 
-func (db *DB) GetPostsTree(id string, limit string, since string, desc string) (models.Posts, int) {
+func (db *DB) GetPostsTree(id string, limit string, since string, desc string) (_ models.Posts, status int) {
+	defer db.track("GetPostsTree", &status)()
 	ifDesc, _ := strconv.ParseBool(desc) // mb check error
 	strDesc := "ASC"
 	if ifDesc {
 		strDesc = "DESC"
 	}
-	rows := &pgx.Rows{}
+	rows := &Rows{}
 	err := errors.New("")
 	query := ""
 	if since != "" {
@@ -364,12 +424,13 @@ func (db *DB) GetPostsTree(id string, limit string, since string, desc string) (
 			actualSince = fmt.Sprintf(GetPostsTreeSincePart, ">")
 		}
 		query = fmt.Sprintf(GetPostsTree, actualSince, strDesc, strDesc)
-		rows, err = db.db.Query(query, id, limit, since)
+		rows, err = db.sql().Query(query, id, limit, since)
 	} else {
 		query = fmt.Sprintf(GetPostsTree, "", strDesc, strDesc)
-		rows, err = db.db.Query(query, id, limit)
+		rows, err = db.sql().Query(query, id, limit)
 	}
 	if err != nil {
+		db.logError("getPostsTree", err)
 		return nil, DBError
 	}
 	defer rows.Close()
@@ -377,20 +438,24 @@ func (db *DB) GetPostsTree(id string, limit string, since string, desc string) (
 	for rows.Next() {
 		post := new(models.Post)
 		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
 		err := rows.Scan(&post.ID, &post.Author, &timeStamp, &post.Forum, &post.Message,
-			&post.Parent, &post.Thread, &post.IsEdited)
+			&post.Parent, &post.Thread, &post.IsEdited, &messageHtml)
 		if err != nil {
+			db.logError("getPostsTree", err)
 			return models.Posts{}, DBError
 		}
 		post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		post.MessageHTML = renderedMessage(messageHtml, post.Message)
 		posts = append(posts, post)
 	}
 	return posts, OK
 }
 
-func (db *DB) GetPostsParentTree(id string, limit string, since string, desc string) (models.Posts, int) {
+func (db *DB) GetPostsParentTree(id string, limit string, since string, desc string) (_ models.Posts, status int) {
+	defer db.track("GetPostsParentTree", &status)()
 	ifDesc, _ := strconv.ParseBool(desc) // mb check error
-	rows := &pgx.Rows{}
+	rows := &Rows{}
 	err := errors.New("")
 	strDesc := "ASC"
 	if ifDesc {
@@ -405,12 +470,13 @@ func (db *DB) GetPostsParentTree(id string, limit string, since string, desc str
 			actualSince = fmt.Sprintf(ParentTreeSincePart, ">")
 		}
 		query = fmt.Sprintf(GetPostsParentTree, actualSince, strDesc) + fmt.Sprintf(GetPostsParentTreePart2Alt, strDesc)
-		rows, err = db.db.Query(query, id, limit, since)
+		rows, err = db.sql().Query(query, id, limit, since)
 	} else {
 		query = fmt.Sprintf(GetPostsParentTree, "", strDesc) + fmt.Sprintf(GetPostsParentTreePart2Alt, strDesc)
-		rows, err = db.db.Query(query, id, limit)
+		rows, err = db.sql().Query(query, id, limit)
 	}
 	if err != nil {
+		db.logError("getPostsParentTree", err)
 		return nil, DBError
 	}
 	defer rows.Close()
@@ -418,12 +484,15 @@ func (db *DB) GetPostsParentTree(id string, limit string, since string, desc str
 	for rows.Next() {
 		post := new(models.Post)
 		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
 		err := rows.Scan(&post.ID, &post.Author, &timeStamp, &post.Forum, &post.Message,
-			&post.Parent, &post.Thread, &post.IsEdited)
+			&post.Parent, &post.Thread, &post.IsEdited, &messageHtml)
 		if err != nil {
+			db.logError("getPostsParentTree", err)
 			return models.Posts{}, DBError
 		}
 		post.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		post.MessageHTML = renderedMessage(messageHtml, post.Message)
 		posts = append(posts, post)
 	}
 	return posts, OK
@@ -0,0 +1,36 @@
+package database
+
+const (
+	refilledTokens     = "LEAST($3::float8, r.tokens + EXTRACT(EPOCH FROM now() - r.updated) * $2::float8)"
+	takeRateLimitToken = "INSERT INTO rate_limits AS r (key, tokens, allowed, updated) VALUES($1, $3::float8 - 1, true, now()) " +
+		"ON CONFLICT (key) DO UPDATE SET " +
+		"tokens = CASE WHEN " + refilledTokens + " >= 1 THEN " + refilledTokens + " - 1 ELSE " + refilledTokens + " END, " +
+		"allowed = " + refilledTokens + " >= 1, updated = now() " +
+		"RETURNING allowed, tokens"
+	deleteStaleRateLimits = "DELETE FROM rate_limits WHERE updated < now() - $1::float8 * interval '1 second'"
+)
+
+// TakeRateLimitToken is the shared counterpart of the in-memory token bucket: it
+// refills the bucket of key, takes a token if there is one and returns whether
+// it did along with the tokens left.
+func (db *DB) TakeRateLimitToken(key string, rate float64, burst int) (_ bool, _ float64, failure error) {
+	defer db.trackErr("TakeRateLimitToken", &failure)()
+	allowed := false
+	tokens := float64(0)
+	err := db.sql().QueryRow(takeRateLimitToken, key, rate, float64(burst)).Scan(&allowed, &tokens)
+	if err != nil {
+		db.logError("takeRateLimitToken", err)
+		return false, 0, err
+	}
+	return allowed, tokens, nil
+}
+
+// DeleteStaleRateLimits drops buckets untouched for idleSeconds, long enough to be full again.
+func (db *DB) DeleteStaleRateLimits(idleSeconds float64) (failure error) {
+	defer db.trackErr("DeleteStaleRateLimits", &failure)()
+	_, err := db.sql().Exec(deleteStaleRateLimits, idleSeconds)
+	if err != nil {
+		db.logError("deleteStaleRateLimits", err)
+	}
+	return err
+}
@@ -0,0 +1,370 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"gopkg.in/jackc/pgx.v2"
+	"strconv"
+	"time"
+)
+
+const (
+	ItemPost   = "post"
+	ItemThread = "thread"
+
+	ActionDismiss = "dismiss"
+	ActionDelete  = "delete"
+	ActionBan     = "ban"
+	ActionUnban   = "unban"
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+)
+
+const (
+	getPostForumAndAuthor = "SELECT forum, author FROM posts WHERE id = $1"
+	getThreadForumAuthor  = "SELECT forum, author FROM threads WHERE id = $1"
+	createReport          = "INSERT INTO reports (kind, item_id, forum, reporter, reason) VALUES($1, $2, $3, $4, $5) " +
+		"ON CONFLICT (kind, item_id, reporter) WHERE NOT resolved DO NOTHING RETURNING id, created"
+	getOpenReport = "SELECT id, reason, created FROM reports " +
+		"WHERE kind = $1 AND item_id = $2 AND reporter = $3 AND NOT resolved"
+	getReportedItems = "SELECT kind, item_id, count(*), array_agg(reason ORDER BY created), min(created), max(created) " +
+		"FROM reports WHERE forum = $1 AND NOT resolved GROUP BY kind, item_id " +
+		"ORDER BY count(*) DESC, max(created) DESC LIMIT $2"
+	resolveReports      = "UPDATE reports SET resolved = true WHERE kind = $1 AND item_id = $2 AND NOT resolved"
+	resolvePostReports  = "UPDATE reports SET resolved = true WHERE kind = 'post' AND item_id = ANY($1) AND NOT resolved"
+	deletePostSubtree   = "DELETE FROM posts WHERE thread = $1 AND $2 = ANY(path) RETURNING id"
+	deleteThreadPosts   = "DELETE FROM posts WHERE thread = $1 RETURNING id"
+	deleteThreadVotes   = "DELETE FROM votes WHERE thread = $1"
+	deleteThreadPending = "DELETE FROM pending_posts WHERE thread = $1"
+	deleteThread        = "DELETE FROM threads WHERE id = $1"
+	decreasePostsCount  = "UPDATE forum SET posts_count = posts_count - $1 WHERE slug = $2"
+	decreaseThreadCount = "UPDATE forum SET threads_count = threads_count - 1 WHERE slug = $1"
+	logModerationAction = "INSERT INTO moderation_log (forum, moderator, action, kind, item_id, target, reason) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7)"
+	getModerationLog = "SELECT id, moderator, action, kind, item_id, target, reason, created FROM moderation_log " +
+		"WHERE forum = $1 AND id < $2 ORDER BY id DESC LIMIT $3"
+)
+
+func (db *DB) ReportPost(postId string, reporter string, reason string) (_ models.Report, status int) {
+	defer db.track("ReportPost", &status)()
+	id, err := strconv.ParseInt(postId, 10, 64)
+	if err != nil {
+		return models.Report{}, EmptyResult
+	}
+	return db.createReport(ItemPost, id, reporter, reason)
+}
+
+func (db *DB) ReportThreadById(threadId string, reporter string, reason string) (_ models.Report, status int) {
+	defer db.track("ReportThreadById", &status)()
+	id, err := strconv.ParseInt(threadId, 10, 64)
+	if err != nil {
+		return models.Report{}, EmptyResult
+	}
+	return db.createReport(ItemThread, id, reporter, reason)
+}
+
+func (db *DB) ReportThreadBySlug(slug string, reporter string, reason string) (_ models.Report, status int) {
+	defer db.track("ReportThreadBySlug", &status)()
+	id := 0
+	err := db.sql().QueryRow(getThreadIdBySlug, slug).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return models.Report{}, EmptyResult
+	}
+	if err != nil {
+		db.logError("getThreadIdBySlug", err)
+		return models.Report{}, DBError
+	}
+	return db.createReport(ItemThread, int64(id), reporter, reason)
+}
+
+func (db *DB) createReport(kind string, itemId int64, reporter string, reason string) (models.Report, int) {
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.Report{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, _, stat := getItemForumAndAuthor(tx, kind, itemId)
+	if stat != OK {
+		return models.Report{}, stat
+	}
+	report := models.Report{Forum: forumId, Item: itemId, Kind: kind, Reason: reason, Reporter: reporter}
+	created := time.Time{}
+	retStat := OK
+	err = tx.QueryRow(createReport, kind, itemId, forumId, reporter, reason).Scan(&report.ID, &created)
+	if err == pgx.ErrNoRows {
+		retStat = Conflict
+		err = tx.QueryRow(getOpenReport, kind, itemId, reporter).Scan(&report.ID, &report.Reason, &created)
+	}
+	if err != nil {
+		db.logError("getOpenReport", err)
+		return models.Report{}, DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return models.Report{}, DBError
+	}
+	report.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+	return report, retStat
+}
+
+// GetReportedItems lists the items of the forum with open reports, most reported first,
+// each with its posting context.
+func (db *DB) GetReportedItems(forumId string, limit string) (_ models.ReportedItems, status int) {
+	defer db.track("GetReportedItems", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return nil, stat
+	}
+	if limit == "" {
+		limit = "100"
+	}
+	rows, err := db.sql().Query(getReportedItems, forumId, limit)
+	if err != nil {
+		db.logError("getReportedItems", err)
+		return nil, DBError
+	}
+	items := models.ReportedItems{}
+	for rows.Next() {
+		item := &models.ReportedItem{Forum: forumId}
+		first := time.Time{}
+		last := time.Time{}
+		err := rows.Scan(&item.Kind, &item.ID, &item.Count, &item.Reasons, &first, &last)
+		if err != nil {
+			rows.Close()
+			db.logError("getReportedItems", err)
+			return models.ReportedItems{}, DBError
+		}
+		item.FirstReported = first.Format("2006-01-02T15:04:05.999999999Z07:00")
+		item.LastReported = last.Format("2006-01-02T15:04:05.999999999Z07:00")
+		items = append(items, item)
+	}
+	rows.Close()
+	for _, item := range items {
+		itemId := strconv.FormatInt(item.ID, 10)
+		if item.Kind == ItemPost {
+			post, stat := db.GetPostInfo(itemId, []string{"user", "thread"})
+			if stat == DBError {
+				return models.ReportedItems{}, DBError
+			}
+			if stat == OK {
+				item.Post = &post
+			}
+			continue
+		}
+		thread, stat := db.GetThreadById(itemId)
+		if stat == DBError {
+			return models.ReportedItems{}, DBError
+		}
+		if stat == OK {
+			item.Thread = &thread
+		}
+	}
+	return items, OK
+}
+
+// ResolveReports closes the open reports of the item with one of the moderation
+// actions and records it in the moderation log. Any other action is Invalid.
+func (db *DB) ResolveReports(forumId string, kind string, itemId string, moderator string,
+	resolution models.ReportResolution, banExpires time.Time) (_ models.ModerationAction, status int) {
+	defer db.track("ResolveReports", &status)()
+	id, err := strconv.ParseInt(itemId, 10, 64)
+	if err != nil {
+		return models.ModerationAction{}, EmptyResult
+	}
+	tx, err := db.StartTransaction()
+	if err != nil {
+		db.logError("begin", err)
+		return models.ModerationAction{}, DBError
+	}
+	defer tx.Rollback()
+	forumId, stat := GetForumId(tx, forumId)
+	if stat != OK {
+		return models.ModerationAction{}, stat
+	}
+	itemForum, author, stat := getItemForumAndAuthor(tx, kind, id)
+	if stat != OK {
+		return models.ModerationAction{}, stat
+	}
+	if itemForum != forumId {
+		return models.ModerationAction{}, EmptyResult
+	}
+	switch resolution.Action {
+	case ActionDismiss:
+	case ActionDelete:
+		if kind == ItemPost {
+			stat = deletePost(tx, forumId, id)
+		} else {
+			stat = deleteThreadWithPosts(tx, forumId, id)
+		}
+	case ActionBan:
+		nullExpires := pgx.NullTime{Time: banExpires, Valid: !banExpires.IsZero()}
+		_, err = tx.Exec(banUser, forumId, author, resolution.Reason, moderator, nullExpires)
+		if err != nil {
+			db.logError("banUser", err)
+			stat = DBError
+		}
+	default:
+		return models.ModerationAction{}, Invalid
+	}
+	if stat != OK {
+		return models.ModerationAction{}, stat
+	}
+	_, err = tx.Exec(resolveReports, kind, id)
+	if err != nil {
+		db.logError("resolveReports", err)
+		return models.ModerationAction{}, DBError
+	}
+	action := models.ModerationAction{
+		Action:    resolution.Action,
+		Forum:     forumId,
+		Item:      id,
+		Kind:      kind,
+		Moderator: moderator,
+		Reason:    resolution.Reason,
+		Target:    author,
+	}
+	err = LogModerationAction(tx, action)
+	if err != nil {
+		return models.ModerationAction{}, DBError
+	}
+	err = tx.Commit()
+	if err != nil {
+		db.logError("commit", err)
+		return models.ModerationAction{}, DBError
+	}
+	return action, OK
+}
+
+func LogModerationAction(tx *Tx, action models.ModerationAction) error {
+	_, err := tx.Exec(logModerationAction, action.Forum, action.Moderator, action.Action,
+		action.Kind, action.Item, action.Target, action.Reason)
+	if err != nil {
+		logStorageError("logModerationAction", err)
+	}
+	return err
+}
+
+func (db *DB) GetModerationLog(forumId string, limit string, since string) (_ models.ModerationActions, status int) {
+	defer db.track("GetModerationLog", &status)()
+	forumId, stat := db.getForumId(forumId)
+	if stat != OK {
+		return nil, stat
+	}
+	if limit == "" {
+		limit = "100"
+	}
+	if since == "" {
+		since = strconv.FormatInt(1<<62, 10)
+	}
+	rows, err := db.sql().Query(getModerationLog, forumId, since, limit)
+	if err != nil {
+		db.logError("getModerationLog", err)
+		return nil, DBError
+	}
+	defer rows.Close()
+	actions := models.ModerationActions{}
+	for rows.Next() {
+		action := &models.ModerationAction{Forum: forumId}
+		created := time.Time{}
+		err := rows.Scan(&action.ID, &action.Moderator, &action.Action, &action.Kind,
+			&action.Item, &action.Target, &action.Reason, &created)
+		if err != nil {
+			db.logError("getModerationLog", err)
+			return models.ModerationActions{}, DBError
+		}
+		action.Created = created.Format("2006-01-02T15:04:05.999999999Z07:00")
+		actions = append(actions, action)
+	}
+	return actions, OK
+}
+
+func getItemForumAndAuthor(tx *Tx, kind string, itemId int64) (string, string, int) {
+	query := getPostForumAndAuthor
+	if kind == ItemThread {
+		query = getThreadForumAuthor
+	}
+	forumId := ""
+	author := ""
+	err := tx.QueryRow(query, itemId).Scan(&forumId, &author)
+	if err == pgx.ErrNoRows {
+		return "", "", EmptyResult
+	}
+	if err != nil {
+		logStorageError("getItemForumAndAuthor", err)
+		return "", "", DBError
+	}
+	return forumId, author, OK
+}
+
+// deletePost removes the post together with its replies.
+func deletePost(tx *Tx, forumId string, postId int64) int {
+	thread := int32(0)
+	err := tx.QueryRow("SELECT thread FROM posts WHERE id = $1", postId).Scan(&thread)
+	if err != nil {
+		logStorageError("deletePost", err)
+		return DBError
+	}
+	deleted, err := collectIds(tx, deletePostSubtree, thread, postId)
+	if err != nil {
+		return DBError
+	}
+	return afterPostsDeleted(tx, forumId, deleted)
+}
+
+func deleteThreadWithPosts(tx *Tx, forumId string, threadId int64) int {
+	deleted, err := collectIds(tx, deleteThreadPosts, threadId)
+	if err != nil {
+		return DBError
+	}
+	for _, query := range []string{deleteThreadVotes, deleteThreadPending, deleteThread} {
+		_, err = tx.Exec(query, threadId)
+		if err != nil {
+			logStorageError("deleteThreadWithPosts", err)
+			return DBError
+		}
+	}
+	_, err = tx.Exec(decreaseThreadCount, forumId)
+	if err != nil {
+		logStorageError("decreaseThreadCount", err)
+		return DBError
+	}
+	return afterPostsDeleted(tx, forumId, deleted)
+}
+
+func afterPostsDeleted(tx *Tx, forumId string, deleted []int64) int {
+	if len(deleted) == 0 {
+		return OK
+	}
+	_, err := tx.Exec(decreasePostsCount, len(deleted), forumId)
+	if err != nil {
+		logStorageError("decreasePostsCount", err)
+		return DBError
+	}
+	_, err = tx.Exec(resolvePostReports, deleted)
+	if err != nil {
+		logStorageError("resolvePostReports", err)
+		return DBError
+	}
+	return OK
+}
+
+func collectIds(tx *Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		logStorageError("collectIds", err)
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		id := int64(0)
+		err := rows.Scan(&id)
+		if err != nil {
+			logStorageError("collectIds", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -2,42 +2,83 @@ package database
 
 import (
 	"github.com/sergeychur/technopark_db/internal/models"
-	"log"
 )
 
 const (
-	TruncateAllTables = "TRUNCATE votes, posts, threads, forum, users"
-	GetDBInfo         = "SELECT count_forum, count_post, count_thread, count_user FROM " +
+	TruncateAllTables = "TRUNCATE votes, posts, threads, forum, users, user_credentials, forum_moderators, " +
+		"forum_bans, forum_settings, pending_posts, reports, moderation_log, filter_rules, idempotency_keys, " +
+		"attachments, rate_limits"
+	// no upload can start or finish while the keys of the blobs are collected
+	LockAttachments    = "LOCK TABLE attachments IN ACCESS EXCLUSIVE MODE"
+	GetAttachmentsKeys = "SELECT blob_key FROM attachments"
+	// admin_credentials is never cleared and the admins keep their tokens
+	DeleteNonAdminTokens = "DELETE FROM auth_tokens " +
+		"WHERE lower(user_nick) NOT IN (SELECT lower(user_nick) FROM admin_credentials)"
+	GetDBInfo = "SELECT count_forum, count_post, count_thread, count_user FROM " +
 		"(SELECT COUNT(*) AS count_forum FROM forum) AS count1, " +
 		"(SELECT COUNT(*) AS count_post FROM posts) AS count2, " +
 		"(SELECT COUNT(*) AS count_thread FROM threads) AS count3, " +
 		"(SELECT COUNT(*) AS count_user FROM users) AS count4"
 )
 
-func (db *DB) ClearDB() error {
+// ClearDB empties the tables and returns the keys of the blobs the removed
+// attachments were stored under, for the caller to delete.
+func (db *DB) ClearDB() (_ []string, failure error) {
+	defer db.trackErr("ClearDB", &failure)()
 	tx, err := db.StartTransaction()
 	if err != nil {
-		log.Println(err)
-		return err
+		db.logError("begin", err)
+		return nil, err
 	}
 	defer tx.Rollback()
+	_, err = tx.Exec(LockAttachments)
+	if err != nil {
+		db.logError("lockAttachments", err)
+		return nil, err
+	}
+	rows, err := tx.Query(GetAttachmentsKeys)
+	if err != nil {
+		db.logError("getAttachmentsKeys", err)
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for rows.Next() {
+		key := ""
+		err = rows.Scan(&key)
+		if err != nil {
+			rows.Close()
+			db.logError("getAttachmentsKeys", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
 	_, err = tx.Exec(TruncateAllTables)
 
 	if err != nil {
-		log.Println(err)
-		return err
+		db.logError("truncateAllTables", err)
+		return nil, err
+	}
+	_, err = tx.Exec(DeleteNonAdminTokens)
+	if err != nil {
+		db.logError("deleteNonAdminTokens", err)
+		return nil, err
 	}
 	err = tx.Commit()
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
 }
 
-func (db *DB) GetDBInfo() (models.Status, int) {
-	row := db.db.QueryRow(GetDBInfo)
-	status := models.Status{}
-	err := row.Scan(&status.Forum, &status.Post, &status.Thread, &status.User)
+func (db *DB) GetDBInfo() (_ models.Status, status int) {
+	defer db.track("GetDBInfo", &status)()
+	row := db.sql().QueryRow(GetDBInfo)
+	info := models.Status{}
+	err := row.Scan(&info.Forum, &info.Post, &info.Thread, &info.User)
 	if err != nil {
-		log.Println(err.Error())
-		return status, DBError
+		db.logError("getDBInfo", err)
+		return info, DBError
 	}
-	return status, OK
+	return info, OK
 }
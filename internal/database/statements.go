@@ -0,0 +1,108 @@
+package database
+
+// statementNames maps the text of each statement kept in a constant to the
+// name its errors are logged under, so that spans and logs agree.
+var statementNames = map[string]string{
+	addForumModerator:            "addForumModerator",
+	banUser:                      "banUser",
+	claimIdempotencyKey:          "claimIdempotencyKey",
+	completeIdempotencyKey:       "completeIdempotencyKey",
+	countFreeAttachments:         "countFreeAttachments",
+	createAttachment:             "createAttachment",
+	createCredentials:            "createCredentials",
+	createFilterRule:             "createFilterRule",
+	CreateForum:                  "createForum",
+	createMigrationsTable:        "createMigrationsTable",
+	createPendingPost:            "createPendingPost",
+	createReport:                 "createReport",
+	createThread:                 "createThread",
+	createThreadWithTime:         "createThreadWithTime",
+	createToken:                  "createToken",
+	createUser:                   "createUser",
+	decreasePostsCount:           "decreasePostsCount",
+	decreaseThreadCount:          "decreaseThreadCount",
+	deleteExpiredIdempotencyKeys: "deleteExpiredIdempotencyKeys",
+	deleteFilterRule:             "deleteFilterRule",
+	DeleteNonAdminTokens:         "deleteNonAdminTokens",
+	deleteOrphanAttachment:       "deleteOrphanAttachment",
+	deleteOwnAttachment:          "deleteOwnAttachment",
+	deleteStaleRateLimits:        "deleteStaleRateLimits",
+	deleteToken:                  "deleteToken",
+	deleteTokenByHash:            "deleteTokenByHash",
+	deleteUserTokens:             "deleteUserTokens",
+	exportForum:                  "exportForum",
+	exportPosts:                  "exportPosts",
+	exportThreads:                "exportThreads",
+	exportUsers:                  "exportUsers",
+	exportVotes:                  "exportVotes",
+	findImportUser:               "findImportUser",
+	getAdminCredentials:          "getAdminCredentials",
+	getAttachment:                "getAttachment",
+	GetAttachmentsKeys:           "getAttachmentsKeys",
+	getCredentials:               "getCredentials",
+	GetDBInfo:                    "getDBInfo",
+	getFilterRules:               "getFilterRules",
+	GetForum:                     "getForum",
+	getForumBans:                 "getForumBans",
+	getForumId:                   "getForumId",
+	getForumModerator:            "getForumModerator",
+	getForumModerators:           "getForumModerators",
+	getForumRole:                 "getForumRole",
+	getForumSettings:             "getForumSettings",
+	getForumsBySlugs:             "getForumsBySlugs",
+	getIdempotencyKey:            "getIdempotencyKey",
+	getModerationLog:             "getModerationLog",
+	getOpenReport:                "getOpenReport",
+	getOrphanAttachments:         "getOrphanAttachments",
+	getPendingPosts:              "getPendingPosts",
+	GetPost:                      "getPost",
+	getPostsAttachments:          "getPostsAttachments",
+	getPostsByIds:                "getPostsByIds",
+	getPostsByParents:            "getPostsByParents",
+	getReportedItems:             "getReportedItems",
+	getSchemaVersion:             "getSchemaVersion",
+	getThreadById:                "getThreadById",
+	getThreadBySlug:              "getThreadBySlug",
+	getThreadForumById:           "getThreadForumById",
+	getThreadForumBySlug:         "getThreadForumBySlug",
+	getThreadIdBySlug:            "getThreadIdBySlug",
+	getThreadsByIds:              "getThreadsByIds",
+	getThreadsVotes:              "getThreadsVotes",
+	getTokenUser:                 "getTokenUser",
+	getUserByNick:                "getUserByNick",
+	getUserCreated:               "getUserCreated",
+	getUserNick:                  "getUserNick",
+	getUserTokens:                "getUserTokens",
+	getUsersByEmailOrNick:        "getUsersByEmailOrNick",
+	getUsersByNicks:              "getUsersByNicks",
+	hasAdminCredentials:          "hasAdminCredentials",
+	hasRecentDuplicate:           "hasRecentDuplicate",
+	importPost:                   "importPost",
+	importVote:                   "importVote",
+	InsertPost:                   "insertPost",
+	isEmailTaken:                 "isEmailTaken",
+	isMigrationApplied:           "isMigrationApplied",
+	isTrustedAuthor:              "isTrustedAuthor",
+	isUserBanned:                 "isUserBanned",
+	LockAttachments:              "lockAttachments",
+	lockAuthors:                  "lockAuthors",
+	lockMigrations:               "lockMigrations",
+	logModerationAction:          "logModerationAction",
+	markMigrationApplied:         "markMigrationApplied",
+	publishPendingAttachments:    "publishPendingAttachments",
+	releaseIdempotencyKey:        "releaseIdempotencyKey",
+	removeForumModerator:         "removeForumModerator",
+	resolvePostReports:           "resolvePostReports",
+	resolveReports:               "resolveReports",
+	setAdminCredentials:          "setAdminCredentials",
+	setForumSettings:             "setForumSettings",
+	takePendingPost:              "takePendingPost",
+	takeRateLimitToken:           "takeRateLimitToken",
+	TruncateAllTables:            "truncateAllTables",
+	unbanUser:                    "unbanUser",
+	UpdatePost:                   "updatePost",
+	updateThreadById:             "updateThreadById",
+	updateThreadBySlug:           "updateThreadBySlug",
+	updateUser:                   "updateUser",
+	voteThread:                   "voteThread",
+}
@@ -3,24 +3,29 @@ package database
 import (
 	"errors"
 	"fmt"
+	"github.com/sergeychur/technopark_db/internal/markdown"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"gopkg.in/jackc/pgx.v2"
-	"log"
 	"strconv"
 	"time"
 )
 
 const (
-	createThread         = "INSERT INTO threads (slug, title, author, forum, message) VALUES($1, $2, $3, $4, $5) RETURNING id"
-	createThreadWithTime = "INSERT INTO threads (slug, created, title, author, forum, message) VALUES($1, $2, $3, $4, $5, $6) RETURNING id"
-	getThreadBySlug      = "SELECT * FROM threads WHERE slug = $1"
-	getThreadById        = "SELECT * FROM threads WHERE id = $1"
-	getForumThreadsPart1 = "SELECT * FROM threads WHERE forum = $1 "
+	createThread = "INSERT INTO threads (slug, title, author, forum, message, message_html) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id"
+	createThreadWithTime = "INSERT INTO threads (slug, created, title, author, forum, message, message_html) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	threadColumns        = "SELECT id, author, created, forum, message, slug, title, votes, message_html FROM threads "
+	getThreadBySlug      = threadColumns + "WHERE slug = $1"
+	getThreadById        = threadColumns + "WHERE id = $1"
+	getForumThreadsPart1 = threadColumns + "WHERE forum = $1 "
 	sincePart            = "AND created %s $2 "
 	getForumThreadsPart2 = "ORDER BY created %s LIMIT "
-	updateThreadBySlug   = "UPDATE threads SET message=CASE $1 WHEN '' THEN message ELSE $1 END, title=CASE $2 WHEN '' THEN title ELSE $2 END WHERE slug=$3"
-	updateThreadById     = "UPDATE threads SET message=CASE $1 WHEN '' THEN message ELSE $1 END, title=CASE $2 WHEN '' THEN title ELSE $2 END WHERE id=$3"
-	voteThread           = "INSERT INTO votes(thread, author, is_like) VALUES($1, $2, $3) ON CONFLICT (thread, author) " +
+	updateThreadBySlug   = "UPDATE threads SET message=CASE $1 WHEN '' THEN message ELSE $1 END, " +
+		"message_html=CASE $1 WHEN '' THEN message_html ELSE $4 END, title=CASE $2 WHEN '' THEN title ELSE $2 END WHERE slug=$3"
+	updateThreadById = "UPDATE threads SET message=CASE $1 WHEN '' THEN message ELSE $1 END, " +
+		"message_html=CASE $1 WHEN '' THEN message_html ELSE $4 END, title=CASE $2 WHEN '' THEN title ELSE $2 END WHERE id=$3"
+	voteThread = "INSERT INTO votes(thread, author, is_like) VALUES($1, $2, $3) ON CONFLICT (thread, author) " +
 		"DO UPDATE SET is_like = $3"
 )
 
@@ -29,16 +34,17 @@ const (
 	DISLIKE = false
 )
 
-func (db *DB) CreateThread(thread models.Thread, forumId string) (models.Thread, int) {
+func (db *DB) CreateThread(thread models.Thread, forumId string) (_ models.Thread, status int) {
+	defer db.track("CreateThread", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
-		log.Println(err)
+		db.logError("begin", err)
 		return models.Thread{}, DBError
 	}
 	ifExistsUser, err := IsUserExist(tx, thread.Author)
 	if err != nil {
-		log.Println(err.Error())
+		db.logError("isUserExist", err)
 		return models.Thread{}, DBError
 	}
 	forumId, stat := GetForumId(tx, forumId)
@@ -48,11 +54,18 @@ func (db *DB) CreateThread(thread models.Thread, forumId string) (models.Thread,
 	if !ifExistsUser || stat == EmptyResult {
 		return models.Thread{}, EmptyResult
 	}
+	ifBanned, err := IsUserBanned(tx, forumId, thread.Author)
+	if err != nil {
+		return models.Thread{}, DBError
+	}
+	if ifBanned {
+		return models.Thread{}, Forbidden
+	}
 	ifExistsThread := false
 	if thread.Slug != "" {
 		ifExistsThread, err = IsThreadExistBySlug(tx, thread.Slug)
 		if err != nil {
-			log.Println(err.Error())
+			db.logError("isThreadExistBySlug", err)
 			return models.Thread{}, DBError
 		}
 	}
@@ -68,26 +81,31 @@ func (db *DB) CreateThread(thread models.Thread, forumId string) (models.Thread,
 	if thread.Created != "" {
 		timeStamp, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", thread.Created)
 		row := tx.QueryRow(createThreadWithTime, thread.Slug, timeStamp,
-			thread.Title, thread.Author, forumId, thread.Message)
+			thread.Title, thread.Author, forumId, thread.Message, markdown.Render(thread.Message))
 		err = row.Scan(&insertedId)
 		if err != nil {
+			db.logError("createThreadWithTime", err)
 			return models.Thread{}, DBError
 		}
 	} else {
-		row := tx.QueryRow(createThread, thread.Slug, thread.Title, thread.Author, forumId, thread.Message)
+		row := tx.QueryRow(createThread, thread.Slug, thread.Title, thread.Author, forumId, thread.Message,
+			markdown.Render(thread.Message))
 		err := row.Scan(&insertedId)
 		if err != nil {
+			db.logError("createThread", err)
 			return models.Thread{}, DBError
 		}
 	}
 	if err != nil {
-		log.Println(err)
+		db.logError("createThread", err)
 		return models.Thread{}, Conflict
 	}
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return models.Thread{}, DBError
 	}
+	db.countThread()
 	if insertedId != -1 {
 		ID := strconv.Itoa(insertedId)
 		return db.GetThreadById(ID)
@@ -96,20 +114,22 @@ func (db *DB) CreateThread(thread models.Thread, forumId string) (models.Thread,
 }
 
 func (db *DB) GetForumThreads(forumId string, limit string,
-	since string, desc string) (models.Threads, int) {
+	since string, desc string) (_ models.Threads, status int) {
+	defer db.track("GetForumThreads", &status)()
 	ifExist := false
-	err := db.db.QueryRow("SELECT TRUE FROM forum where slug = $1", forumId).Scan(&ifExist)
+	err := db.sql().QueryRow("SELECT TRUE FROM forum where slug = $1", forumId).Scan(&ifExist)
 	if err == pgx.ErrNoRows {
 		return nil, EmptyResult
 	}
 	if err != nil {
+		db.logError("checkForum", err)
 		return nil, DBError
 	}
 	if !ifExist {
 		return nil, EmptyResult
 	}
 	query := ""
-	rows := &pgx.Rows{}
+	rows := &Rows{}
 	err = errors.New("")
 	actualSince := ""
 	if since != "" {
@@ -119,12 +139,13 @@ func (db *DB) GetForumThreads(forumId string, limit string,
 			actualSince = fmt.Sprintf(sincePart, "<=")
 		}
 		query = getForumThreadsPart1 + actualSince + getForumThreadsPart2 + "$3"
-		rows, err = db.db.Query(fmt.Sprintf(query, desc), forumId, since, limit)
+		rows, err = db.sql().Query(fmt.Sprintf(query, desc), forumId, since, limit)
 	} else {
 		query = getForumThreadsPart1 + getForumThreadsPart2 + "$2"
-		rows, err = db.db.Query(fmt.Sprintf(query, desc), forumId, limit)
+		rows, err = db.sql().Query(fmt.Sprintf(query, desc), forumId, limit)
 	}
 	if err != nil {
+		db.logError("getForumThreads", err)
 		return nil, DBError
 	}
 	defer rows.Close()
@@ -134,12 +155,15 @@ func (db *DB) GetForumThreads(forumId string, limit string,
 		i++
 		thread := new(models.Thread)
 		timeStamp := time.Time{}
+		messageHtml := pgx.NullString{}
 		err := rows.Scan(&thread.ID, &thread.Author, &timeStamp, &thread.Forum,
-			&thread.Message, &thread.Slug, &thread.Title, &thread.Votes)
+			&thread.Message, &thread.Slug, &thread.Title, &thread.Votes, &messageHtml)
 		if err != nil {
+			db.logError("getForumThreads", err)
 			return models.Threads{}, DBError
 		}
 		thread.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+		thread.MessageHTML = renderedMessage(messageHtml, thread.Message)
 		threads = append(threads, thread)
 	}
 	if i == 0 {
@@ -148,31 +172,37 @@ func (db *DB) GetForumThreads(forumId string, limit string,
 	return threads, OK
 }
 
-func (db *DB) GetThreadBySlug(slug string) (models.Thread, int) {
-	row := db.db.QueryRow(getThreadBySlug, slug)
+func (db *DB) GetThreadBySlug(slug string) (_ models.Thread, status int) {
+	defer db.track("GetThreadBySlug", &status)()
+	row := db.sql().QueryRow(getThreadBySlug, slug)
 	thread := models.Thread{}
 	timeStamp := time.Time{}
+	messageHtml := pgx.NullString{}
 	err := row.Scan(&thread.ID, &thread.Author, &timeStamp, &thread.Forum,
-		&thread.Message, &thread.Slug, &thread.Title, &thread.Votes)
+		&thread.Message, &thread.Slug, &thread.Title, &thread.Votes, &messageHtml)
 	if err == pgx.ErrNoRows {
 		return thread, EmptyResult
 	}
 	if err != nil {
-		log.Println(err.Error())
+		db.logError("getThreadBySlug", err)
 		return thread, DBError
 	}
 	thread.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+	thread.MessageHTML = renderedMessage(messageHtml, thread.Message)
 	return thread, OK
 }
 
-func (db *DB) GetThreadById(id string) (models.Thread, int) {
-	row := db.db.QueryRow(getThreadById, id)
+func (db *DB) GetThreadById(id string) (_ models.Thread, status int) {
+	defer db.track("GetThreadById", &status)()
+	row := db.sql().QueryRow(getThreadById, id)
 	thread := models.Thread{}
 	slug := pgx.NullString{}
 	timeStamp := time.Time{}
+	messageHtml := pgx.NullString{}
 	err := row.Scan(&thread.ID, &thread.Author, &timeStamp, &thread.Forum,
-		&thread.Message, &slug, &thread.Title, &thread.Votes)
+		&thread.Message, &slug, &thread.Title, &thread.Votes, &messageHtml)
 	thread.Created = timeStamp.Format("2006-01-02T15:04:05.999999999Z07:00")
+	thread.MessageHTML = renderedMessage(messageHtml, thread.Message)
 	if slug.Valid {
 		thread.Slug = slug.String
 	}
@@ -180,62 +210,72 @@ func (db *DB) GetThreadById(id string) (models.Thread, int) {
 		return thread, EmptyResult
 	}
 	if err != nil {
-		log.Println(err.Error())
+		db.logError("getThreadById", err)
 		return thread, DBError
 	}
 	return thread, OK
 }
 
-func (db *DB) UpdateThreadBySlug(slug string, update models.ThreadUpdate) (models.Thread, int) {
+func (db *DB) UpdateThreadBySlug(slug string, update models.ThreadUpdate) (_ models.Thread, status int) {
+	defer db.track("UpdateThreadBySlug", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Thread{}, DBError
 	}
 	ifThreadExist, err := IsThreadExistBySlug(tx, slug)
 	if !ifThreadExist {
 		return models.Thread{}, EmptyResult
 	}
-	_, err = tx.Exec(updateThreadBySlug, update.Message, update.Title, slug)
+	_, err = tx.Exec(updateThreadBySlug, update.Message, update.Title, slug, markdown.Render(update.Message))
 	if err != nil {
+		db.logError("updateThreadBySlug", err)
 		return models.Thread{}, DBError
 	}
 
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return models.Thread{}, DBError
 	}
 
 	return db.GetThreadBySlug(slug)
 }
 
-func (db *DB) UpdateThreadById(id string, update models.ThreadUpdate) (models.Thread, int) {
+func (db *DB) UpdateThreadById(id string, update models.ThreadUpdate) (_ models.Thread, status int) {
+	defer db.track("UpdateThreadById", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Thread{}, DBError
 	}
 	ifThreadExist, err := IsThreadExistById(tx, id)
 	if !ifThreadExist {
 		return models.Thread{}, EmptyResult
 	}
-	_, err = tx.Exec(updateThreadById, update.Message, update.Title, id)
+	_, err = tx.Exec(updateThreadById, update.Message, update.Title, id, markdown.Render(update.Message))
 	if err != nil {
+		db.logError("updateThreadById", err)
 		return models.Thread{}, DBError
 	}
 
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return models.Thread{}, DBError
 	}
 
 	return db.GetThreadById(id)
 }
 
-func (db *DB) VoteBySlug(slug string, vote models.Vote) (models.Thread, int) {
+func (db *DB) VoteBySlug(slug string, vote models.Vote) (_ models.Thread, status int) {
+	defer db.track("VoteBySlug", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Thread{}, DBError
 	}
 	id, stat := GetThreadIdBySlug(tx, slug)
@@ -247,26 +287,35 @@ func (db *DB) VoteBySlug(slug string, vote models.Vote) (models.Thread, int) {
 	if !ifUserExist {
 		return models.Thread{}, EmptyResult
 	}
+	stat = checkVoterBan(tx, id, vote.Nickname)
+	if stat != OK {
+		return models.Thread{}, stat
+	}
 	voice := LIKE
 	if vote.Voice == -1 {
 		voice = DISLIKE
 	}
 	_, err = tx.Exec(voteThread, id, vote.Nickname, voice)
 	if err != nil {
+		db.logError("voteThread", err)
 		return models.Thread{}, DBError
 	}
 
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return models.Thread{}, DBError
 	}
+	db.countVote()
 	return db.GetThreadById(id)
 }
 
-func (db *DB) VoteById(id string, vote models.Vote) (models.Thread, int) {
+func (db *DB) VoteById(id string, vote models.Vote) (_ models.Thread, status int) {
+	defer db.track("VoteById", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
+		db.logError("begin", err)
 		return models.Thread{}, DBError
 	}
 	ifThreadExist, err := IsThreadExistById(tx, id)
@@ -277,18 +326,40 @@ func (db *DB) VoteById(id string, vote models.Vote) (models.Thread, int) {
 	if !ifUserExist {
 		return models.Thread{}, EmptyResult
 	}
+	stat := checkVoterBan(tx, id, vote.Nickname)
+	if stat != OK {
+		return models.Thread{}, stat
+	}
 	voice := LIKE
 	if vote.Voice == -1 {
 		voice = DISLIKE
 	}
 	_, err = tx.Exec(voteThread, id, vote.Nickname, voice)
 	if err != nil {
+		db.logError("voteThread", err)
 		return models.Thread{}, DBError
 	}
 
 	err = tx.Commit()
 	if err != nil {
+		db.logError("commit", err)
 		return models.Thread{}, DBError
 	}
+	db.countVote()
 	return db.GetThreadById(id)
 }
+
+func checkVoterBan(tx *Tx, threadId string, userNick string) int {
+	forumId, stat := GetThreadForumById(tx, threadId)
+	if stat != OK {
+		return stat
+	}
+	ifBanned, err := IsUserBanned(tx, forumId, userNick)
+	if err != nil {
+		return DBError
+	}
+	if ifBanned {
+		return Forbidden
+	}
+	return OK
+}
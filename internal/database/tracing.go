@@ -0,0 +1,186 @@
+package database
+
+import (
+	"github.com/sergeychur/technopark_db/internal/tracing"
+	"gopkg.in/jackc/pgx.v2"
+	"regexp"
+	"strings"
+)
+
+// WithSpan returns a copy of db whose storage calls are traced as children of
+// span. The copy belongs to one request and must not be shared between
+// goroutines, as each storage call makes its own span the parent of the
+// statements it runs for as long as it lasts.
+func (db *DB) WithSpan(span *tracing.Span) *DB {
+	scoped := *db
+	scoped.span = span
+	return &scoped
+}
+
+type queryer interface {
+	Query(sql string, args ...interface{}) (*pgx.Rows, error)
+	Exec(sql string, args ...interface{}) (pgx.CommandTag, error)
+}
+
+// statements runs SQL on the pool or a transaction, with a span per statement.
+type statements struct {
+	queryer queryer
+	span    *tracing.Span
+}
+
+func (db *DB) sql() statements {
+	return statements{queryer: db.db, span: db.span}
+}
+
+// Tx is a pgx transaction whose statements are traced under the storage call
+// that began it.
+type Tx struct {
+	*pgx.Tx
+	span *tracing.Span
+}
+
+func (db *DB) StartTransaction() (*Tx, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, span: db.span}, nil
+}
+
+func (db *DB) startTransactionIso(isolation string) (*Tx, error) {
+	tx, err := db.db.BeginIso(isolation)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, span: db.span}, nil
+}
+
+func (tx *Tx) statements() statements {
+	return statements{queryer: tx.Tx, span: tx.span}
+}
+
+func (tx *Tx) Query(sql string, args ...interface{}) (*Rows, error) {
+	return tx.statements().Query(sql, args...)
+}
+
+func (tx *Tx) QueryRow(sql string, args ...interface{}) *Row {
+	return tx.statements().QueryRow(sql, args...)
+}
+
+func (tx *Tx) Exec(sql string, args ...interface{}) (pgx.CommandTag, error) {
+	return tx.statements().Exec(sql, args...)
+}
+
+func (tx *Tx) Commit() error {
+	span := tx.span.Child("commit", tracing.KindClient)
+	err := tx.Tx.Commit()
+	endStatement(span, err)
+	return err
+}
+
+// Rows counts the rows read, so the span of the query can report them once
+// the rows are closed.
+type Rows struct {
+	*pgx.Rows
+	count int
+}
+
+func (rows *Rows) Next() bool {
+	if rows.Rows.Next() {
+		rows.count++
+		return true
+	}
+	return false
+}
+
+type Row struct {
+	rows *pgx.Rows
+	span *tracing.Span
+}
+
+func (row *Row) Scan(dest ...interface{}) error {
+	err := (*pgx.Row)(row.rows).Scan(dest...)
+	switch err {
+	case nil:
+		row.span.SetAttribute("db.rows", 1)
+		row.span.End()
+	case pgx.ErrNoRows:
+		row.span.SetAttribute("db.rows", 0)
+		row.span.End()
+	default:
+		endStatement(row.span, err)
+	}
+	return err
+}
+
+func (s statements) Query(sql string, args ...interface{}) (*Rows, error) {
+	span := s.start(sql)
+	pgxRows, err := s.queryer.Query(sql, args...)
+	rows := &Rows{Rows: pgxRows}
+	if err != nil {
+		endStatement(span, err)
+		return rows, err
+	}
+	if span != nil {
+		pgxRows.AfterClose(func(closed *pgx.Rows) {
+			span.SetAttribute("db.rows", rows.count)
+			endStatement(span, closed.Err())
+		})
+	}
+	return rows, nil
+}
+
+func (s statements) QueryRow(sql string, args ...interface{}) *Row {
+	span := s.start(sql)
+	rows, _ := s.queryer.Query(sql, args...)
+	return &Row{rows: rows, span: span}
+}
+
+func (s statements) Exec(sql string, args ...interface{}) (pgx.CommandTag, error) {
+	span := s.start(sql)
+	tag, err := s.queryer.Exec(sql, args...)
+	if err == nil {
+		span.SetAttribute("db.rows", tag.RowsAffected())
+	}
+	endStatement(span, err)
+	return tag, err
+}
+
+func (s statements) start(sql string) *tracing.Span {
+	if s.span == nil {
+		return nil
+	}
+	name := statementName(sql)
+	span := s.span.Child(name, tracing.KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.statement_name", name)
+	span.SetAttribute("db.statement", sql)
+	return span
+}
+
+func endStatement(span *tracing.Span, err error) {
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	span.End()
+}
+
+var statementTable = regexp.MustCompile(`(?i)\b(?:from|into|update)\s+([a-z_][a-z0-9_.]*)`)
+
+// statementName names a statement for its span: the name of the constant
+// holding it, the name it was prepared under, or else its verb and first
+// table.
+func statementName(sql string) string {
+	if name, ok := statementNames[sql]; ok {
+		return name
+	}
+	if !strings.ContainsAny(sql, " \t\n") {
+		return sql
+	}
+	fields := strings.Fields(sql)
+	name := strings.ToUpper(fields[0])
+	if match := statementTable.FindStringSubmatch(sql); match != nil {
+		name += " " + match[1]
+	}
+	return name
+}
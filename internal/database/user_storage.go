@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"gopkg.in/jackc/pgx.v2"
-	"log"
 )
 
 const (
@@ -12,23 +11,25 @@ const (
 		"FROM forum_to_users f_u JOIN users u ON (u.nick_name = f_u.user_nick) WHERE f_u.forum = $1 "
 	getForumUsersSincePart = "AND u.nick_name %s $2 "
 	getForumUsersFinPart   = `ORDER BY u.nick_name  %s LIMIT `
-	getUserByNick         = "SELECT * FROM users WHERE nick_name = $1"
-	getUsersByEmailOrNick = "SELECT * FROM users WHERE nick_name = $1 OR email = $2"
+	getUserByNick         = "SELECT nick_name, about, email, full_name FROM users WHERE nick_name = $1"
+	getUsersByEmailOrNick = "SELECT nick_name, about, email, full_name FROM users WHERE nick_name = $1 OR email = $2"
 	createUser            = "INSERT INTO users (nick_name, email, full_name, about) VALUES($1, $2, $3, $4)"
 	updateUser            = "UPDATE users SET about=(CASE WHEN $2='' THEN about ELSE $2 END), full_name=(CASE WHEN $3='' THEN full_name ELSE $3 END), " +
 		"email=(CASE WHEN $4='' THEN email ELSE $4 END) WHERE nick_name = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE email=$4)"
 )
 
 func (db *DB) GetForumUsers(forumId string, limit string,
-	since string, desc string) (models.Users, int) {
+	since string, desc string) (_ models.Users, status int) {
+	defer db.track("GetForumUsers", &status)()
 	query := ""
-	rows := &pgx.Rows{}
+	rows := &Rows{}
 	ifExist := false
-	err := db.db.QueryRow("SELECT TRUE  FROM forum where slug = $1", forumId).Scan(&ifExist)
+	err := db.sql().QueryRow("SELECT TRUE  FROM forum where slug = $1", forumId).Scan(&ifExist)
 	if err == pgx.ErrNoRows {
 		return nil, EmptyResult
 	}
 	if err != nil {
+		db.logError("checkForum", err)
 		return nil, DBError
 	}
 	if !ifExist {
@@ -46,13 +47,13 @@ func (db *DB) GetForumUsers(forumId string, limit string,
 			actualSince = fmt.Sprintf(getForumUsersSincePart, "<")
 		}
 		query = getForumUsers + actualSince + getForumUsersFinPart + "$3"
-		rows, err = db.db.Query(fmt.Sprintf(query, desc), forumId, since, limit)
+		rows, err = db.sql().Query(fmt.Sprintf(query, desc), forumId, since, limit)
 	} else {
 		query = getForumUsers + getForumUsersFinPart + "$2"
-		rows, err = db.db.Query(fmt.Sprintf(query, desc), forumId, limit)
+		rows, err = db.sql().Query(fmt.Sprintf(query, desc), forumId, limit)
 	}
 	if err != nil {
-		log.Println(err)
+		db.logError("getForumUsers", err)
 		return models.Users{}, DBError
 	}
 	defer rows.Close()
@@ -61,7 +62,7 @@ func (db *DB) GetForumUsers(forumId string, limit string,
 		user := new(models.User)
 		err := rows.Scan(&user.Nickname, &user.About, &user.Email, &user.Fullname)
 		if err != nil {
-			log.Println(err)
+			db.logError("getForumUsers", err)
 			return models.Users{}, DBError
 		}
 		users = append(users, user)
@@ -69,16 +70,17 @@ func (db *DB) GetForumUsers(forumId string, limit string,
 	return users, OK
 }
 
-func (db *DB) CreateUser(user models.User) (models.Users, int) {
+func (db *DB) CreateUser(user models.User, passwordHash string) (_ models.Users, status int) {
+	defer db.track("CreateUser", &status)()
 	tx, err := db.StartTransaction()
 	defer tx.Rollback()
 	if err != nil {
-		log.Println(err)
+		db.logError("begin", err)
 		return models.Users{}, DBError
 	}
 	rows, err := tx.Query(getUsersByEmailOrNick, user.Nickname, user.Email)
 	if err != nil {
-		log.Println(err)
+		db.logError("getUsersByEmailOrNick", err)
 		return models.Users{}, DBError
 	}
 	users := make(models.Users, 0)
@@ -88,7 +90,7 @@ func (db *DB) CreateUser(user models.User) (models.Users, int) {
 		user := new(models.User)
 		err := rows.Scan(&user.Nickname, &user.About, &user.Email, &user.Fullname)
 		if err != nil {
-			log.Println(err)
+			db.logError("getUsersByEmailOrNick", err)
 			return models.Users{}, DBError
 		}
 		users = append(users, user)
@@ -99,36 +101,49 @@ func (db *DB) CreateUser(user models.User) (models.Users, int) {
 	}
 	_, err = tx.Exec(createUser, user.Nickname, user.Email, user.Fullname, user.About)
 	if err != nil {
+		db.logError("createUser", err)
 		return nil, DBError
 	}
+	if passwordHash != "" {
+		_, err = tx.Exec(createCredentials, user.Nickname, passwordHash)
+		if err != nil {
+			db.logError("createCredentials", err)
+			return nil, DBError
+		}
+	}
 	_ = tx.Commit()
 	userToReturn, stat := db.GetUser(user.Nickname)
 	users = append(users, &userToReturn)
 	return users, stat
 }
 
-func (db *DB) GetUser(userNick string) (models.User, int) {
+func (db *DB) GetUser(userNick string) (_ models.User, status int) {
+	defer db.track("GetUser", &status)()
 	user := models.User{}
-	row := db.db.QueryRow(getUserByNick, userNick)
+	row := db.sql().QueryRow(getUserByNick, userNick)
 	err := row.Scan(&user.Nickname, &user.About, &user.Email,
 		&user.Fullname)
 	if err == pgx.ErrNoRows {
 		return user, EmptyResult
 	}
 	if err != nil {
+		db.logError("getUserByNick", err)
 		return user, DBError
 	}
 	return user, OK
 }
 
-func (db *DB) UpdateUser(userNick string, user models.UserUpdate) (models.User, int) {
+func (db *DB) UpdateUser(userNick string, user models.UserUpdate) (_ models.User, status int) {
+	defer db.track("UpdateUser", &status)()
 	tx, err := db.StartTransaction()
 	if err != nil {
+		db.logError("begin", err)
 		return models.User{}, DBError
 	}
 	defer tx.Rollback()
 	ifUserExists, err := IsUserExist(tx, userNick)
 	if err != nil {
+		db.logError("isUserExist", err)
 		return models.User{}, DBError
 	}
 	if !ifUserExists {
@@ -136,6 +151,7 @@ func (db *DB) UpdateUser(userNick string, user models.UserUpdate) (models.User,
 	}
 	res, err := tx.Exec(updateUser, userNick, user.About, user.Fullname, user.Email)
 	if err != nil {
+		db.logError("updateUser", err)
 		return models.User{}, DBError
 	}
 	num := res.RowsAffected()
@@ -0,0 +1,78 @@
+package filter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	set     *RuleSet
+	expires time.Time
+}
+
+// Cache keeps compiled rule sets per forum so that the rules are not read
+// from the database on every message.
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]cacheEntry
+}
+
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *Cache) Get(forum string) (*RuleSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[strings.ToLower(forum)]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.set, true
+}
+
+func (c *Cache) Put(forum string, set *RuleSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 || c.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	if len(c.entries) >= c.size {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	if len(c.entries) >= c.size {
+		for key := range c.entries {
+			delete(c.entries, key)
+			break
+		}
+	}
+	c.entries[strings.ToLower(forum)] = cacheEntry{set: set, expires: now.Add(c.ttl)}
+}
+
+// Reset drops every cached rule set and applies a new size and lifetime, for
+// when the site-wide rules or the cache settings change.
+func (c *Cache) Reset(size int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.ttl = ttl
+	c.entries = make(map[string]cacheEntry)
+}
+
+func (c *Cache) Invalidate(forum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, strings.ToLower(forum))
+}
@@ -0,0 +1,220 @@
+// Package filter evaluates forum content rules against new messages.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sergeychur/technopark_db/internal/models"
+)
+
+const (
+	KindWord       = "word"
+	KindRegex      = "regex"
+	KindLinks      = "links"
+	KindDuplicate  = "duplicate"
+	KindAccountAge = "account_age"
+
+	ActionReject = "reject"
+	ActionMask   = "mask"
+	ActionHold   = "hold"
+)
+
+var linkRegexp = regexp.MustCompile(`(?i)(https?://|www\.)[^\s<>"]+`)
+
+// Facts answers the questions of rules that depend on stored data.
+type Facts interface {
+	// AccountAge is the time since the author registered.
+	AccountAge(author string) (time.Duration, error)
+	// RecentDuplicate reports whether the author posted the same message within window.
+	RecentDuplicate(author string, message string, window time.Duration) (bool, error)
+}
+
+// Verdict is the outcome of a check. An empty Action means the message passes,
+// possibly masked. Rule is the rule that decided a reject or hold.
+type Verdict struct {
+	Action  string
+	Rule    *models.FilterRule
+	Message string
+}
+
+type compiledRule struct {
+	rule *models.FilterRule
+	re   *regexp.Regexp
+}
+
+// RuleSet is a compiled, immutable list of rules.
+type RuleSet struct {
+	rules []compiledRule
+}
+
+// Validate checks a rule before it is stored.
+func Validate(rule *models.FilterRule) error {
+	switch rule.Action {
+	case ActionReject, ActionHold:
+	case ActionMask:
+		if rule.Kind != KindWord && rule.Kind != KindRegex {
+			return errors.New("only word and regex rules can mask")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	switch rule.Kind {
+	case KindWord, KindRegex:
+		if rule.Pattern == "" {
+			return errors.New("pattern is required")
+		}
+		_, err := compilePattern(rule)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %s", err.Error())
+		}
+	case KindLinks:
+		if rule.Value < 0 {
+			return errors.New("value must be the maximum number of links")
+		}
+	case KindDuplicate, KindAccountAge:
+		if rule.Value <= 0 {
+			return errors.New("value must be a positive number of seconds")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", rule.Kind)
+	}
+	return nil
+}
+
+// Compile builds a rule set; rules that do not validate are skipped.
+func Compile(rules models.FilterRules) *RuleSet {
+	set := &RuleSet{}
+	for _, rule := range rules {
+		if Validate(rule) != nil {
+			continue
+		}
+		re, _ := compilePattern(rule)
+		set.rules = append(set.rules, compiledRule{rule: rule, re: re})
+	}
+	return set
+}
+
+func (s *RuleSet) Len() int {
+	return len(s.rules)
+}
+
+// Has tells whether the set holds a rule of kind.
+func (s *RuleSet) Has(kind string) bool {
+	for _, compiled := range s.rules {
+		if compiled.rule.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Check runs the rules in order. Masks accumulate, the first reject wins and a
+// hold is reported unless a later rule rejects.
+func (s *RuleSet) Check(author string, message string, facts Facts) (Verdict, error) {
+	verdict := Verdict{Message: message}
+	for _, compiled := range s.rules {
+		rule := compiled.rule
+		matched := false
+		switch rule.Kind {
+		case KindWord, KindRegex:
+			if rule.Action == ActionMask {
+				verdict.Message = mask(compiled.re, rule.Kind, verdict.Message)
+				continue
+			}
+			matched = compiled.re.MatchString(verdict.Message)
+		case KindLinks:
+			matched = int64(len(linkRegexp.FindAllStringIndex(verdict.Message, -1))) > rule.Value
+		case KindDuplicate:
+			if facts == nil {
+				continue
+			}
+			window := time.Duration(rule.Value) * time.Second
+			duplicate, err := facts.RecentDuplicate(author, message, window)
+			if err != nil {
+				return Verdict{}, err
+			}
+			matched = duplicate
+		case KindAccountAge:
+			if facts == nil {
+				continue
+			}
+			age, err := facts.AccountAge(author)
+			if err != nil {
+				return Verdict{}, err
+			}
+			matched = age < time.Duration(rule.Value)*time.Second
+		}
+		if !matched {
+			continue
+		}
+		if rule.Action == ActionReject {
+			return Verdict{Action: ActionReject, Rule: rule, Message: message}, nil
+		}
+		if verdict.Action == "" {
+			verdict.Action = ActionHold
+			verdict.Rule = rule
+		}
+	}
+	return verdict, nil
+}
+
+// Describe names the rule for error messages.
+func Describe(rule *models.FilterRule) string {
+	name := fmt.Sprintf("%s rule %d", rule.Kind, rule.ID)
+	if rule.ID == 0 {
+		name = "site-wide " + rule.Kind + " rule"
+	}
+	switch rule.Kind {
+	case KindWord, KindRegex:
+		return fmt.Sprintf("%s %q", name, rule.Pattern)
+	case KindLinks:
+		return fmt.Sprintf("%s (at most %d links)", name, rule.Value)
+	case KindDuplicate:
+		return fmt.Sprintf("%s (same message within %ds)", name, rule.Value)
+	case KindAccountAge:
+		return fmt.Sprintf("%s (account younger than %ds)", name, rule.Value)
+	}
+	return name
+}
+
+// Word rules match whole words, case-insensitively; \b is ASCII only in RE2,
+// so the boundaries are spelled out to work for any script.
+func compilePattern(rule *models.FilterRule) (*regexp.Regexp, error) {
+	switch rule.Kind {
+	case KindWord:
+		return regexp.Compile(`(?i)(^|[^\p{L}\p{N}_])(` + regexp.QuoteMeta(rule.Pattern) + `)($|[^\p{L}\p{N}_])`)
+	case KindRegex:
+		return regexp.Compile(rule.Pattern)
+	}
+	return nil, nil
+}
+
+func mask(re *regexp.Regexp, kind string, message string) string {
+	if kind == KindRegex {
+		return re.ReplaceAllStringFunc(message, stars)
+	}
+	var b strings.Builder
+	last := 0
+	for {
+		// group 2 is the word itself, without the boundaries around it
+		loc := re.FindStringSubmatchIndex(message[last:])
+		if loc == nil {
+			break
+		}
+		start, end := last+loc[4], last+loc[5]
+		b.WriteString(message[last:start])
+		b.WriteString(stars(message[start:end]))
+		last = end
+	}
+	b.WriteString(message[last:])
+	return b.String()
+}
+
+func stars(s string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(s))
+}
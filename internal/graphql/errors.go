@@ -0,0 +1,42 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Location is a line and column in the query, both counted from 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is one entry of the errors list of a response.
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func newError(loc Location, format string, args ...interface{}) *Error {
+	err := &Error{Message: fmt.Sprintf(format, args...)}
+	if loc.Line != 0 {
+		err.Locations = []Location{loc}
+	}
+	return err
+}
+
+func location(source string, pos int) Location {
+	if pos > len(source) {
+		pos = len(source)
+	}
+	before := source[:pos]
+	line := strings.Count(before, "\n") + 1
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return Location{Line: line, Column: utf8.RuneCountInString(before[lineStart:]) + 1}
+}
@@ -0,0 +1,604 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response carries data once execution has started; a request that fails to
+// parse or validate only gets errors.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Limits bound a query before it runs. Depth counts nested fields, root
+// fields being 1 deep. Complexity counts each field once, with the fields
+// under a list counted once per item the list may hold: its limit argument
+// or else its ListSize. Zero turns a limit off.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// Execute runs the operation of the request.
+func (schema *Schema) Execute(ctx context.Context, request Request, limits Limits) *Response {
+	doc, err := parse(request.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	op, err := doc.operation(request.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	v := &validator{schema: schema, doc: doc, args: map[*selection]map[string]interface{}{}}
+	v.vars, err = v.variables(op, request.Variables)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	v.fragments = map[string]bool{}
+	complexity, depth := v.visit(schema.query, op.selections, 1)
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		v.errors = append(v.errors, newError(op.loc, "Query is %d levels deep, more than the limit of %d.",
+			depth, limits.MaxDepth))
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		v.errors = append(v.errors, newError(op.loc, "Query complexity is %d, more than the limit of %d.",
+			complexity, limits.MaxComplexity))
+	}
+	if len(v.errors) != 0 {
+		return &Response{Errors: v.errors}
+	}
+	e := &executor{ctx: ctx, doc: doc, vars: v.vars, args: v.args, schema: schema}
+	data := e.executeSet(schema.query, []interface{}{nil}, [][]interface{}{{}}, op.selections)[0]
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func asError(err error) *Error {
+	if gqlErr, ok := err.(*Error); ok {
+		return gqlErr
+	}
+	return &Error{Message: err.Error()}
+}
+
+func (doc *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) != 1 {
+			return nil, &Error{Message: "operationName is required when the document holds several operations."}
+		}
+		return checkKind(doc.operations[0])
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return checkKind(op)
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+func checkKind(op *operation) (*operation, error) {
+	if op.kind != "query" {
+		return nil, newError(op.loc, "Only queries are supported, not %s.", op.kind)
+	}
+	return op, nil
+}
+
+// validator checks the operation against the schema before anything runs,
+// coercing arguments on the way, and measures it against the limits.
+type validator struct {
+	schema    *Schema
+	doc       *document
+	vars      map[string]interface{}
+	args      map[*selection]map[string]interface{}
+	fragments map[string]bool
+	errors    []*Error
+}
+
+func (v *validator) variables(op *operation, values map[string]interface{}) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, definition := range op.variables {
+		if !scalars[definition.typ.named()] {
+			return nil, newError(definition.loc, "Variable $%s must be of a scalar type.", definition.name)
+		}
+		value, ok := values[definition.name]
+		if !ok && definition.hasDefault {
+			value, ok = definition.defaultValue, true
+		}
+		if !ok {
+			if definition.typ.nonNull {
+				return nil, newError(definition.loc, "Variable $%s of type %s was not provided.",
+					definition.name, definition.typ)
+			}
+			continue
+		}
+		coerced, err := coerce(definition.typ, value, nil)
+		if err != nil {
+			return nil, newError(definition.loc, "Variable $%s got an invalid value: %s", definition.name, err.Error())
+		}
+		vars[definition.name] = coerced
+	}
+	return vars, nil
+}
+
+func (v *validator) fail(loc Location, format string, args ...interface{}) {
+	v.errors = append(v.errors, newError(loc, format, args...))
+}
+
+// visit validates the selections on obj at the given depth and returns their
+// complexity and the depth of their deepest field.
+func (v *validator) visit(obj *Object, selections []*selection, depth int) (int, int) {
+	complexity, maxDepth := 0, 0
+	for _, sel := range selections {
+		included, err := includes(sel, v.vars)
+		if err != nil {
+			v.fail(sel.loc, "%s", err.Error())
+			continue
+		}
+		if !included {
+			continue
+		}
+		cost, fieldDepth := 0, 0
+		switch {
+		case sel.spread != "":
+			frag, ok := v.doc.fragments[sel.spread]
+			if !ok {
+				v.fail(sel.loc, "Unknown fragment %q.", sel.spread)
+				continue
+			}
+			if v.fragments[frag.name] {
+				v.fail(sel.loc, "Cannot spread fragment %q within itself.", frag.name)
+				continue
+			}
+			if frag.on != obj.Name {
+				v.fail(sel.loc, "Fragment %q on %s cannot be spread on %s.", frag.name, frag.on, obj.Name)
+				continue
+			}
+			v.fragments[frag.name] = true
+			cost, fieldDepth = v.visit(obj, frag.selections, depth)
+			delete(v.fragments, frag.name)
+		case sel.inline:
+			if sel.on != "" && sel.on != obj.Name {
+				v.fail(sel.loc, "Fragment on %s cannot be spread on %s.", sel.on, obj.Name)
+				continue
+			}
+			cost, fieldDepth = v.visit(obj, sel.selections, depth)
+		case sel.name == "__typename":
+			fieldDepth = depth
+			if len(sel.arguments) != 0 || len(sel.selections) != 0 {
+				v.fail(sel.loc, "__typename takes neither arguments nor subfields.")
+			}
+		default:
+			cost, fieldDepth = v.field(obj, sel, depth)
+		}
+		complexity = saturatingAdd(complexity, cost)
+		if fieldDepth > maxDepth {
+			maxDepth = fieldDepth
+		}
+	}
+	return complexity, maxDepth
+}
+
+func (v *validator) field(obj *Object, sel *selection, depth int) (int, int) {
+	field, ok := obj.fields[sel.name]
+	if !ok {
+		v.fail(sel.loc, "Cannot query field %q on type %q.", sel.name, obj.Name)
+		return 0, depth
+	}
+	args := map[string]interface{}{}
+	given := map[string]bool{}
+	for _, arg := range sel.arguments {
+		definition, ok := field.args[arg.name]
+		if !ok {
+			v.fail(arg.loc, "Unknown argument %q on field %s.%s.", arg.name, obj.Name, field.Name)
+			continue
+		}
+		if given[arg.name] {
+			v.fail(arg.loc, "There can be only one argument named %q.", arg.name)
+			continue
+		}
+		given[arg.name] = true
+		value, err := coerce(definition.typ, arg.value, v.vars)
+		if err != nil {
+			v.fail(arg.loc, "Argument %q of %s.%s: %s", arg.name, obj.Name, field.Name, err.Error())
+			continue
+		}
+		args[arg.name] = value
+	}
+	for _, definition := range field.Args {
+		if value, ok := args[definition.Name]; ok && value != nil {
+			continue
+		}
+		if definition.Default != nil {
+			args[definition.Name], _ = coerce(field.args[definition.Name].typ, definition.Default, nil)
+			continue
+		}
+		if field.args[definition.Name].typ.nonNull && !given[definition.Name] {
+			v.fail(sel.loc, "Field %s.%s requires argument %q.", obj.Name, field.Name, definition.Name)
+		}
+	}
+	v.args[sel] = args
+
+	child, isObject := v.schema.objects[field.typ.named()]
+	if !isObject {
+		if len(sel.selections) != 0 {
+			v.fail(sel.loc, "Field %q of type %s cannot have subfields.", sel.name, field.Type)
+		}
+		return 1, depth
+	}
+	if len(sel.selections) == 0 {
+		v.fail(sel.loc, "Field %q of type %s needs a selection of subfields.", sel.name, field.Type)
+		return 1, depth
+	}
+	childCost, childDepth := v.visit(child, sel.selections, depth+1)
+	if isList(field.typ) {
+		size := field.ListSize
+		if limit, ok := args["limit"].(int64); ok && limit > 0 {
+			size = int(math.Min(float64(limit), math.MaxInt32))
+		}
+		childCost = saturatingMul(childCost, size)
+	}
+	return saturatingAdd(1, childCost), childDepth
+}
+
+func isList(typ *typeRef) bool {
+	return typ.elem != nil
+}
+
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int) int {
+	if b != 0 && a > math.MaxInt32/b {
+		return math.MaxInt32
+	}
+	return a * b
+}
+
+// includes applies the @skip and @include directives of sel.
+func includes(sel *selection, vars map[string]interface{}) (bool, error) {
+	for _, d := range sel.directives {
+		if d.name != "skip" && d.name != "include" {
+			return false, fmt.Errorf("Unknown directive @%s.", d.name)
+		}
+		if len(d.arguments) != 1 || d.arguments[0].name != "if" {
+			return false, fmt.Errorf("Directive @%s takes a single argument if.", d.name)
+		}
+		value, err := coerce(&typeRef{name: "Boolean", nonNull: true}, d.arguments[0].value, vars)
+		if err != nil {
+			return false, fmt.Errorf("Directive @%s: %s", d.name, err.Error())
+		}
+		if value.(bool) == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// coerce turns a literal of the query, or a variable value from JSON, into
+// the Go value resolvers get: int64, float64, string, bool or a slice of
+// them.
+func coerce(typ *typeRef, value interface{}, vars map[string]interface{}) (interface{}, error) {
+	if name, ok := value.(variable); ok {
+		varValue, ok := vars[string(name)]
+		if !ok && typ.nonNull {
+			return nil, fmt.Errorf("variable $%s is not provided", name)
+		}
+		if varValue == nil && typ.nonNull {
+			return nil, fmt.Errorf("expected a value of type %s, got null", typ)
+		}
+		return varValue, nil
+	}
+	if value == nil {
+		if typ.nonNull {
+			return nil, fmt.Errorf("expected a value of type %s, got null", typ)
+		}
+		return nil, nil
+	}
+	if typ.elem != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			coerced, err := coerce(typ.elem, item, vars)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	}
+	switch typ.name {
+	case "Int":
+		switch value := value.(type) {
+		case int:
+			return int64(value), nil
+		case int64:
+			return value, nil
+		case float64:
+			if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+				return int64(value), nil
+			}
+		case json.Number:
+			n, err := strconv.ParseInt(string(value), 10, 64)
+			if err == nil {
+				return n, nil
+			}
+		}
+	case "Float":
+		switch value := value.(type) {
+		case int:
+			return float64(value), nil
+		case int64:
+			return float64(value), nil
+		case float64:
+			return value, nil
+		case json.Number:
+			f, err := value.Float64()
+			if err == nil {
+				return f, nil
+			}
+		}
+	case "String":
+		if value, ok := value.(string); ok {
+			return value, nil
+		}
+	case "ID":
+		switch value := value.(type) {
+		case string:
+			return value, nil
+		case int, int64:
+			return fmt.Sprint(value), nil
+		case json.Number:
+			if _, err := value.Int64(); err == nil {
+				return string(value), nil
+			}
+		}
+	case "Boolean":
+		if value, ok := value.(bool); ok {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s, got %s", typ, describe(value))
+}
+
+func describe(value interface{}) string {
+	switch value := value.(type) {
+	case enumValue:
+		return string(value)
+	case string:
+		return strconv.Quote(value)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprint(value)
+}
+
+// executor runs a validated operation one level at a time: every field is
+// resolved for all the objects of its level in a single resolver call, so a
+// query costs a number of resolver calls that grows with its depth, not with
+// the size of its results.
+type executor struct {
+	ctx    context.Context
+	schema *Schema
+	doc    *document
+	vars   map[string]interface{}
+	args   map[*selection]map[string]interface{}
+	errors []*Error
+}
+
+// collectedField is a response key with all the selections that feed it.
+type collectedField struct {
+	key        string
+	name       string
+	selections []*selection
+}
+
+func (e *executor) collect(obj *Object, selections []*selection, fields []*collectedField) []*collectedField {
+	for _, sel := range selections {
+		if included, _ := includes(sel, e.vars); !included {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			fields = e.collect(obj, e.doc.fragments[sel.spread].selections, fields)
+		case sel.inline:
+			fields = e.collect(obj, sel.selections, fields)
+		default:
+			merged := false
+			for _, field := range fields {
+				if field.key == sel.key() {
+					field.selections = append(field.selections, sel)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				fields = append(fields, &collectedField{key: sel.key(), name: sel.name, selections: []*selection{sel}})
+			}
+		}
+	}
+	return fields
+}
+
+func (e *executor) fail(loc Location, path []interface{}, format string, args ...interface{}) {
+	err := newError(loc, format, args...)
+	err.Path = path
+	e.errors = append(e.errors, err)
+}
+
+func (e *executor) executeSet(obj *Object, sources []interface{}, paths [][]interface{}, selections []*selection) []interface{} {
+	results := make([]interface{}, len(sources))
+	objects := make([]*orderedMap, len(sources))
+	for i := range sources {
+		objects[i] = &orderedMap{}
+		results[i] = objects[i]
+	}
+	for _, collected := range e.collect(obj, selections, nil) {
+		first := collected.selections[0]
+		if collected.name == "__typename" {
+			for _, object := range objects {
+				object.set(collected.key, obj.Name)
+			}
+			continue
+		}
+		for _, sel := range collected.selections[1:] {
+			if sel.name != first.name || !reflect.DeepEqual(e.args[sel], e.args[first]) {
+				e.fail(sel.loc, nil, "Fields %q conflict: they select different fields or arguments.", collected.key)
+			}
+		}
+		field := obj.fields[collected.name]
+		fieldPaths := make([][]interface{}, len(paths))
+		for i, path := range paths {
+			fieldPaths[i] = appendPath(path, collected.key)
+		}
+		values, err := field.Resolve(e.ctx, sources, e.args[first])
+		if err == nil && len(values) != len(sources) {
+			err = fmt.Errorf("resolver of %s.%s returned %d values for %d objects",
+				obj.Name, field.Name, len(values), len(sources))
+		}
+		if err != nil {
+			e.fail(first.loc, fieldPaths[0], "%s", err.Error())
+			values = make([]interface{}, len(sources))
+		}
+		completed := e.complete(field.typ, values, fieldPaths, collected.selections)
+		for i, object := range objects {
+			object.set(collected.key, completed[i])
+		}
+	}
+	return results
+}
+
+// complete shapes resolved values into their response form, running the
+// subselections of object values for the whole level together.
+func (e *executor) complete(typ *typeRef, values []interface{}, paths [][]interface{}, selections []*selection) []interface{} {
+	completed := make([]interface{}, len(values))
+	if typ.nonNull {
+		for i, value := range values {
+			if value == nil {
+				e.fail(selections[0].loc, paths[i], "Cannot return null for non-nullable field of type %s.", typ)
+			}
+		}
+	}
+	if typ.elem != nil {
+		items, itemPaths, owners := []interface{}{}, [][]interface{}{}, []int{}
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			list, ok := value.([]interface{})
+			if !ok {
+				e.fail(selections[0].loc, paths[i], "Expected a list of %s.", typ.elem)
+				continue
+			}
+			completed[i] = make([]interface{}, 0, len(list))
+			for j, item := range list {
+				items = append(items, item)
+				itemPaths = append(itemPaths, appendPath(paths[i], j))
+				owners = append(owners, i)
+			}
+		}
+		for j, item := range e.complete(typ.elem, items, itemPaths, selections) {
+			completed[owners[j]] = append(completed[owners[j]].([]interface{}), item)
+		}
+		return completed
+	}
+	obj, isObject := e.schema.objects[typ.name]
+	if !isObject {
+		for i, value := range values {
+			completed[i] = serialize(typ.name, value)
+		}
+		return completed
+	}
+	sources, sourcePaths, owners := []interface{}{}, [][]interface{}{}, []int{}
+	for i, value := range values {
+		if value != nil {
+			sources = append(sources, value)
+			sourcePaths = append(sourcePaths, paths[i])
+			owners = append(owners, i)
+		}
+	}
+	if len(sources) == 0 {
+		return completed
+	}
+	subselections := make([]*selection, 0)
+	for _, sel := range selections {
+		subselections = append(subselections, sel.selections...)
+	}
+	for j, result := range e.executeSet(obj, sources, sourcePaths, subselections) {
+		completed[owners[j]] = result
+	}
+	return completed
+}
+
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	extended := make([]interface{}, len(path), len(path)+1)
+	copy(extended, path)
+	return append(extended, key)
+}
+
+func serialize(scalar string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if scalar == "ID" {
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+// orderedMap is a response object, which keeps its fields in query order.
+type orderedMap struct {
+	keys   []string
+	values []interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	for i, existing := range m.keys {
+		if existing == key {
+			m.values[i] = value
+			return
+		}
+	}
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	b := bytes.Buffer{}
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		b.Write(name)
+		b.WriteByte(':')
+		value, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func lex(t *testing.T, source string) ([]token, error) {
+	l := &lexer{source: source}
+	tokens := make([]token, 0)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return tokens, err
+		}
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, tok)
+		if len(tokens) > 100 {
+			t.Fatalf("lexer of %q does not end", source)
+		}
+	}
+}
+
+func TestLexTokens(t *testing.T) {
+	source := "\uFEFF{ post(id: -12, rating: 1.5e+3) @include(if: $all) { ...on Post } } # comment\r\n,,"
+	want := []token{
+		{tokenPunct, "{", 3},
+		{tokenName, "post", 5},
+		{tokenPunct, "(", 9},
+		{tokenName, "id", 10},
+		{tokenPunct, ":", 12},
+		{tokenInt, "-12", 14},
+		{tokenName, "rating", 19},
+		{tokenPunct, ":", 25},
+		{tokenFloat, "1.5e+3", 27},
+		{tokenPunct, ")", 33},
+		{tokenPunct, "@", 35},
+		{tokenName, "include", 36},
+		{tokenPunct, "(", 43},
+		{tokenName, "if", 44},
+		{tokenPunct, ":", 46},
+		{tokenPunct, "$", 48},
+		{tokenName, "all", 49},
+		{tokenPunct, ")", 52},
+		{tokenPunct, "{", 54},
+		{tokenPunct, "...", 56},
+		{tokenName, "on", 59},
+		{tokenName, "Post", 62},
+		{tokenPunct, "}", 67},
+		{tokenPunct, "}", 69},
+	}
+	got, err := lex(t, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLexNumbers(t *testing.T) {
+	tests := map[string]tokenKind{
+		"0":        tokenInt,
+		"-0":       tokenInt,
+		"1234":     tokenInt,
+		"0.5":      tokenFloat,
+		"-1.25":    tokenFloat,
+		"1e10":     tokenFloat,
+		"6.02E-23": tokenFloat,
+	}
+	for source, kind := range tests {
+		got, err := lex(t, source)
+		if err != nil {
+			t.Errorf("lex(%q): %v", source, err)
+			continue
+		}
+		if len(got) != 1 || got[0].kind != kind || got[0].value != source {
+			t.Errorf("lex(%q) = %+v, want one token of kind %d", source, got, kind)
+		}
+	}
+}
+
+func TestLexStrings(t *testing.T) {
+	tests := map[string]string{
+		`""`:                                "",
+		`"Yo ho"`:                           "Yo ho",
+		`"quote \" slash \\ \/ \b\f\n\r\t"`: "quote \" slash \\ / \b\f\n\r\t",
+		`"\u00e9t\u00C9"`:                   "étÉ",
+		`"ünïcode ✓"`:                       "ünïcode ✓",
+		`""""""`:                            "",
+		`"""raw \n "quotes" \""" """`:       `raw \n "quotes" """ `,
+		"\"\"\"\n    first\n      second\n\n    third\n  \"\"\"": "first\n  second\n\nthird",
+		"\"\"\"  keep\r\n  this\"\"\"":                           "  keep\nthis",
+	}
+	for source, want := range tests {
+		got, err := lex(t, source)
+		if err != nil {
+			t.Errorf("lex(%q): %v", source, err)
+			continue
+		}
+		if len(got) != 1 || got[0].kind != tokenString || got[0].value != want {
+			t.Errorf("lex(%q) = %+v, want the string %q", source, got, want)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		loc    Location
+	}{
+		{"{ post ? }", `Syntax Error: unexpected character '?'`, Location{1, 8}},
+		{"{\n  a: 007 }", "Syntax Error: invalid number, unexpected leading zero", Location{2, 6}},
+		{"1.", "Syntax Error: invalid number", Location{1, 1}},
+		{".5", "Syntax Error: unexpected character '.'", Location{1, 1}},
+		{"1e", "Syntax Error: invalid number", Location{1, 1}},
+		{"12abc", "Syntax Error: invalid number", Location{1, 1}},
+		{"1.5.3", "Syntax Error: invalid number", Location{1, 1}},
+		{"-", "Syntax Error: invalid number", Location{1, 1}},
+		{`"open`, "Syntax Error: unterminated string", Location{1, 1}},
+		{"\"line\nbreak\"", "Syntax Error: unterminated string", Location{1, 1}},
+		{`"ends in \`, "Syntax Error: unterminated string", Location{1, 1}},
+		{`"bad \q"`, `Syntax Error: invalid escape \q`, Location{1, 6}},
+		{`"bad \u12"`, "Syntax Error: invalid unicode escape", Location{1, 8}},
+		{`"bad \uZZZZ"`, "Syntax Error: invalid unicode escape", Location{1, 8}},
+		{`"""open`, "Syntax Error: unterminated string", Location{1, 1}},
+		{`"é" ?`, `Syntax Error: unexpected character '?'`, Location{1, 5}},
+	}
+	for _, test := range tests {
+		_, err := lex(t, test.source)
+		gqlErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("lex(%q) = %v, want %q", test.source, err, test.want)
+			continue
+		}
+		if gqlErr.Message != test.want || len(gqlErr.Locations) != 1 || gqlErr.Locations[0] != test.loc {
+			t.Errorf("lex(%q) = %q at %v, want %q at %v", test.source, gqlErr.Message, gqlErr.Locations, test.want, test.loc)
+		}
+	}
+}
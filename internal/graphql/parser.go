@@ -0,0 +1,530 @@
+package graphql
+
+import (
+	"strconv"
+)
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string
+	name       string
+	variables  []*variableDefinition
+	selections []*selection
+	loc        Location
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue interface{}
+	hasDefault   bool
+	loc          Location
+}
+
+type fragment struct {
+	name       string
+	on         string
+	selections []*selection
+	loc        Location
+}
+
+// selection is a field, a fragment spread (spread set) or an inline
+// fragment (inline set).
+type selection struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []*selection
+	spread     string
+	inline     bool
+	on         string
+	loc        Location
+}
+
+func (sel *selection) key() string {
+	if sel.alias != "" {
+		return sel.alias
+	}
+	return sel.name
+}
+
+type argument struct {
+	name  string
+	value interface{}
+	loc   Location
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	loc       Location
+}
+
+// Values in a document are Go values, except for these two.
+type (
+	variable  string
+	enumValue string
+)
+
+// typeRef is a type reference such as [Post!]!.
+type typeRef struct {
+	name    string
+	elem    *typeRef
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// named is the type inside any list and non-null wrappers.
+func (t *typeRef) named() string {
+	for t.elem != nil {
+		t = t.elem
+	}
+	return t.name
+}
+
+type parser struct {
+	lexer lexer
+	token token
+}
+
+func parse(source string) (*document, error) {
+	p := &parser{lexer: lexer{source: source}}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: map[string]*fragment{}}
+	if p.token.kind == tokenEOF {
+		return nil, p.errorf("Syntax Error: the document has no operation")
+	}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peekName("fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, newError(frag.loc, "There can be only one fragment named %q.", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+		case p.peek("{") || p.peekName("query") || p.peekName("mutation") || p.peekName("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+func (p *parser) loc() Location {
+	return location(p.lexer.source, p.token.pos)
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.token.kind == tokenPunct && p.token.value == punct
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.token.kind == tokenName && p.token.value == name
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return newError(p.loc(), format, args...)
+}
+
+func (p *parser) unexpected() error {
+	if p.token.kind == tokenEOF {
+		return p.errorf("Syntax Error: unexpected end of document")
+	}
+	return p.errorf("Syntax Error: unexpected %q", p.token.value)
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: "query", loc: p.loc()}
+	if p.peek("{") {
+		selections, err := p.selectionSet()
+		op.selections = selections
+		return op, err
+	}
+	op.kind = p.token.value
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind == tokenName {
+		op.name = p.token.value
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		op.variables, err = p.variableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	op.selections, err = p.selectionSet()
+	return op, err
+}
+
+func (p *parser) variableDefinitions() ([]*variableDefinition, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	definitions := make([]*variableDefinition, 0)
+	for !p.peek(")") {
+		definition := &variableDefinition{loc: p.loc()}
+		err = p.expect("$")
+		if err != nil {
+			return nil, err
+		}
+		definition.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		definition.typ, err = p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek("=") {
+			err = p.advance()
+			if err != nil {
+				return nil, err
+			}
+			definition.defaultValue, err = p.value(true)
+			if err != nil {
+				return nil, err
+			}
+			definition.hasDefault = true
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, p.advance()
+}
+
+func (p *parser) typeRef() (*typeRef, error) {
+	t := &typeRef{}
+	var err error
+	if p.peek("[") {
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+		t.elem, err = p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect("]")
+	} else {
+		t.name, err = p.name()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.peek("!") {
+		t.nonNull = true
+		err = p.advance()
+	}
+	return t, err
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	frag := &fragment{loc: p.loc()}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	if p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	frag.name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	err = p.advance()
+	if err != nil {
+		return nil, err
+	}
+	frag.on, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	frag.selections, err = p.selectionSet()
+	return frag, err
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	err := p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	selections := make([]*selection, 0)
+	for !p.peek("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.unexpected()
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (*selection, error) {
+	sel := &selection{loc: p.loc()}
+	var err error
+	if p.peek("...") {
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+		if p.token.kind == tokenName && !p.peekName("on") {
+			sel.spread, err = p.name()
+			if err != nil {
+				return nil, err
+			}
+			sel.directives, err = p.directives()
+			return sel, err
+		}
+		sel.inline = true
+		if p.peekName("on") {
+			err = p.advance()
+			if err != nil {
+				return nil, err
+			}
+			sel.on, err = p.name()
+			if err != nil {
+				return nil, err
+			}
+		}
+		sel.directives, err = p.directives()
+		if err != nil {
+			return nil, err
+		}
+		sel.selections, err = p.selectionSet()
+		return sel, err
+	}
+	sel.name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek(":") {
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+		sel.alias = sel.name
+		sel.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		sel.arguments, err = p.arguments()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sel.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		sel.selections, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+func (p *parser) arguments() ([]*argument, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	arguments := make([]*argument, 0)
+	for !p.peek(")") {
+		arg := &argument{loc: p.loc()}
+		arg.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		arg.value, err = p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, arg)
+	}
+	if len(arguments) == 0 {
+		return nil, p.unexpected()
+	}
+	return arguments, p.advance()
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	directives := make([]*directive, 0)
+	for p.peek("@") {
+		d := &directive{loc: p.loc()}
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		d.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek("(") {
+			d.arguments, err = p.arguments()
+			if err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// value reads a literal; constant ones, as default values are, may not
+// refer to variables.
+func (p *parser) value(constant bool) (interface{}, error) {
+	token := p.token
+	switch token.kind {
+	case tokenInt:
+		n, err := strconv.ParseInt(token.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("Syntax Error: %s does not fit in an integer", token.value)
+		}
+		return n, p.advance()
+	case tokenFloat:
+		f, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, p.errorf("Syntax Error: invalid number %s", token.value)
+		}
+		return f, p.advance()
+	case tokenString:
+		return token.value, p.advance()
+	case tokenName:
+		var value interface{}
+		switch token.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = enumValue(token.value)
+		}
+		return value, p.advance()
+	}
+	switch {
+	case p.peek("$") && !constant:
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case p.peek("["):
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, 0)
+		for !p.peek("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		object := map[string]interface{}{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect(":")
+			if err != nil {
+				return nil, err
+			}
+			object[name], err = p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return object, p.advance()
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,151 @@
+package graphql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOperation(t *testing.T) {
+	source := `
+query Thread($id: Int! = 1, $sort: [PostSort!], $filter: Filter) @cached {
+  thread(id: $id) {
+    title
+    first: posts(limit: 10, sort: TREE, since: null, desc: true,
+        where: {author: "j.sparrow", ids: [1, 2.5, $id]}) @include(if: true) {
+      ...postFields
+      ... on Post { id }
+      ... @skip(if: false) { message }
+    }
+  }
+}
+
+fragment postFields on Post { author { nickname } }
+`
+	doc, err := parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.operations) != 1 {
+		t.Fatalf("got %d operations", len(doc.operations))
+	}
+	op := doc.operations[0]
+	if op.kind != "query" || op.name != "Thread" || op.loc != (Location{2, 1}) {
+		t.Errorf("operation %s %s at %v", op.kind, op.name, op.loc)
+	}
+
+	types := []string{}
+	for _, definition := range op.variables {
+		types = append(types, "$"+definition.name+": "+definition.typ.String())
+	}
+	if want := []string{"$id: Int!", "$sort: [PostSort!]", "$filter: Filter"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("variables %v, want %v", types, want)
+	}
+	if !op.variables[0].hasDefault || op.variables[0].defaultValue != int64(1) || op.variables[1].hasDefault {
+		t.Errorf("default values %+v %+v", op.variables[0], op.variables[1])
+	}
+	if op.variables[1].typ.named() != "PostSort" {
+		t.Errorf("named type %s, want PostSort", op.variables[1].typ.named())
+	}
+
+	thread := op.selections[0]
+	if thread.name != "thread" || len(thread.arguments) != 1 || thread.arguments[0].value != variable("id") {
+		t.Errorf("thread selection %+v", thread)
+	}
+	posts := thread.selections[1]
+	if posts.key() != "first" || posts.name != "posts" || posts.loc != (Location{5, 5}) {
+		t.Errorf("posts selection %s: %s at %v", posts.key(), posts.name, posts.loc)
+	}
+	arguments := map[string]interface{}{}
+	for _, arg := range posts.arguments {
+		arguments[arg.name] = arg.value
+	}
+	wantArguments := map[string]interface{}{
+		"limit": int64(10),
+		"sort":  enumValue("TREE"),
+		"since": nil,
+		"desc":  true,
+		"where": map[string]interface{}{
+			"author": "j.sparrow",
+			"ids":    []interface{}{int64(1), 2.5, variable("id")},
+		},
+	}
+	if !reflect.DeepEqual(arguments, wantArguments) {
+		t.Errorf("arguments %#v, want %#v", arguments, wantArguments)
+	}
+	if len(posts.directives) != 1 || posts.directives[0].name != "include" {
+		t.Errorf("directives %+v", posts.directives)
+	}
+
+	spread, inline, bare := posts.selections[0], posts.selections[1], posts.selections[2]
+	if spread.spread != "postFields" || spread.inline {
+		t.Errorf("spread %+v", spread)
+	}
+	if !inline.inline || inline.on != "Post" || inline.selections[0].name != "id" {
+		t.Errorf("inline fragment %+v", inline)
+	}
+	if !bare.inline || bare.on != "" || len(bare.directives) != 1 || bare.directives[0].name != "skip" {
+		t.Errorf("inline fragment without a type %+v", bare)
+	}
+
+	frag := doc.fragments["postFields"]
+	if frag == nil || frag.on != "Post" || frag.selections[0].selections[0].name != "nickname" {
+		t.Errorf("fragment %+v", frag)
+	}
+}
+
+func TestParseShorthandAndMutation(t *testing.T) {
+	doc, err := parse(`{ status { user } } mutation { clear }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.operations) != 2 {
+		t.Fatalf("got %d operations", len(doc.operations))
+	}
+	if doc.operations[0].kind != "query" || doc.operations[0].name != "" {
+		t.Errorf("shorthand operation %s %q", doc.operations[0].kind, doc.operations[0].name)
+	}
+	if doc.operations[1].kind != "mutation" || doc.operations[1].selections[0].name != "clear" {
+		t.Errorf("mutation %+v", doc.operations[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		loc    Location
+	}{
+		{"", "Syntax Error: the document has no operation", Location{1, 1}},
+		{"# only a comment", "Syntax Error: the document has no operation", Location{1, 17}},
+		{"{ }", `Syntax Error: unexpected "}"`, Location{1, 3}},
+		{"{ forum", "Syntax Error: unexpected end of document", Location{1, 8}},
+		{"{ forum(slug: ) }", `Syntax Error: unexpected ")"`, Location{1, 15}},
+		{"{ forum() }", `Syntax Error: unexpected ")"`, Location{1, 9}},
+		{"{ forum(slug: [1, 2) }", `Syntax Error: unexpected ")"`, Location{1, 20}},
+		{"{ forum(slug: {a 1}) }", `Syntax Error: unexpected "1"`, Location{1, 18}},
+		{"{ a: b: c }", `Syntax Error: unexpected ":"`, Location{1, 7}},
+		{"{ forum(n: 99999999999999999999) }", "Syntax Error: 99999999999999999999 does not fit in an integer", Location{1, 12}},
+		{"query ($a: Int = $b) { forum }", `Syntax Error: unexpected "$"`, Location{1, 18}},
+		{"query ($a Int) { forum }", `Syntax Error: unexpected "Int"`, Location{1, 11}},
+		{"query ($a: [Int) { forum }", `Syntax Error: unexpected ")"`, Location{1, 16}},
+		{"query { forum } }", `Syntax Error: unexpected "}"`, Location{1, 17}},
+		{"forum { slug }", `Syntax Error: unexpected "forum"`, Location{1, 1}},
+		{"fragment on on Post { id } { a }", `Syntax Error: unexpected "on"`, Location{1, 10}},
+		{"fragment F Post { id } { a }", `Syntax Error: unexpected "Post"`, Location{1, 12}},
+		{"fragment F on Post { id }\nfragment F on Post { id }\n{ a }", `There can be only one fragment named "F".`, Location{2, 1}},
+		{"{ ...on }", `Syntax Error: unexpected "}"`, Location{1, 9}},
+		{"{ forum @ }", `Syntax Error: unexpected "}"`, Location{1, 11}},
+		{"{\n  forum(slug: \"open)\n}", "Syntax Error: unterminated string", Location{2, 15}},
+	}
+	for _, test := range tests {
+		_, err := parse(test.source)
+		gqlErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("parse(%q) = %v, want %q", test.source, err, test.want)
+			continue
+		}
+		if gqlErr.Message != test.want || len(gqlErr.Locations) != 1 || gqlErr.Locations[0] != test.loc {
+			t.Errorf("parse(%q) = %q at %v, want %q at %v", test.source, gqlErr.Message, gqlErr.Locations, test.want, test.loc)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Resolver computes a field for all the objects of one level of the query
+// at once and returns a value per source, in the same order. Taking the
+// sources together is what lets a resolver load, say, the authors of a
+// hundred posts with one query. A list field returns []interface{} per
+// source, an object field the value its own resolvers get as source.
+type Resolver func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+// Each makes a Resolver out of a function of a single source, for fields
+// that need nothing beyond the source itself.
+func Each(get func(source interface{}) interface{}) Resolver {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		values := make([]interface{}, len(sources))
+		for i, source := range sources {
+			values[i] = get(source)
+		}
+		return values, nil
+	}
+}
+
+type Argument struct {
+	Name    string
+	Type    string
+	Default interface{}
+}
+
+type Field struct {
+	Name        string
+	Type        string
+	Description string
+	Args        []Argument
+	// ListSize is how many items a list field is taken to return when no
+	// limit argument says, for the complexity of a query.
+	ListSize int
+	Resolve  Resolver
+
+	typ  *typeRef
+	args map[string]*argumentType
+}
+
+type argumentType struct {
+	Argument
+	typ *typeRef
+}
+
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+
+	fields map[string]*Field
+}
+
+var scalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true}
+
+// Schema is a set of object types with Query as the root. Only queries are
+// served; there are no mutations, interfaces, unions or input objects, and
+// the schema is published as SDL instead of through introspection.
+type Schema struct {
+	query   *Object
+	objects map[string]*Object
+}
+
+// NewSchema checks that every type the objects refer to is a scalar or one of
+// them. The first object is the query root.
+func NewSchema(query *Object, objects ...*Object) (*Schema, error) {
+	schema := &Schema{query: query, objects: map[string]*Object{}}
+	for _, obj := range append([]*Object{query}, objects...) {
+		if _, ok := schema.objects[obj.Name]; ok || scalars[obj.Name] {
+			return nil, fmt.Errorf("graphql: type %s defined twice", obj.Name)
+		}
+		schema.objects[obj.Name] = obj
+	}
+	for _, obj := range schema.objects {
+		obj.fields = map[string]*Field{}
+		for _, field := range obj.Fields {
+			typ, err := parseType(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("graphql: %s.%s: %s", obj.Name, field.Name, err.Error())
+			}
+			if _, ok := schema.objects[typ.named()]; !ok && !scalars[typ.named()] {
+				return nil, fmt.Errorf("graphql: %s.%s: unknown type %s", obj.Name, field.Name, typ.named())
+			}
+			if field.Resolve == nil {
+				return nil, fmt.Errorf("graphql: %s.%s has no resolver", obj.Name, field.Name)
+			}
+			field.typ = typ
+			field.args = map[string]*argumentType{}
+			for _, arg := range field.Args {
+				argTyp, err := parseType(arg.Type)
+				if err != nil || !scalars[argTyp.named()] {
+					return nil, fmt.Errorf("graphql: %s.%s(%s): arguments must be scalars", obj.Name, field.Name, arg.Name)
+				}
+				field.args[arg.Name] = &argumentType{Argument: arg, typ: argTyp}
+			}
+			obj.fields[field.Name] = field
+		}
+	}
+	return schema, nil
+}
+
+func parseType(s string) (*typeRef, error) {
+	p := &parser{lexer: lexer{source: s}}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	typ, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+	return typ, nil
+}
+
+// String prints the schema in the GraphQL schema definition language.
+func (schema *Schema) String() string {
+	b := strings.Builder{}
+	names := make([]string, 0, len(schema.objects))
+	for name := range schema.objects {
+		if name != schema.query.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range append([]string{schema.query.Name}, names...) {
+		obj := schema.objects[name]
+		if b.Len() != 0 {
+			b.WriteString("\n")
+		}
+		writeDescription(&b, "", obj.Description)
+		b.WriteString("type " + obj.Name + " {\n")
+		for _, field := range obj.Fields {
+			writeDescription(&b, "  ", field.Description)
+			b.WriteString("  " + field.Name)
+			if len(field.Args) != 0 {
+				args := make([]string, 0, len(field.Args))
+				for _, arg := range field.Args {
+					s := arg.Name + ": " + arg.Type
+					if arg.Default != nil {
+						s += " = " + literal(arg.Default)
+					}
+					args = append(args, s)
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + field.Type + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent string, description string) {
+	if description == "" {
+		return
+	}
+	b.WriteString(indent + `"""` + "\n")
+	for _, line := range strings.Split(description, "\n") {
+		b.WriteString(indent + line + "\n")
+	}
+	b.WriteString(indent + `"""` + "\n")
+}
+
+func literal(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprint(value)
+}
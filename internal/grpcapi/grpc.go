@@ -0,0 +1,243 @@
+// Package grpcapi serves the forum API of forum.proto over gRPC. There is no
+// protobuf or gRPC library in the build, so both the message encoding and the
+// gRPC framing over HTTP/2 are written here against the published specs.
+//
+// Calls are answered by a Service, which the server implements on the same
+// storage and with the same access and content checks as the REST API.
+package grpcapi
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ServiceName = "forum.Forum"
+
+	maxMessageSize = 4 << 20
+)
+
+// gRPC status codes.
+const (
+	codeOK                 = 0
+	codeCanceled           = 1
+	codeUnknown            = 2
+	codeInvalidArgument    = 3
+	codeDeadlineExceeded   = 4
+	codeNotFound           = 5
+	codeAlreadyExists      = 6
+	codePermissionDenied   = 7
+	codeResourceExhausted  = 8
+	codeFailedPrecondition = 9
+	codeUnimplemented      = 12
+	codeInternal           = 13
+	codeUnavailable        = 14
+	codeUnauthenticated    = 16
+)
+
+// statusError ends a call with a gRPC status other than OK.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (err *statusError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", err.code, err.message)
+}
+
+func newStatus(code int, message string) error {
+	return &statusError{code: code, message: message}
+}
+
+// Handler serves gRPC requests for ServiceName.
+type Handler struct {
+	service Service
+	methods map[string]func(c *call) error
+}
+
+// NewHandler answers calls with service.
+func NewHandler(service Service) *Handler {
+	h := &Handler{service: service}
+	h.methods = map[string]func(c *call) error{
+		"CreateForum":     h.createForum,
+		"GetForum":        h.getForum,
+		"GetForumThreads": h.getForumThreads,
+		"GetForumUsers":   h.getForumUsers,
+		"CreateThread":    h.createThread,
+		"GetThread":       h.getThread,
+		"UpdateThread":    h.updateThread,
+		"Vote":            h.vote,
+		"CreatePosts":     h.createPosts,
+		"GetThreadPosts":  h.getThreadPosts,
+		"GetPost":         h.getPost,
+		"UpdatePost":      h.updatePost,
+		"CreateUser":      h.createUser,
+		"GetUser":         h.getUser,
+		"UpdateUser":      h.updateUser,
+		"GetStatus":       h.getStatus,
+		"Clear":           h.clear,
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	c := &call{w: w, r: r, ctx: r.Context()}
+	timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout"))
+	if ok {
+		ctx, cancel := context.WithTimeout(c.ctx, timeout)
+		defer cancel()
+		c.ctx = ctx
+	}
+	err := h.dispatch(c)
+	code, message := codeOK, ""
+	if err != nil {
+		code, message = codeInternal, err.Error()
+		if status, ok := err.(*statusError); ok {
+			code, message = status.code, status.message
+		}
+		switch c.ctx.Err() {
+		case context.DeadlineExceeded:
+			code, message = codeDeadlineExceeded, "deadline exceeded"
+		case context.Canceled:
+			code, message = codeCanceled, "canceled"
+		}
+	}
+	if !c.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(message))
+	}
+}
+
+func (h *Handler) dispatch(c *call) error {
+	service, method := "", ""
+	path := strings.TrimPrefix(c.r.URL.Path, "/")
+	slash := strings.LastIndexByte(path, '/')
+	if slash > 0 {
+		service, method = path[:slash], path[slash+1:]
+	}
+	handle, ok := h.methods[method]
+	if service != ServiceName || !ok {
+		return newStatus(codeUnimplemented, "unknown method "+c.r.URL.Path)
+	}
+	if encoding := c.r.Header.Get("Grpc-Encoding"); encoding != "" && encoding != "identity" {
+		c.w.Header().Set("Grpc-Accept-Encoding", "identity")
+		return newStatus(codeUnimplemented, "compression "+encoding+" is not supported")
+	}
+	ctx, err := h.service.Authenticate(c.r.WithContext(c.ctx))
+	if err != nil {
+		return err
+	}
+	c.ctx = ctx
+	return handle(c)
+}
+
+// call is one RPC in progress.
+type call struct {
+	w           http.ResponseWriter
+	r           *http.Request
+	ctx         context.Context
+	wroteHeader bool
+}
+
+// read decodes the request message, the only one a unary or server-streaming
+// call sends.
+func (c *call) read(m message) error {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(c.r.Body, header)
+	if err != nil {
+		return newStatus(codeInvalidArgument, "missing request message")
+	}
+	if header[0] != 0 {
+		return newStatus(codeUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return newStatus(codeResourceExhausted, fmt.Sprintf("request message larger than %d bytes", maxMessageSize))
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(c.r.Body, data)
+	if err != nil {
+		return newStatus(codeInvalidArgument, "truncated request message")
+	}
+	err = unmarshal(data, m)
+	if err != nil {
+		return newStatus(codeInvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// send writes one response message and flushes it to the client.
+func (c *call) send(m message) error {
+	data := marshal(m)
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+	if !c.wroteHeader {
+		c.w.WriteHeader(http.StatusOK)
+		c.wroteHeader = true
+	}
+	_, err := c.w.Write(frame)
+	if err != nil {
+		slog.Warn("unable to write grpc message", "error", err.Error())
+		return newStatus(codeCanceled, "client went away")
+	}
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// parseTimeout reads the grpc-timeout header: up to eight digits and a unit.
+func parseTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(value[:len(value)-1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// encodeMessage percent-encodes grpc-message as the protocol asks.
+func encodeMessage(message string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,611 @@
+package grpcapi
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+)
+
+// The messages of forum.proto. Those mirroring internal/models are the model
+// types themselves, so they go to the Service unchanged.
+
+type empty struct{}
+
+func (m *empty) marshal(e *encoder) {}
+
+func (m *empty) unmarshal(d *decoder, field int, wireType int) error {
+	return d.skip(wireType)
+}
+
+type forum models.Forum
+
+func (m *forum) marshal(e *encoder) {
+	e.int64(1, m.Posts)
+	e.string(2, m.Slug)
+	e.int32(3, m.Threads)
+	e.string(4, m.Title)
+	e.string(5, m.User)
+}
+
+func (m *forum) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Posts, err = d.int64(wireType)
+	case 2:
+		m.Slug, err = d.string(wireType)
+	case 3:
+		m.Threads, err = d.int32(wireType)
+	case 4:
+		m.Title, err = d.string(wireType)
+	case 5:
+		m.User, err = d.string(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type thread models.Thread
+
+func (m *thread) marshal(e *encoder) {
+	e.string(1, m.Author)
+	e.string(2, m.Created)
+	e.string(3, m.Forum)
+	e.int32(4, m.ID)
+	e.string(5, m.Message)
+	e.string(6, m.MessageHTML)
+	e.string(7, m.Slug)
+	e.string(8, m.Title)
+	e.int32(9, m.Votes)
+}
+
+func (m *thread) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Author, err = d.string(wireType)
+	case 2:
+		m.Created, err = d.string(wireType)
+	case 3:
+		m.Forum, err = d.string(wireType)
+	case 4:
+		m.ID, err = d.int32(wireType)
+	case 5:
+		m.Message, err = d.string(wireType)
+	case 6:
+		m.MessageHTML, err = d.string(wireType)
+	case 7:
+		m.Slug, err = d.string(wireType)
+	case 8:
+		m.Title, err = d.string(wireType)
+	case 9:
+		m.Votes, err = d.int32(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type threads models.Threads
+
+func (m *threads) marshal(e *encoder) {
+	for _, item := range *m {
+		e.message(1, (*thread)(item))
+	}
+}
+
+func (m *threads) unmarshal(d *decoder, field int, wireType int) error {
+	if field != 1 {
+		return d.skip(wireType)
+	}
+	item := new(models.Thread)
+	*m = append(*m, item)
+	return d.message(wireType, (*thread)(item))
+}
+
+type attachment models.Attachment
+
+func (m *attachment) marshal(e *encoder) {
+	e.string(1, m.ContentType)
+	e.string(2, m.Created)
+	e.int64(3, m.ID)
+	e.string(4, m.Name)
+	e.string(5, m.Owner)
+	e.int64(6, m.Post)
+	e.int64(7, m.Size)
+}
+
+func (m *attachment) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.ContentType, err = d.string(wireType)
+	case 2:
+		m.Created, err = d.string(wireType)
+	case 3:
+		m.ID, err = d.int64(wireType)
+	case 4:
+		m.Name, err = d.string(wireType)
+	case 5:
+		m.Owner, err = d.string(wireType)
+	case 6:
+		m.Post, err = d.int64(wireType)
+	case 7:
+		m.Size, err = d.int64(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type post models.Post
+
+func (m *post) marshal(e *encoder) {
+	for _, item := range m.Attachments {
+		e.message(1, (*attachment)(item))
+	}
+	e.string(2, m.Author)
+	e.string(3, m.Created)
+	e.string(4, m.Forum)
+	e.int64(5, m.ID)
+	e.bool(6, m.IsEdited)
+	e.string(7, m.Message)
+	e.string(8, m.MessageHTML)
+	e.int64(9, m.Parent)
+	e.bool(10, m.Pending)
+	e.int32(11, m.Thread)
+}
+
+func (m *post) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		item := new(models.Attachment)
+		m.Attachments = append(m.Attachments, item)
+		err = d.message(wireType, (*attachment)(item))
+	case 2:
+		m.Author, err = d.string(wireType)
+	case 3:
+		m.Created, err = d.string(wireType)
+	case 4:
+		m.Forum, err = d.string(wireType)
+	case 5:
+		m.ID, err = d.int64(wireType)
+	case 6:
+		m.IsEdited, err = d.bool(wireType)
+	case 7:
+		m.Message, err = d.string(wireType)
+	case 8:
+		m.MessageHTML, err = d.string(wireType)
+	case 9:
+		m.Parent, err = d.int64(wireType)
+	case 10:
+		m.Pending, err = d.bool(wireType)
+	case 11:
+		m.Thread, err = d.int32(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type posts models.Posts
+
+func (m *posts) marshal(e *encoder) {
+	for _, item := range *m {
+		e.message(1, (*post)(item))
+	}
+}
+
+func (m *posts) unmarshal(d *decoder, field int, wireType int) error {
+	if field != 1 {
+		return d.skip(wireType)
+	}
+	item := new(models.Post)
+	*m = append(*m, item)
+	return d.message(wireType, (*post)(item))
+}
+
+type postFull models.PostFull
+
+func (m *postFull) marshal(e *encoder) {
+	if m.Author != nil {
+		e.message(1, (*user)(m.Author))
+	}
+	if m.Forum != nil {
+		e.message(2, (*forum)(m.Forum))
+	}
+	if m.Post != nil {
+		e.message(3, (*post)(m.Post))
+	}
+	if m.Thread != nil {
+		e.message(4, (*thread)(m.Thread))
+	}
+}
+
+func (m *postFull) unmarshal(d *decoder, field int, wireType int) error {
+	switch field {
+	case 1:
+		m.Author = new(models.User)
+		return d.message(wireType, (*user)(m.Author))
+	case 2:
+		m.Forum = new(models.Forum)
+		return d.message(wireType, (*forum)(m.Forum))
+	case 3:
+		m.Post = new(models.Post)
+		return d.message(wireType, (*post)(m.Post))
+	case 4:
+		m.Thread = new(models.Thread)
+		return d.message(wireType, (*thread)(m.Thread))
+	}
+	return d.skip(wireType)
+}
+
+type user models.User
+
+func (m *user) marshal(e *encoder) {
+	e.string(1, m.About)
+	e.string(2, m.Email)
+	e.string(3, m.Fullname)
+	e.string(4, m.Nickname)
+	e.string(5, m.Password)
+}
+
+func (m *user) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.About, err = d.string(wireType)
+	case 2:
+		m.Email, err = d.string(wireType)
+	case 3:
+		m.Fullname, err = d.string(wireType)
+	case 4:
+		m.Nickname, err = d.string(wireType)
+	case 5:
+		m.Password, err = d.string(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type users models.Users
+
+func (m *users) marshal(e *encoder) {
+	for _, item := range *m {
+		e.message(1, (*user)(item))
+	}
+}
+
+func (m *users) unmarshal(d *decoder, field int, wireType int) error {
+	if field != 1 {
+		return d.skip(wireType)
+	}
+	item := new(models.User)
+	*m = append(*m, item)
+	return d.message(wireType, (*user)(item))
+}
+
+type vote models.Vote
+
+func (m *vote) marshal(e *encoder) {
+	e.string(1, m.Nickname)
+	e.int32(2, m.Voice)
+}
+
+func (m *vote) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Nickname, err = d.string(wireType)
+	case 2:
+		m.Voice, err = d.int32(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type status models.Status
+
+func (m *status) marshal(e *encoder) {
+	e.int32(1, m.Forum)
+	e.int64(2, m.Post)
+	e.int32(3, m.Thread)
+	e.int32(4, m.User)
+}
+
+func (m *status) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Forum, err = d.int32(wireType)
+	case 2:
+		m.Post, err = d.int64(wireType)
+	case 3:
+		m.Thread, err = d.int32(wireType)
+	case 4:
+		m.User, err = d.int32(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type forumRequest struct {
+	Slug string
+}
+
+func (m *forumRequest) marshal(e *encoder) {
+	e.string(1, m.Slug)
+}
+
+func (m *forumRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	if field != 1 {
+		return d.skip(wireType)
+	}
+	m.Slug, err = d.string(wireType)
+	return err
+}
+
+type listRequest struct {
+	Slug  string
+	Limit int32
+	Since string
+	Desc  bool
+}
+
+func (m *listRequest) marshal(e *encoder) {
+	e.string(1, m.Slug)
+	e.int32(2, m.Limit)
+	e.string(3, m.Since)
+	e.bool(4, m.Desc)
+}
+
+func (m *listRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Slug, err = d.string(wireType)
+	case 2:
+		m.Limit, err = d.int32(wireType)
+	case 3:
+		m.Since, err = d.string(wireType)
+	case 4:
+		m.Desc, err = d.bool(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type createThreadRequest struct {
+	Forum  string
+	Thread models.Thread
+}
+
+func (m *createThreadRequest) marshal(e *encoder) {
+	e.string(1, m.Forum)
+	e.message(2, (*thread)(&m.Thread))
+}
+
+func (m *createThreadRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Forum, err = d.string(wireType)
+	case 2:
+		err = d.message(wireType, (*thread)(&m.Thread))
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type threadRequest struct {
+	SlugOrId string
+}
+
+func (m *threadRequest) marshal(e *encoder) {
+	e.string(1, m.SlugOrId)
+}
+
+func (m *threadRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	if field != 1 {
+		return d.skip(wireType)
+	}
+	m.SlugOrId, err = d.string(wireType)
+	return err
+}
+
+type updateThreadRequest struct {
+	SlugOrId string
+	Update   models.ThreadUpdate
+}
+
+func (m *updateThreadRequest) marshal(e *encoder) {
+	e.string(1, m.SlugOrId)
+	e.string(2, m.Update.Message)
+	e.string(3, m.Update.Title)
+}
+
+func (m *updateThreadRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.SlugOrId, err = d.string(wireType)
+	case 2:
+		m.Update.Message, err = d.string(wireType)
+	case 3:
+		m.Update.Title, err = d.string(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type voteRequest struct {
+	SlugOrId string
+	Vote     models.Vote
+}
+
+func (m *voteRequest) marshal(e *encoder) {
+	e.string(1, m.SlugOrId)
+	e.message(2, (*vote)(&m.Vote))
+}
+
+func (m *voteRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.SlugOrId, err = d.string(wireType)
+	case 2:
+		err = d.message(wireType, (*vote)(&m.Vote))
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type createPostsRequest struct {
+	SlugOrId string
+	Posts    models.Posts
+}
+
+func (m *createPostsRequest) marshal(e *encoder) {
+	e.string(1, m.SlugOrId)
+	for _, item := range m.Posts {
+		e.message(2, (*post)(item))
+	}
+}
+
+func (m *createPostsRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.SlugOrId, err = d.string(wireType)
+	case 2:
+		item := new(models.Post)
+		m.Posts = append(m.Posts, item)
+		err = d.message(wireType, (*post)(item))
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type threadPostsRequest struct {
+	SlugOrId string
+	Sort     string
+	Desc     bool
+	Since    int64
+	PageSize int32
+}
+
+func (m *threadPostsRequest) marshal(e *encoder) {
+	e.string(1, m.SlugOrId)
+	e.string(2, m.Sort)
+	e.bool(3, m.Desc)
+	e.int64(4, m.Since)
+	e.int32(5, m.PageSize)
+}
+
+func (m *threadPostsRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.SlugOrId, err = d.string(wireType)
+	case 2:
+		m.Sort, err = d.string(wireType)
+	case 3:
+		m.Desc, err = d.bool(wireType)
+	case 4:
+		m.Since, err = d.int64(wireType)
+	case 5:
+		m.PageSize, err = d.int32(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type postRequest struct {
+	ID      int64
+	Related []string
+}
+
+func (m *postRequest) marshal(e *encoder) {
+	e.int64(1, m.ID)
+	for _, item := range m.Related {
+		e.key(2, wireBytes)
+		e.varint(uint64(len(item)))
+		e.buf = append(e.buf, item...)
+	}
+}
+
+func (m *postRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.ID, err = d.int64(wireType)
+	case 2:
+		item := ""
+		item, err = d.string(wireType)
+		m.Related = append(m.Related, item)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type updatePostRequest struct {
+	ID     int64
+	Update models.PostUpdate
+}
+
+func (m *updatePostRequest) marshal(e *encoder) {
+	e.int64(1, m.ID)
+	e.string(2, m.Update.Message)
+}
+
+func (m *updatePostRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.ID, err = d.int64(wireType)
+	case 2:
+		m.Update.Message, err = d.string(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+type userRequest struct {
+	Nickname string
+}
+
+func (m *userRequest) marshal(e *encoder) {
+	e.string(1, m.Nickname)
+}
+
+func (m *userRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	if field != 1 {
+		return d.skip(wireType)
+	}
+	m.Nickname, err = d.string(wireType)
+	return err
+}
+
+type updateUserRequest struct {
+	Nickname string
+	Update   models.UserUpdate
+}
+
+func (m *updateUserRequest) marshal(e *encoder) {
+	e.string(1, m.Nickname)
+	e.string(2, m.Update.About)
+	e.string(3, m.Update.Email)
+	e.string(4, m.Update.Fullname)
+}
+
+func (m *updateUserRequest) unmarshal(d *decoder, field int, wireType int) (err error) {
+	switch field {
+	case 1:
+		m.Nickname, err = d.string(wireType)
+	case 2:
+		m.Update.About, err = d.string(wireType)
+	case 3:
+		m.Update.Email, err = d.string(wireType)
+	case 4:
+		m.Update.Fullname, err = d.string(wireType)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
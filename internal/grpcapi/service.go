@@ -0,0 +1,268 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+)
+
+const defaultPageSize = 100
+
+// Service answers the calls of forum.proto. A method fails with an error made
+// by Error to end the call with that status; any other error ends it as
+// INTERNAL.
+type Service interface {
+	// Authenticate resolves the credentials the call metadata carries and
+	// returns the context the call runs in.
+	Authenticate(r *http.Request) (context.Context, error)
+
+	CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error)
+	GetForum(ctx context.Context, slug string) (models.Forum, error)
+	// GetForumThreads and GetForumUsers take a limit of 0 for the default one.
+	GetForumThreads(ctx context.Context, slug string, limit int, since string, desc bool) (models.Threads, error)
+	GetForumUsers(ctx context.Context, slug string, limit int, since string, desc bool) (models.Users, error)
+
+	CreateThread(ctx context.Context, forum string, thread models.Thread) (models.Thread, error)
+	GetThread(ctx context.Context, slugOrId string) (models.Thread, error)
+	UpdateThread(ctx context.Context, slugOrId string, update models.ThreadUpdate) (models.Thread, error)
+	Vote(ctx context.Context, slugOrId string, vote models.Vote) (models.Thread, error)
+
+	CreatePosts(ctx context.Context, slugOrId string, posts models.Posts) (models.Posts, error)
+	// GetThreadPosts returns a page of limit posts, root posts for
+	// parent_tree, following the post since, or from the start for 0.
+	GetThreadPosts(ctx context.Context, slugOrId string, limit int, since int64, sort string, desc bool) (models.Posts, error)
+	GetPost(ctx context.Context, id int64, related []string) (models.PostFull, error)
+	UpdatePost(ctx context.Context, id int64, update models.PostUpdate) (models.Post, error)
+
+	CreateUser(ctx context.Context, user models.User) (models.User, error)
+	GetUser(ctx context.Context, nickname string) (models.User, error)
+	UpdateUser(ctx context.Context, nickname string, update models.UserUpdate) (models.User, error)
+
+	GetStatus(ctx context.Context) (models.Status, error)
+	Clear(ctx context.Context) error
+}
+
+// Error is the error a Service method fails with where the REST API answers
+// httpStatus; the call ends with the gRPC status closest to it.
+func Error(httpStatus int, message string) error {
+	return newStatus(statusCode(httpStatus), message)
+}
+
+func (h *Handler) createForum(c *call) error {
+	in := new(forum)
+	return c.unary(in, func() (message, error) {
+		created, err := h.service.CreateForum(c.ctx, models.Forum(*in))
+		return (*forum)(&created), err
+	})
+}
+
+func (h *Handler) getForum(c *call) error {
+	in := new(forumRequest)
+	return c.unary(in, func() (message, error) {
+		found, err := h.service.GetForum(c.ctx, in.Slug)
+		return (*forum)(&found), err
+	})
+}
+
+func (h *Handler) getForumThreads(c *call) error {
+	in := new(listRequest)
+	return c.unary(in, func() (message, error) {
+		list, err := h.service.GetForumThreads(c.ctx, in.Slug, int(in.Limit), in.Since, in.Desc)
+		return (*threads)(&list), err
+	})
+}
+
+func (h *Handler) getForumUsers(c *call) error {
+	in := new(listRequest)
+	return c.unary(in, func() (message, error) {
+		list, err := h.service.GetForumUsers(c.ctx, in.Slug, int(in.Limit), in.Since, in.Desc)
+		return (*users)(&list), err
+	})
+}
+
+func (h *Handler) createThread(c *call) error {
+	in := new(createThreadRequest)
+	return c.unary(in, func() (message, error) {
+		created, err := h.service.CreateThread(c.ctx, in.Forum, in.Thread)
+		return (*thread)(&created), err
+	})
+}
+
+func (h *Handler) getThread(c *call) error {
+	in := new(threadRequest)
+	return c.unary(in, func() (message, error) {
+		found, err := h.service.GetThread(c.ctx, in.SlugOrId)
+		return (*thread)(&found), err
+	})
+}
+
+func (h *Handler) updateThread(c *call) error {
+	in := new(updateThreadRequest)
+	return c.unary(in, func() (message, error) {
+		updated, err := h.service.UpdateThread(c.ctx, in.SlugOrId, in.Update)
+		return (*thread)(&updated), err
+	})
+}
+
+func (h *Handler) vote(c *call) error {
+	in := new(voteRequest)
+	return c.unary(in, func() (message, error) {
+		voted, err := h.service.Vote(c.ctx, in.SlugOrId, in.Vote)
+		return (*thread)(&voted), err
+	})
+}
+
+func (h *Handler) createPosts(c *call) error {
+	in := new(createPostsRequest)
+	return c.unary(in, func() (message, error) {
+		if in.Posts == nil {
+			in.Posts = models.Posts{}
+		}
+		created, err := h.service.CreatePosts(c.ctx, in.SlugOrId, in.Posts)
+		return (*posts)(&created), err
+	})
+}
+
+// getThreadPosts pages through the posts of the thread, continuing each page
+// after the last post sent, until a page comes back short or the client
+// goes away.
+func (h *Handler) getThreadPosts(c *call) error {
+	in := new(threadPostsRequest)
+	err := c.read(in)
+	if err != nil {
+		return err
+	}
+	switch in.Sort {
+	case "":
+		in.Sort = "flat"
+	case "flat", "tree", "parent_tree":
+	default:
+		return newStatus(codeInvalidArgument, "unknown sort "+in.Sort)
+	}
+	pageSize := int(in.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	since := in.Since
+	for {
+		if c.ctx.Err() != nil {
+			return c.ctx.Err()
+		}
+		page, err := h.service.GetThreadPosts(c.ctx, in.SlugOrId, pageSize, since, in.Sort, in.Desc)
+		if err != nil {
+			return err
+		}
+		for _, item := range page {
+			err = c.send((*post)(item))
+			if err != nil {
+				return err
+			}
+		}
+		// For parent_tree the limit counts root posts, so only an empty page
+		// tells that there are no more.
+		if len(page) == 0 || in.Sort != "parent_tree" && len(page) < pageSize {
+			return nil
+		}
+		since = page[len(page)-1].ID
+	}
+}
+
+func (h *Handler) getPost(c *call) error {
+	in := new(postRequest)
+	return c.unary(in, func() (message, error) {
+		for _, related := range in.Related {
+			if related != "user" && related != "forum" && related != "thread" {
+				return nil, newStatus(codeInvalidArgument, "unknown related object "+related)
+			}
+		}
+		found, err := h.service.GetPost(c.ctx, in.ID, in.Related)
+		return (*postFull)(&found), err
+	})
+}
+
+func (h *Handler) updatePost(c *call) error {
+	in := new(updatePostRequest)
+	return c.unary(in, func() (message, error) {
+		updated, err := h.service.UpdatePost(c.ctx, in.ID, in.Update)
+		return (*post)(&updated), err
+	})
+}
+
+func (h *Handler) createUser(c *call) error {
+	in := new(user)
+	return c.unary(in, func() (message, error) {
+		created, err := h.service.CreateUser(c.ctx, models.User(*in))
+		return (*user)(&created), err
+	})
+}
+
+func (h *Handler) getUser(c *call) error {
+	in := new(userRequest)
+	return c.unary(in, func() (message, error) {
+		found, err := h.service.GetUser(c.ctx, in.Nickname)
+		return (*user)(&found), err
+	})
+}
+
+func (h *Handler) updateUser(c *call) error {
+	in := new(updateUserRequest)
+	return c.unary(in, func() (message, error) {
+		updated, err := h.service.UpdateUser(c.ctx, in.Nickname, in.Update)
+		return (*user)(&updated), err
+	})
+}
+
+func (h *Handler) getStatus(c *call) error {
+	in := new(empty)
+	return c.unary(in, func() (message, error) {
+		found, err := h.service.GetStatus(c.ctx)
+		return (*status)(&found), err
+	})
+}
+
+func (h *Handler) clear(c *call) error {
+	in := new(empty)
+	return c.unary(in, func() (message, error) {
+		return new(empty), h.service.Clear(c.ctx)
+	})
+}
+
+// unary reads in, runs the service call and sends back the message it
+// answers with.
+func (c *call) unary(in message, run func() (message, error)) error {
+	err := c.read(in)
+	if err != nil {
+		return err
+	}
+	out, err := run()
+	if err != nil {
+		return err
+	}
+	return c.send(out)
+}
+
+// statusCode maps an HTTP status of the REST API to the gRPC code closest to
+// it.
+func statusCode(httpStatus int) int {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codeInvalidArgument
+	case http.StatusUnauthorized:
+		return codeUnauthenticated
+	case http.StatusForbidden:
+		return codePermissionDenied
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeAlreadyExists
+	case http.StatusPreconditionFailed:
+		return codeFailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codeResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	case http.StatusInternalServerError:
+		return codeInternal
+	}
+	return codeUnknown
+}
@@ -0,0 +1,157 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type userKey struct{}
+
+// fakeService answers the calls the tests make; the others are left to the
+// embedded nil Service.
+type fakeService struct {
+	Service
+	posts models.Posts
+	pages []int64
+}
+
+func (s *fakeService) Authenticate(r *http.Request) (context.Context, error) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		return nil, Error(http.StatusUnauthorized, "Invalid or expired token")
+	}
+	return context.WithValue(r.Context(), userKey{}, "j.sparrow"), nil
+}
+
+func (s *fakeService) GetForum(ctx context.Context, slug string) (models.Forum, error) {
+	if slug != "pirate-stories" {
+		return models.Forum{}, Error(http.StatusNotFound, "No such item")
+	}
+	user, _ := ctx.Value(userKey{}).(string)
+	return models.Forum{Slug: slug, Title: "Pirate stories", User: user}, nil
+}
+
+func (s *fakeService) GetThreadPosts(ctx context.Context, slugOrId string, limit int, since int64,
+	sort string, desc bool) (models.Posts, error) {
+	s.pages = append(s.pages, since)
+	page := models.Posts{}
+	for _, post := range s.posts {
+		if post.ID > since && len(page) < limit {
+			page = append(page, post)
+		}
+	}
+	return page, nil
+}
+
+func serve(service Service, method string, request message, token string) *httptest.ResponseRecorder {
+	data := marshal(request)
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	r := httptest.NewRequest(http.MethodPost, "/"+ServiceName+"/"+method, bytes.NewReader(frame))
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	NewHandler(service).ServeHTTP(w, r)
+	return w
+}
+
+// messages splits a response body into the messages it frames.
+func messages(t *testing.T, body []byte) [][]byte {
+	list := [][]byte{}
+	for len(body) != 0 {
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) > len(body)-5 {
+			t.Fatalf("malformed response frame %x", body)
+		}
+		size := int(binary.BigEndian.Uint32(body[1:5]))
+		list = append(list, body[5:5+size])
+		body = body[5+size:]
+	}
+	return list
+}
+
+func TestUnaryCall(t *testing.T) {
+	w := serve(&fakeService{}, "GetForum", &forumRequest{Slug: "pirate-stories"}, "token")
+
+	response := w.Result()
+	if status := response.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("grpc-status %s: %s", status, response.Trailer.Get("Grpc-Message"))
+	}
+	list := messages(t, w.Body.Bytes())
+	if len(list) != 1 {
+		t.Fatalf("got %d messages", len(list))
+	}
+	got := forum{}
+	err := unmarshal(list[0], &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Slug != "pirate-stories" || got.Title != "Pirate stories" || got.User != "j.sparrow" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	w := serve(&fakeService{}, "GetForum", &forumRequest{Slug: "unknown"}, "token")
+
+	response := w.Result()
+	if status := response.Trailer.Get("Grpc-Status"); status != "5" {
+		t.Errorf("grpc-status %s, want 5", status)
+	}
+	if message := response.Trailer.Get("Grpc-Message"); message != "No such item" {
+		t.Errorf("grpc-message %q", message)
+	}
+	if len(w.Body.Bytes()) != 0 {
+		t.Errorf("unexpected response message %x", w.Body.Bytes())
+	}
+}
+
+func TestThreadPostsStreamPages(t *testing.T) {
+	service := &fakeService{}
+	for id := int64(1); id <= 5; id++ {
+		service.posts = append(service.posts, &models.Post{ID: id, Message: "Yo ho"})
+	}
+	w := serve(service, "GetThreadPosts", &threadPostsRequest{SlugOrId: "1", PageSize: 2}, "token")
+
+	response := w.Result()
+	if status := response.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("grpc-status %s: %s", status, response.Trailer.Get("Grpc-Message"))
+	}
+	list := messages(t, w.Body.Bytes())
+	if len(list) != 5 {
+		t.Fatalf("got %d posts, want 5", len(list))
+	}
+	for i, data := range list {
+		got := post{}
+		err := unmarshal(data, &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != int64(i+1) {
+			t.Errorf("post %d has id %d", i, got.ID)
+		}
+	}
+	want := []int64{0, 2, 4}
+	if len(service.pages) != len(want) {
+		t.Fatalf("read pages after %v, want %v", service.pages, want)
+	}
+	for i := range want {
+		if service.pages[i] != want[i] {
+			t.Errorf("read pages after %v, want %v", service.pages, want)
+			break
+		}
+	}
+}
+
+func TestUnauthenticatedCall(t *testing.T) {
+	w := serve(&fakeService{}, "GetForum", &forumRequest{Slug: "pirate-stories"}, "stolen")
+
+	if status := w.Result().Trailer.Get("Grpc-Status"); status != "16" {
+		t.Errorf("grpc-status %s, want 16", status)
+	}
+}
@@ -0,0 +1,190 @@
+package grpcapi
+
+import (
+	"errors"
+	"math"
+)
+
+// Protobuf wire types used by forum.proto.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// message is a type encoded as a protobuf message.
+type message interface {
+	marshal(e *encoder)
+	unmarshal(d *decoder, field int, wireType int) error
+}
+
+func marshal(m message) []byte {
+	e := &encoder{}
+	m.marshal(e)
+	return e.buf
+}
+
+func unmarshal(data []byte, m message) error {
+	d := &decoder{buf: data}
+	for len(d.buf) > 0 {
+		key, err := d.varint()
+		if err != nil {
+			return err
+		}
+		field := key >> 3
+		if field == 0 || field > math.MaxInt32 {
+			return errMalformed
+		}
+		err = m.unmarshal(d, int(field), int(key&7))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encoder appends fields in wire format. Like proto3 it leaves out scalars
+// holding their zero value.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) key(field int, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *encoder) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	e.key(field, wireBytes)
+	e.varint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.key(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+func (e *encoder) int32(field int, v int32) {
+	e.int64(field, int64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if !v {
+		return
+	}
+	e.key(field, wireVarint)
+	e.varint(1)
+}
+
+// message writes m even when it is empty, as repeated fields need.
+func (e *encoder) message(field int, m message) {
+	nested := marshal(m)
+	e.key(field, wireBytes)
+	e.varint(uint64(len(nested)))
+	e.buf = append(e.buf, nested...)
+}
+
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v := uint64(0)
+	for i := 0; i < 10 && i < len(d.buf); i++ {
+		b := d.buf[i]
+		v |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			d.buf = d.buf[i+1:]
+			return v, nil
+		}
+	}
+	return 0, errMalformed
+}
+
+func (d *decoder) bytes(wireType int) ([]byte, error) {
+	if wireType != wireBytes {
+		return nil, errMalformed
+	}
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)) {
+		return nil, errMalformed
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *decoder) string(wireType int) (string, error) {
+	v, err := d.bytes(wireType)
+	return string(v), err
+}
+
+func (d *decoder) int64(wireType int) (int64, error) {
+	if wireType != wireVarint {
+		return 0, errMalformed
+	}
+	v, err := d.varint()
+	return int64(v), err
+}
+
+func (d *decoder) int32(wireType int) (int32, error) {
+	v, err := d.int64(wireType)
+	return int32(v), err
+}
+
+func (d *decoder) bool(wireType int) (bool, error) {
+	v, err := d.int64(wireType)
+	return v != 0, err
+}
+
+func (d *decoder) message(wireType int, m message) error {
+	v, err := d.bytes(wireType)
+	if err != nil {
+		return err
+	}
+	return unmarshal(v, m)
+}
+
+// skip passes over a field this side does not know.
+func (d *decoder) skip(wireType int) error {
+	size := 0
+	switch wireType {
+	case wireVarint:
+		_, err := d.varint()
+		return err
+	case wireBytes:
+		_, err := d.bytes(wireType)
+		return err
+	case wireFixed64:
+		size = 8
+	case wireFixed32:
+		size = 4
+	default:
+		return errMalformed
+	}
+	if len(d.buf) < size {
+		return errMalformed
+	}
+	d.buf = d.buf[size:]
+	return nil
+}
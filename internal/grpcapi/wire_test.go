@@ -0,0 +1,111 @@
+package grpcapi
+
+import (
+	"bytes"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalWireFormat(t *testing.T) {
+	tests := []struct {
+		m    message
+		want []byte
+	}{
+		{&forumRequest{Slug: "ab"}, []byte{0x0a, 0x02, 'a', 'b'}},
+		{&forumRequest{}, []byte{}},
+		{&threadPostsRequest{Since: 300, Desc: true}, []byte{0x18, 0x01, 0x20, 0xac, 0x02}},
+		{&threadPostsRequest{Since: -1}, []byte{0x20, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{&threadPostsRequest{PageSize: -2}, []byte{0x28, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{&posts{{}, {ID: 1}}, []byte{0x0a, 0x00, 0x0a, 0x02, 0x28, 0x01}},
+	}
+	for _, test := range tests {
+		if got := marshal(test.m); !bytes.Equal(got, test.want) {
+			t.Errorf("marshal(%+v) = %x, want %x", test.m, got, test.want)
+		}
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	sent := postFull{
+		Author: &models.User{Nickname: "j.sparrow", Fullname: "Jack Sparrow"},
+		Post: &models.Post{
+			ID:       1 << 40,
+			Parent:   7,
+			Thread:   -3,
+			Author:   "j.sparrow",
+			Message:  "Yo ho — ünïcode",
+			IsEdited: true,
+			Attachments: []*models.Attachment{
+				{ID: 1, Name: "map.png", ContentType: "image/png", Size: 2048},
+				{ID: 2},
+			},
+		},
+		Thread: &models.Thread{ID: 42, Slug: "black-pearl", Votes: -5},
+	}
+	received := postFull{}
+	err := unmarshal(marshal(&sent), &received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(received, sent) {
+		t.Errorf("round trip gave %+v, want %+v", received, sent)
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	data := []byte{
+		0x78, 0x96, 0x01, // field 15, varint
+		0x81, 0x01, 1, 2, 3, 4, 5, 6, 7, 8, // field 16, fixed64
+		0x8a, 0x01, 0x03, 'x', 'y', 'z', // field 17, bytes
+		0x95, 0x01, 1, 2, 3, 4, // field 18, fixed32
+		0x0a, 0x02, 'a', 'b', // slug
+	}
+	got := forumRequest{}
+	err := unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Slug != "ab" {
+		t.Errorf("slug %q, want ab", got.Slug)
+	}
+}
+
+func TestUnmarshalLastValueWins(t *testing.T) {
+	got := forumRequest{}
+	err := unmarshal([]byte{0x0a, 0x01, 'a', 0x0a, 0x01, 'b'}, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Slug != "b" {
+		t.Errorf("slug %q, want b", got.Slug)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated key":             {0x80},
+		"field zero":                {0x00, 0x01},
+		"varint over ten bytes":     {0x20, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"truncated varint":          {0x20, 0xff},
+		"string past the end":       {0x0a, 0x05, 'a', 'b'},
+		"string as varint":          {0x08, 0x01},
+		"number as bytes":           {0x22, 0x01, 0x01},
+		"truncated fixed64":         {0x79, 1, 2, 3},
+		"truncated fixed32":         {0x7d, 1, 2},
+		"group wire type":           {0x7b},
+		"malformed nested message":  {0x12, 0x02, 0x0a, 0x05},
+		"nested message as varint":  {0x10, 0x01},
+		"huge length":               {0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"field beyond the int32 id": {0x80, 0x80, 0x80, 0x80, 0x80, 0x02},
+	}
+	for name, data := range tests {
+		var m message = &threadPostsRequest{}
+		if name == "malformed nested message" || name == "nested message as varint" {
+			m = &createPostsRequest{}
+		}
+		if err := unmarshal(data, m); err != errMalformed {
+			t.Errorf("%s: unmarshal(%x) = %v, want %v", name, data, err, errMalformed)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package idempotency remembers the responses to requests sent with an
+// idempotency key so that retries get the first response instead of
+// repeating its effects.
+package idempotency
+
+import (
+	"time"
+)
+
+// Response is a stored response. A zero Status marks a request still being
+// served.
+type Response struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+func (resp *Response) Done() bool {
+	return resp.Status != 0
+}
+
+// Store keeps responses by key until they expire. Begin claims key for a
+// request with fingerprint, to expire ttl from now, and returns nil; if the
+// key is already claimed and not expired it returns what is stored instead.
+// Complete stores the response of a claimed key and Release gives the claim
+// up, so that a retry runs again.
+type Store interface {
+	Begin(key string, fingerprint string, ttl time.Duration, now time.Time) (*Response, error)
+	Complete(key string, resp Response) error
+	Release(key string) error
+}
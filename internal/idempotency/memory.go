@@ -0,0 +1,65 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type entry struct {
+	resp    Response
+	expires time.Time
+}
+
+// MemoryStore keeps responses in process memory, so retries are only
+// recognised by the instance that served the first request.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Begin(key string, fingerprint string, ttl time.Duration, now time.Time) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+	e, ok := s.entries[key]
+	if ok && now.Before(e.expires) {
+		resp := e.resp
+		return &resp, nil
+	}
+	s.entries[key] = &entry{resp: Response{Fingerprint: fingerprint}, expires: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.resp = resp
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
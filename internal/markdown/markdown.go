@@ -0,0 +1,360 @@
+// Package markdown renders the forum's Markdown subset to HTML.
+//
+// Supported blocks are paragraphs, where single newlines are line breaks,
+// ATX headings, fenced code, block quotes, flat bullet and numbered lists and
+// horizontal rules. Inline, it knows code spans, **strong**, *emphasis*,
+// ~~strikethrough~~, [links](url), bare http(s) links and backslash escapes.
+// Raw HTML is not supported: every character of the source is escaped and
+// only the tags above are ever produced, so the output is safe to embed.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxDepth = 16
+
+var (
+	headingRegexp  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRegexp     = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	bulletRegexp   = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	numberedRegexp = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	fenceRegexp    = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([^`\\s]*)")
+	quoteRegexp    = regexp.MustCompile(`^ {0,3}>[ ]?(.*)$`)
+	languageRegexp = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+)
+
+// Render converts source to sanitized HTML.
+func Render(source string) string {
+	source = strings.Replace(source, "\r\n", "\n", -1)
+	b := &strings.Builder{}
+	renderBlocks(b, strings.Split(source, "\n"), 0)
+	return b.String()
+}
+
+func renderBlocks(b *strings.Builder, lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case fenceRegexp.MatchString(line):
+			i = renderFence(b, lines, i)
+		case ruleRegexp.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case headingRegexp.MatchString(line):
+			match := headingRegexp.FindStringSubmatch(line)
+			level := strconv.Itoa(len(match[1]))
+			b.WriteString("<h" + level + ">")
+			renderInline(b, match[2], 0, false)
+			b.WriteString("</h" + level + ">\n")
+			i++
+		case quoteRegexp.MatchString(line) && depth < maxDepth:
+			quoted := make([]string, 0)
+			for ; i < len(lines) && quoteRegexp.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteRegexp.FindStringSubmatch(lines[i])[1])
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, depth+1)
+			b.WriteString("</blockquote>\n")
+		case bulletRegexp.MatchString(line):
+			i = renderList(b, lines, i, bulletRegexp, "ul")
+		case numberedRegexp.MatchString(line):
+			i = renderList(b, lines, i, numberedRegexp, "ol")
+		default:
+			paragraph := []string{strings.TrimSpace(line)}
+			for i++; i < len(lines) && !startsBlock(lines[i]); i++ {
+				paragraph = append(paragraph, strings.TrimSpace(lines[i]))
+			}
+			b.WriteString("<p>")
+			renderInline(b, strings.Join(paragraph, "\n"), 0, false)
+			b.WriteString("</p>\n")
+		}
+	}
+}
+
+func startsBlock(line string) bool {
+	return strings.TrimSpace(line) == "" || fenceRegexp.MatchString(line) || ruleRegexp.MatchString(line) ||
+		headingRegexp.MatchString(line) || quoteRegexp.MatchString(line) ||
+		bulletRegexp.MatchString(line) || numberedRegexp.MatchString(line)
+}
+
+// renderFence writes the code block opened at lines[start] and returns the
+// index of the line after it. An unclosed fence runs to the end of the text.
+func renderFence(b *strings.Builder, lines []string, start int) int {
+	match := fenceRegexp.FindStringSubmatch(lines[start])
+	fence := match[1]
+	i := start + 1
+	code := make([]string, 0)
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+	b.WriteString("<pre><code")
+	if languageRegexp.MatchString(match[2]) {
+		b.WriteString(` class="language-` + match[2] + `"`)
+	}
+	b.WriteString(">")
+	for _, line := range code {
+		b.WriteString(html.EscapeString(line))
+		b.WriteString("\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// renderList writes consecutive items matched by marker; indented lines
+// continue the previous item.
+func renderList(b *strings.Builder, lines []string, start int, marker *regexp.Regexp, tag string) int {
+	items := make([]string, 0)
+	i := start
+	for ; i < len(lines); i++ {
+		match := marker.FindStringSubmatch(lines[i])
+		if match != nil {
+			items = append(items, strings.TrimSpace(match[len(match)-1]))
+			continue
+		}
+		if strings.TrimSpace(lines[i]) == "" || (lines[i][0] != ' ' && lines[i][0] != '\t') {
+			break
+		}
+		items[len(items)-1] += "\n" + strings.TrimSpace(lines[i])
+	}
+	b.WriteString("<" + tag)
+	if tag == "ol" {
+		first, _ := strconv.Atoi(numberedRegexp.FindStringSubmatch(lines[start])[1])
+		if first != 1 {
+			b.WriteString(` start="` + strconv.Itoa(first) + `"`)
+		}
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		renderInline(b, item, 0, false)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+var delimiters = []struct {
+	marker string
+	tag    string
+}{
+	{"**", "strong"},
+	{"__", "strong"},
+	{"~~", "del"},
+	{"*", "em"},
+	{"_", "em"},
+}
+
+func renderInline(b *strings.Builder, s string, depth int, inLink bool) {
+	// a marker without a closer after some position has none after any later one
+	unclosed := make(map[string]bool)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!~>|", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			n := runLength(s, i)
+			end := strings.Index(s[i+n:], s[i:i+n])
+			if end >= 0 {
+				b.WriteString("<code>")
+				b.WriteString(html.EscapeString(s[i+n : i+n+end]))
+				b.WriteString("</code>")
+				i += n + end + n
+				continue
+			}
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		case c == '\n':
+			b.WriteString("<br>\n")
+			i++
+			continue
+		case (c == '*' || c == '_' || c == '~') && depth < maxDepth:
+			next, ok := renderDelimited(b, s, i, depth, inLink, unclosed)
+			if ok {
+				i = next
+				continue
+			}
+		case c == '[' && !inLink && depth < maxDepth && !unclosed["]"]:
+			next, ok := renderLink(b, s, i, depth, unclosed)
+			if ok {
+				i = next
+				continue
+			}
+		case c == 'h' && !inLink && (i == 0 || !isWordByte(s[i-1])) &&
+			(strings.HasPrefix(s[i:], "http://") || strings.HasPrefix(s[i:], "https://")):
+			next, ok := renderAutolink(b, s, i)
+			if ok {
+				i = next
+				continue
+			}
+		}
+		writeEscapedByte(b, c)
+		i++
+	}
+}
+
+func renderDelimited(b *strings.Builder, s string, i int, depth int, inLink bool,
+	unclosed map[string]bool) (int, bool) {
+	for _, delimiter := range delimiters {
+		marker := delimiter.marker
+		if !strings.HasPrefix(s[i:], marker) || unclosed[marker] || runLength(s, i) != len(marker) {
+			continue
+		}
+		start := i + len(marker)
+		if start >= len(s) || isSpace(s[start]) {
+			return i, false
+		}
+		if marker[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+			return i, false
+		}
+		end := findCloser(s, start, marker)
+		if end < 0 {
+			unclosed[marker] = true
+			return i, false
+		}
+		b.WriteString("<" + delimiter.tag + ">")
+		renderInline(b, s[start:end], depth+1, inLink)
+		b.WriteString("</" + delimiter.tag + ">")
+		return end + len(marker), true
+	}
+	return i, false
+}
+
+// findCloser returns the position of a run of exactly marker after from that
+// follows a non-space character, or -1.
+func findCloser(s string, from int, marker string) int {
+	for j := from; j < len(s); {
+		if s[j] != marker[0] {
+			j++
+			continue
+		}
+		n := runLength(s, j)
+		if n == len(marker) && j > from && !isSpace(s[j-1]) &&
+			(marker[0] != '_' || j+n >= len(s) || !isWordByte(s[j+n])) {
+			return j
+		}
+		j += n
+	}
+	return -1
+}
+
+func renderLink(b *strings.Builder, s string, i int, depth int, unclosed map[string]bool) (int, bool) {
+	closing := strings.IndexByte(s[i+1:], ']')
+	if closing < 0 {
+		unclosed["]"] = true
+		return i, false
+	}
+	textEnd := i + 1 + closing
+	if textEnd+1 >= len(s) || s[textEnd+1] != '(' {
+		return i, false
+	}
+	urlEnd := strings.IndexByte(s[textEnd+2:], ')')
+	if urlEnd < 0 {
+		return i, false
+	}
+	target := strings.TrimSpace(s[textEnd+2 : textEnd+2+urlEnd])
+	if fields := strings.Fields(target); len(fields) > 0 {
+		target = fields[0]
+	}
+	text := s[i+1 : textEnd]
+	if !isSafeURL(target) || text == "" {
+		return i, false
+	}
+	writeLinkStart(b, target)
+	renderInline(b, text, depth+1, true)
+	b.WriteString("</a>")
+	return textEnd + 2 + urlEnd + 1, true
+}
+
+func renderAutolink(b *strings.Builder, s string, i int) (int, bool) {
+	end := i
+	for end < len(s) && !isSpace(s[end]) && s[end] != '<' && s[end] != '>' && s[end] != '"' {
+		end++
+	}
+	for end > i && strings.IndexByte(".,:;!?)'", s[end-1]) >= 0 {
+		end--
+	}
+	target := s[i:end]
+	if !isSafeURL(target) || strings.HasSuffix(target, "//") {
+		return i, false
+	}
+	writeLinkStart(b, target)
+	b.WriteString(html.EscapeString(target))
+	b.WriteString("</a>")
+	return end, true
+}
+
+func writeLinkStart(b *strings.Builder, target string) {
+	b.WriteString(`<a href="`)
+	b.WriteString(html.EscapeString(target))
+	b.WriteString(`" rel="nofollow noopener noreferrer">`)
+}
+
+// isSafeURL allows http, https and mailto links and relative references, so
+// that javascript: and data: URLs never reach an href.
+func isSafeURL(target string) bool {
+	if target == "" || strings.ContainsAny(target, "\x00\n\r\t") {
+		return false
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return parsed.Host != ""
+	case "mailto":
+		return true
+	case "":
+		return !strings.Contains(strings.SplitN(target, "/", 2)[0], ":")
+	}
+	return false
+}
+
+func writeEscapedByte(b *strings.Builder, c byte) {
+	switch c {
+	case '<':
+		b.WriteString("&lt;")
+	case '>':
+		b.WriteString("&gt;")
+	case '&':
+		b.WriteString("&amp;")
+	case '"':
+		b.WriteString("&#34;")
+	case '\'':
+		b.WriteString("&#39;")
+	default:
+		b.WriteByte(c)
+	}
+}
+
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,128 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderUnsafeLinks(t *testing.T) {
+	for _, source := range []string{
+		"[click](javascript:alert(1))",
+		"[click](JavaScript:alert(1))",
+		"[click](data:text/html;base64,PHNjcmlwdD4=)",
+		"[click](vbscript:msgbox)",
+		"[click]( javascript:alert(1) \"title\")",
+		"[click](https:javascript:alert(1))",
+	} {
+		rendered := Render(source)
+		if strings.Contains(rendered, "<a ") {
+			t.Errorf("Render(%q) = %q, want no link", source, rendered)
+		}
+	}
+}
+
+func TestRenderSafeLinks(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"[site](https://example.com/a?b=1&c=2)",
+			`<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer">site</a></p>` + "\n"},
+		{"[mail](mailto:admin@example.com)",
+			`<p><a href="mailto:admin@example.com" rel="nofollow noopener noreferrer">mail</a></p>` + "\n"},
+		{"[thread](/thread/42/details)",
+			`<p><a href="/thread/42/details" rel="nofollow noopener noreferrer">thread</a></p>` + "\n"},
+		{"see https://example.com/x.",
+			`<p>see <a href="https://example.com/x" rel="nofollow noopener noreferrer">https://example.com/x</a>.</p>` + "\n"},
+	}
+	for _, test := range tests {
+		if rendered := Render(test.source); rendered != test.want {
+			t.Errorf("Render(%q) = %q, want %q", test.source, rendered, test.want)
+		}
+	}
+}
+
+func TestIsSafeURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com":      true,
+		"http://example.com/a":     true,
+		"HTTPS://EXAMPLE.COM":      true,
+		"mailto:a@example.com":     true,
+		"/relative/path":           true,
+		"relative:colon/after":     false,
+		"page?x=1":                 true,
+		"https:///no-host":         false,
+		"javascript:alert(1)":      false,
+		" javascript:alert(1)":     false,
+		"data:text/html,<b>x</b>":  false,
+		"file:///etc/passwd":       false,
+		"https://example.com/\x00": false,
+		"":                         false,
+	}
+	for target, want := range tests {
+		if got := isSafeURL(target); got != want {
+			t.Errorf("isSafeURL(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestRenderEscapesRawHTML(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`<script>alert("x")</script>`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>\n"},
+		{`<img src=x onerror='alert(1)'>`, "<p>&lt;img src=x onerror=&#39;alert(1)&#39;&gt;</p>\n"},
+		{"# <b>title</b>", "<h1>&lt;b&gt;title&lt;/b&gt;</h1>\n"},
+		{"`<b>` & co", "<p><code>&lt;b&gt;</code> &amp; co</p>\n"},
+		{"```html\n<b>\n```", "<pre><code class=\"language-html\">&lt;b&gt;\n</code></pre>\n"},
+		{"```\"><script>\nx\n```", "<pre><code>x\n</code></pre>\n"},
+		{"[<b>](https://example.com)",
+			`<p><a href="https://example.com" rel="nofollow noopener noreferrer">&lt;b&gt;</a></p>` + "\n"},
+		{`[x](https://example.com/"onclick="alert(1))`,
+			`<p><a href="https://example.com/&#34;onclick=&#34;alert(1" rel="nofollow noopener noreferrer">x</a>)</p>` + "\n"},
+	}
+	for _, test := range tests {
+		if rendered := Render(test.source); rendered != test.want {
+			t.Errorf("Render(%q) = %q, want %q", test.source, rendered, test.want)
+		}
+	}
+}
+
+func TestRenderEmphasis(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"**bold *and italic* text**", "<p><strong>bold <em>and italic</em> text</strong></p>\n"},
+		{"*italic **and bold** text*", "<p><em>italic <strong>and bold</strong> text</em></p>\n"},
+		{"***both***", "<p>***both***</p>\n"},
+		{"~~gone **for good**~~", "<p><del>gone <strong>for good</strong></del></p>\n"},
+		{"[**bold** link](https://example.com)",
+			`<p><a href="https://example.com" rel="nofollow noopener noreferrer"><strong>bold</strong> link</a></p>` + "\n"},
+		{"snake_case_name", "<p>snake_case_name</p>\n"},
+		{"2 * 3 * 4", "<p>2 * 3 * 4</p>\n"},
+		{"*unclosed", "<p>*unclosed</p>\n"},
+		{`\*not emphasis\*`, "<p>*not emphasis*</p>\n"},
+	}
+	for _, test := range tests {
+		if rendered := Render(test.source); rendered != test.want {
+			t.Errorf("Render(%q) = %q, want %q", test.source, rendered, test.want)
+		}
+	}
+}
+
+func TestRenderDeepNesting(t *testing.T) {
+	source := strings.Repeat("*a ", 1000) + strings.Repeat(" a*", 1000)
+	rendered := Render(source)
+	if strings.Count(rendered, "<em>") != strings.Count(rendered, "</em>") {
+		t.Errorf("unbalanced emphasis in %q", rendered)
+	}
+	if strings.Count(rendered, "<em>") > maxDepth {
+		t.Errorf("emphasis nested %d deep, want at most %d", strings.Count(rendered, "<em>"), maxDepth)
+	}
+	quotes := Render(strings.Repeat(">", 100) + " deep")
+	if strings.Count(quotes, "<blockquote>") > maxDepth {
+		t.Errorf("quotes nested %d deep, want at most %d", strings.Count(quotes, "<blockquote>"), maxDepth)
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	Created     string `json:"created,omitempty"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	Post        int64  `json:"post,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+type Ban struct {
+	BannedBy string `json:"bannedBy,omitempty"`
+	Created  string `json:"created,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	Forum    string `json:"forum,omitempty"`
+	Nickname string `json:"nickname"`
+	Reason   string `json:"reason,omitempty"`
+}
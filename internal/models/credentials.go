@@ -0,0 +1,6 @@
+package models
+
+type Credentials struct {
+	Nickname string `json:"nickname"`
+	Password string `json:"password"`
+}
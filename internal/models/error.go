@@ -1,5 +1,6 @@
 package models
 
 type Error struct {
-	Message string `json:"message,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Rule    *FilterRule `json:"rule,omitempty"`
 }
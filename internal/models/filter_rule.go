@@ -0,0 +1,12 @@
+package models
+
+type FilterRule struct {
+	Action    string `json:"action"`
+	Created   string `json:"created,omitempty"`
+	CreatedBy string `json:"createdBy,omitempty"`
+	Forum     string `json:"forum,omitempty"`
+	ID        int64  `json:"id,omitempty"`
+	Kind      string `json:"kind"`
+	Pattern   string `json:"pattern,omitempty"`
+	Value     int64  `json:"value,omitempty"`
+}
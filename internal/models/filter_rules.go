@@ -0,0 +1,3 @@
+package models
+
+type FilterRules []*FilterRule
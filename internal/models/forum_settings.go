@@ -0,0 +1,7 @@
+package models
+
+type ForumSettings struct {
+	Forum         string `json:"forum,omitempty"`
+	Premoderation bool   `json:"premoderation"`
+	TrustedAfter  int32  `json:"trustedAfter"`
+}
@@ -0,0 +1,15 @@
+package models
+
+type ImportReport struct {
+	Forum          string            `json:"forum,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Posts          int64             `json:"posts"`
+	RenamedThreads map[string]string `json:"renamedThreads,omitempty"`
+	RenamedUsers   map[string]string `json:"renamedUsers,omitempty"`
+	ReusedUsers    []string          `json:"reusedUsers,omitempty"`
+	SkippedForum   bool              `json:"skippedForum,omitempty"`
+	SkippedThreads []string          `json:"skippedThreads,omitempty"`
+	Threads        int64             `json:"threads"`
+	Users          int64             `json:"users"`
+	Votes          int64             `json:"votes"`
+}
@@ -0,0 +1,13 @@
+package models
+
+type ModerationAction struct {
+	Action    string `json:"action"`
+	Created   string `json:"created,omitempty"`
+	Forum     string `json:"forum,omitempty"`
+	ID        int64  `json:"id,omitempty"`
+	Item      int64  `json:"item,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Moderator string `json:"moderator"`
+	Reason    string `json:"reason,omitempty"`
+	Target    string `json:"target,omitempty"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type Moderator struct {
+	Created   string `json:"created,omitempty"`
+	Forum     string `json:"forum,omitempty"`
+	GrantedBy string `json:"grantedBy,omitempty"`
+	Nickname  string `json:"nickname"`
+}
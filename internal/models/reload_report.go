@@ -0,0 +1,8 @@
+package models
+
+// ReloadReport lists the settings a reload changed: Applied took effect at
+// once, Pending wait for a restart.
+type ReloadReport struct {
+	Applied []string `json:"applied"`
+	Pending []string `json:"pending"`
+}
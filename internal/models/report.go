@@ -0,0 +1,11 @@
+package models
+
+type Report struct {
+	Created  string `json:"created,omitempty"`
+	Forum    string `json:"forum,omitempty"`
+	ID       int64  `json:"id,omitempty"`
+	Item     int64  `json:"item,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Reason   string `json:"reason"`
+	Reporter string `json:"reporter,omitempty"`
+}
@@ -0,0 +1,7 @@
+package models
+
+type ReportResolution struct {
+	Action  string `json:"action"`
+	Expires string `json:"expires,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
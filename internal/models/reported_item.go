@@ -0,0 +1,13 @@
+package models
+
+type ReportedItem struct {
+	Count         int32     `json:"count"`
+	FirstReported string    `json:"firstReported,omitempty"`
+	Forum         string    `json:"forum,omitempty"`
+	ID            int64     `json:"id"`
+	Kind          string    `json:"kind"`
+	LastReported  string    `json:"lastReported,omitempty"`
+	Post          *PostFull `json:"post,omitempty"`
+	Reasons       []string  `json:"reasons"`
+	Thread        *Thread   `json:"thread,omitempty"`
+}
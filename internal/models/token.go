@@ -0,0 +1,11 @@
+package models
+
+type Token struct {
+	Created  string `json:"created,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	ID       int64  `json:"id,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Nickname string `json:"nickname,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
@@ -5,4 +5,5 @@ type User struct {
 	Email    string `json:"email"`
 	Fullname string `json:"fullname"`
 	Nickname string `json:"nickname,omitempty"`
+	Password string `json:"password,omitempty"`
 }
@@ -0,0 +1,90 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+func (doc *Document) checkStringValue(schema *Schema, value string, where string) error {
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		return invalid("%s must be at least %d characters long", where, *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		return invalid("%s must be at most %d characters long", where, *schema.MaxLength)
+	}
+	if schema.Pattern != "" && !doc.patterns[schema.Pattern].MatchString(value) {
+		return invalid("%s does not match %s", where, schema.Pattern)
+	}
+	if schema.Format == "date-time" {
+		_, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return invalid("%s must be an RFC 3339 date-time", where)
+		}
+	}
+	return nil
+}
+
+func checkNumber(schema *Schema, number json.Number, where string) error {
+	value, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return invalid("%s must be a number", where)
+	}
+	if schema.Type == "integer" {
+		bits := 64
+		if schema.Format == "int32" {
+			bits = 32
+		}
+		_, err = strconv.ParseInt(string(number), 10, bits)
+		if err != nil {
+			return invalid("%s must be an integer of %d bits", where, bits)
+		}
+	}
+	if schema.Minimum != nil && value < *schema.Minimum {
+		return invalid("%s must be at least %s", where, formatNumber(*schema.Minimum))
+	}
+	if schema.Maximum != nil && value > *schema.Maximum {
+		return invalid("%s must be at most %s", where, formatNumber(*schema.Maximum))
+	}
+	return nil
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	if number, ok := value.(json.Number); ok {
+		parsed, err := number.Float64()
+		if err != nil {
+			return false
+		}
+		value = parsed
+	}
+	for _, allowed := range enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	items := make([]string, 0, len(enum))
+	for _, item := range enum {
+		if number, ok := item.(float64); ok {
+			items = append(items, formatNumber(number))
+			continue
+		}
+		items = append(items, fmt.Sprint(item))
+	}
+	return strings.Join(items, ", ")
+}
+
+func formatNumber(number float64) string {
+	if number == math.Trunc(number) {
+		return strconv.FormatFloat(number, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(number, 'g', -1, 64)
+}
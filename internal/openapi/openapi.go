@@ -0,0 +1,488 @@
+// Package openapi serves the API description and checks requests against it.
+// Only the parts of OpenAPI 3 the document uses are understood: path, query and
+// header parameters, JSON request bodies, and schemas built from type, format,
+// enum, pattern, bounds, required, properties and items, with local $refs.
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+type Document struct {
+	Servers    []Server            `json:"servers"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	routes     []*route            `json:"-"`
+	patterns   map[string]*regexp.Regexp
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+}
+
+type PathItem map[string]json.RawMessage
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Enum       []interface{}      `json:"enum"`
+	Pattern    string             `json:"pattern"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+}
+
+type route struct {
+	template   string
+	segments   []string
+	literals   int
+	operations map[string]*Operation
+}
+
+// Error describes the first part of a request that does not match the document.
+type Error struct {
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// ErrBodyTooLarge is returned for a JSON body longer than MaxJSONBody.
+var ErrBodyTooLarge = &Error{Message: "Request body too large"}
+
+// MaxJSONBody caps the JSON bodies read to be validated. Bodies of other
+// types, archives and uploads among them, are not read here but left for
+// their handlers to limit.
+const MaxJSONBody = 16 << 20
+
+func invalid(format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// Load parses the embedded document.
+func Load() (*Document, error) {
+	return Parse(Spec)
+}
+
+func Parse(spec []byte) (*Document, error) {
+	doc := &Document{patterns: make(map[string]*regexp.Regexp)}
+	err := json.Unmarshal(spec, doc)
+	if err != nil {
+		return nil, err
+	}
+	for template, item := range doc.Paths {
+		r := &route{template: template, operations: make(map[string]*Operation)}
+		r.segments = strings.Split(strings.Trim(template, "/"), "/")
+		for _, segment := range r.segments {
+			if !isParam(segment) {
+				r.literals++
+			}
+		}
+		for method, raw := range item {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+			op := &Operation{}
+			err = json.Unmarshal(raw, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %s", method, template, err.Error())
+			}
+			for i, param := range op.Parameters {
+				op.Parameters[i], err = doc.parameter(param)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %s", method, template, err.Error())
+				}
+			}
+			r.operations[strings.ToUpper(method)] = op
+		}
+		doc.routes = append(doc.routes, r)
+	}
+	// literal segments win over parameters, as they do in the router
+	sort.Slice(doc.routes, func(i, j int) bool {
+		if doc.routes[i].literals != doc.routes[j].literals {
+			return doc.routes[i].literals > doc.routes[j].literals
+		}
+		return doc.routes[i].template < doc.routes[j].template
+	})
+	return doc, doc.compile()
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func (doc *Document) parameter(param *Parameter) (*Parameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+	name := strings.TrimPrefix(param.Ref, "#/components/parameters/")
+	resolved, ok := doc.Components.Parameters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %s", param.Ref)
+	}
+	return resolved, nil
+}
+
+func (doc *Document) schema(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// compile checks every $ref and prepares the patterns once.
+func (doc *Document) compile() error {
+	seen := make(map[*Schema]bool)
+	var walk func(schema *Schema) error
+	walk = func(schema *Schema) error {
+		if schema == nil {
+			return nil
+		}
+		if schema.Ref != "" {
+			resolved := doc.schema(schema)
+			if resolved == nil {
+				return fmt.Errorf("unknown schema %s", schema.Ref)
+			}
+			schema = resolved
+		}
+		if seen[schema] {
+			return nil
+		}
+		seen[schema] = true
+		if schema.Pattern != "" {
+			re, err := regexp.Compile(schema.Pattern)
+			if err != nil {
+				return err
+			}
+			doc.patterns[schema.Pattern] = re
+		}
+		for _, property := range schema.Properties {
+			err := walk(property)
+			if err != nil {
+				return err
+			}
+		}
+		return walk(schema.Items)
+	}
+	for _, schema := range doc.Components.Schemas {
+		err := walk(schema)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range doc.routes {
+		for _, op := range r.operations {
+			for _, param := range op.Parameters {
+				err := walk(param.Schema)
+				if err != nil {
+					return err
+				}
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					err := walk(media.Schema)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Find returns the operation for the request and the values of its path
+// parameters. A nil operation means the document does not describe the request,
+// which is left for the router to answer.
+func (doc *Document) Find(method, path string) (*Operation, map[string]string) {
+	if len(doc.Servers) != 0 {
+		base := strings.TrimRight(doc.Servers[0].URL, "/")
+		if !strings.HasPrefix(path, base+"/") {
+			return nil, nil
+		}
+		path = strings.TrimPrefix(path, base)
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, r := range doc.routes {
+		values, ok := doc.match(r, segments)
+		if !ok {
+			continue
+		}
+		op, ok := r.operations[method]
+		if !ok {
+			return nil, nil
+		}
+		return op, values
+	}
+	return nil, nil
+}
+
+func (doc *Document) match(r *route, segments []string) (map[string]string, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for i, segment := range r.segments {
+		if !isParam(segment) {
+			if segment != segments[i] {
+				return nil, false
+			}
+			continue
+		}
+		values[strings.Trim(segment, "{}")] = segments[i]
+	}
+	// a path parameter that fails its schema makes the route not match at all
+	for _, op := range r.operations {
+		for _, param := range op.Parameters {
+			if param.In != "path" {
+				continue
+			}
+			value, ok := values[param.Name]
+			if ok && doc.checkString(param.Schema, value, "") != nil {
+				return nil, false
+			}
+		}
+		break
+	}
+	return values, true
+}
+
+// Validate checks the parameters and the JSON body of a request. The body is
+// read and put back so the handler still sees it.
+func (doc *Document) Validate(r *http.Request) error {
+	op, pathValues := doc.Find(r.Method, r.URL.Path)
+	if op == nil {
+		return nil
+	}
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		var (
+			value   string
+			present bool
+		)
+		switch param.In {
+		case "path":
+			value, present = pathValues[param.Name]
+		case "query":
+			values, ok := query[param.Name]
+			present = ok
+			if ok {
+				value = values[0]
+			}
+		case "header":
+			value = r.Header.Get(param.Name)
+			present = value != ""
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				return invalid("%s parameter %s is required", param.In, param.Name)
+			}
+			continue
+		}
+		err := doc.checkString(param.Schema, value, param.In+" parameter "+param.Name)
+		if err != nil {
+			return err
+		}
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+	return doc.validateBody(r, op.RequestBody)
+}
+
+func (doc *Document) validateBody(r *http.Request, body *RequestBody) error {
+	mediaType := ""
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mediaType, _, _ = mime.ParseMediaType(header)
+	}
+	media, ok := body.Content["application/json"]
+	if !ok {
+		if _, declared := body.Content[mediaType]; mediaType != "" && !declared {
+			return invalid("content type %s is not accepted", mediaType)
+		}
+		return nil
+	}
+	// clients have always been allowed to leave the content type out of JSON requests
+	if mediaType != "" && mediaType != "application/json" {
+		return invalid("content type %s is not accepted, expected application/json", mediaType)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxJSONBody+1))
+	if err != nil {
+		return invalid("Cannot read body")
+	}
+	if len(data) > MaxJSONBody {
+		return ErrBodyTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			return invalid("body is required")
+		}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return invalid("Cannot unmarshal json")
+	}
+	return doc.check(media.Schema, value, "body")
+}
+
+// checkString validates a parameter, which arrives as text whatever its type.
+func (doc *Document) checkString(schema *Schema, value string, where string) error {
+	schema = doc.schema(schema)
+	if schema == nil {
+		return nil
+	}
+	switch schema.Type {
+	case "integer", "number":
+		return doc.check(schema, json.Number(value), where)
+	case "boolean":
+		switch value {
+		case "true":
+			return doc.check(schema, true, where)
+		case "false":
+			return doc.check(schema, false, where)
+		}
+		return invalid("%s must be true or false", where)
+	case "array":
+		items := make([]interface{}, 0)
+		if value != "" {
+			for _, item := range strings.Split(value, ",") {
+				items = append(items, item)
+			}
+		}
+		return doc.check(schema, items, where)
+	}
+	return doc.check(schema, value, where)
+}
+
+func (doc *Document) check(schema *Schema, value interface{}, where string) error {
+	schema = doc.schema(schema)
+	if schema == nil {
+		return nil
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return invalid("%s must be an object", where)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return invalid("%s.%s is required", where, name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				continue
+			}
+			err := doc.check(property, object[name], where+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return invalid("%s must be an array", where)
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			return invalid("%s must have at least %d items", where, *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			return invalid("%s must have at most %d items", where, *schema.MaxItems)
+		}
+		for i, item := range items {
+			err := doc.check(schema.Items, item, fmt.Sprintf("%s[%d]", where, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return invalid("%s must be a string", where)
+		}
+		err := doc.checkStringValue(schema, str, where)
+		if err != nil {
+			return err
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return invalid("%s must be a number", where)
+		}
+		err := checkNumber(schema, number, where)
+		if err != nil {
+			return err
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalid("%s must be true or false", where)
+		}
+	}
+	if len(schema.Enum) != 0 && !inEnum(schema.Enum, value) {
+		return invalid("%s must be one of %s", where, enumList(schema.Enum))
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSpec = `{
+  "servers": [{"url": "/api"}],
+  "paths": {
+    "/thread/{id}/details": {
+      "get": {
+        "operationId": "getThread",
+        "parameters": [{"$ref": "#/components/parameters/Id"}]
+      }
+    },
+    "/thread/{slug}/details": {
+      "get": {
+        "operationId": "getThreadBySlug",
+        "parameters": [{"name": "slug", "in": "path", "required": true, "schema": {"type": "string"}}]
+      }
+    },
+    "/thread/new/details": {
+      "get": {"operationId": "getNewThread"}
+    },
+    "/thread/{id}/posts": {
+      "get": {
+        "operationId": "getPosts",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"name": "limit", "in": "query", "required": true, "schema": {"type": "integer", "format": "int32", "minimum": 1, "maximum": 100}},
+          {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["flat", "tree"]}},
+          {"name": "desc", "in": "query", "schema": {"type": "boolean"}},
+          {"name": "fields", "in": "query", "schema": {"type": "array", "items": {"type": "string", "enum": ["user", "forum"]}}},
+          {"name": "since", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "X-Request-Id", "in": "header", "schema": {"type": "string", "maxLength": 8}}
+        ]
+      }
+    },
+    "/thread/{id}/create": {
+      "post": {
+        "operationId": "createPosts",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "array", "maxItems": 2, "items": {"$ref": "#/components/schemas/Post"}}}}}
+      }
+    },
+    "/forum/import": {
+      "post": {
+        "operationId": "importForum",
+        "requestBody": {"required": true, "content": {"application/x-ndjson": {"schema": {"type": "object"}}}}
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "Id": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64", "minimum": 1}}
+    },
+    "schemas": {
+      "Post": {
+        "type": "object",
+        "required": ["author", "message"],
+        "properties": {
+          "author": {"type": "string", "pattern": "^[A-Za-z0-9_.]+$"},
+          "message": {"type": "string", "minLength": 1},
+          "parent": {"type": "integer", "format": "int64"},
+          "rating": {"type": "number", "enum": [1, 2.5]}
+        }
+      }
+    }
+  }
+}`
+
+func testDocument(t *testing.T) *Document {
+	doc, err := Parse([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestLoadEmbeddedDocument(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.routes) == 0 {
+		t.Fatal("no routes in the embedded document")
+	}
+}
+
+func TestParseRejectsUnknownRefs(t *testing.T) {
+	specs := []string{
+		`{"paths": {"/a": {"get": {"parameters": [{"$ref": "#/components/parameters/Missing"}]}}}}`,
+		`{"paths": {"/a": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Missing"}}}}}}}}`,
+		`{"components": {"schemas": {"A": {"type": "string", "pattern": "("}}}}`,
+	}
+	for _, spec := range specs {
+		if _, err := Parse([]byte(spec)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	doc := testDocument(t)
+	tests := []struct {
+		method string
+		path   string
+		want   string
+		values map[string]string
+	}{
+		{http.MethodGet, "/api/thread/42/details", "getThread", map[string]string{"id": "42"}},
+		{http.MethodGet, "/api/thread/0/details", "getThreadBySlug", map[string]string{"slug": "0"}},
+		{http.MethodGet, "/api/thread/pirates/details", "getThreadBySlug", map[string]string{"slug": "pirates"}},
+		{http.MethodGet, "/api/thread/new/details", "getNewThread", map[string]string{}},
+		{http.MethodPost, "/api/thread/42/details", "", nil},
+		{http.MethodGet, "/thread/42/details", "", nil},
+		{http.MethodGet, "/api/thread/42", "", nil},
+	}
+	for _, test := range tests {
+		op, values := doc.Find(test.method, test.path)
+		got := ""
+		if op != nil {
+			got = op.OperationID
+		}
+		if got != test.want {
+			t.Errorf("Find(%s %s) = %q, want %q", test.method, test.path, got, test.want)
+			continue
+		}
+		for name, value := range test.values {
+			if values[name] != value {
+				t.Errorf("Find(%s %s) %s = %q, want %q", test.method, test.path, name, values[name], value)
+			}
+		}
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	doc := testDocument(t)
+	tests := []struct {
+		target string
+		header string
+		want   string
+	}{
+		{"/api/thread/1/posts?limit=10", "", ""},
+		{"/api/thread/1/posts?limit=10&sort=tree&desc=true&fields=user,forum&since=2024-01-02T03:04:05.123Z", "abc", ""},
+		{"/api/thread/1/posts", "", "query parameter limit is required"},
+		{"/api/thread/1/posts?limit=0", "", "query parameter limit must be at least 1"},
+		{"/api/thread/1/posts?limit=101", "", "query parameter limit must be at most 100"},
+		{"/api/thread/1/posts?limit=1.5", "", "query parameter limit must be an integer of 32 bits"},
+		{"/api/thread/1/posts?limit=4294967296", "", "query parameter limit must be an integer of 32 bits"},
+		{"/api/thread/1/posts?limit=ten", "", "query parameter limit must be a number"},
+		{"/api/thread/1/posts?limit=10&sort=parent", "", "query parameter sort must be one of flat, tree"},
+		{"/api/thread/1/posts?limit=10&desc=yes", "", "query parameter desc must be true or false"},
+		{"/api/thread/1/posts?limit=10&fields=user,thread", "", "query parameter fields[1] must be one of user, forum"},
+		{"/api/thread/1/posts?limit=10&since=yesterday", "", "query parameter since must be an RFC 3339 date-time"},
+		{"/api/thread/1/posts?limit=10", "too-long-id", "header parameter X-Request-Id must be at most 8 characters long"},
+		{"/api/unknown?limit=nothing", "", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		if test.header != "" {
+			r.Header.Set("X-Request-Id", test.header)
+		}
+		if got := errorText(doc.Validate(r)); got != test.want {
+			t.Errorf("Validate(%s) = %q, want %q", test.target, got, test.want)
+		}
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	doc := testDocument(t)
+	tests := []struct {
+		body        string
+		contentType string
+		want        string
+	}{
+		{`[{"author": "j.sparrow", "message": "Ahoy", "parent": 3, "rating": 2.5}]`, "application/json", ""},
+		{`[{"author": "j.sparrow", "message": "Ahoy", "unknown": true}]`, "", ""},
+		{``, "application/json", "body is required"},
+		{`[{"author": "j.sparrow"`, "application/json", "Cannot unmarshal json"},
+		{`{"author": "j.sparrow", "message": "Ahoy"}`, "application/json", "body must be an array"},
+		{`[{}, {}, {}]`, "application/json", "body must have at most 2 items"},
+		{`[{"message": "Ahoy"}]`, "application/json", "body[0].author is required"},
+		{`[{"author": "jack sparrow", "message": "Ahoy"}]`, "application/json", "body[0].author does not match ^[A-Za-z0-9_.]+$"},
+		{`[{"author": "j.sparrow", "message": ""}]`, "application/json", "body[0].message must be at least 1 characters long"},
+		{`[{"author": "j.sparrow", "message": "Ahoy", "parent": "3"}]`, "application/json", "body[0].parent must be a number"},
+		{`[{"author": "j.sparrow", "message": "Ahoy", "rating": 2}]`, "application/json", "body[0].rating must be one of 1, 2.5"},
+		{`[{"author": 7, "message": "Ahoy"}]`, "application/json", "body[0].author must be a string"},
+		{`[]`, "text/plain", "content type text/plain is not accepted, expected application/json"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/thread/1/create", strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if got := errorText(doc.Validate(r)); got != test.want {
+			t.Errorf("Validate(%s) = %q, want %q", test.body, got, test.want)
+		}
+	}
+}
+
+func TestValidatePutsBodyBack(t *testing.T) {
+	doc := testDocument(t)
+	body := `[{"author": "j.sparrow", "message": "Ahoy"}]`
+	r := httptest.NewRequest(http.MethodPost, "/api/thread/1/create", strings.NewReader(body))
+	if err := doc.Validate(r); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != body {
+		t.Errorf("body after Validate = %q, want %q", read, body)
+	}
+}
+
+func TestValidateBodyTooLarge(t *testing.T) {
+	doc := testDocument(t)
+	body := "[" + strings.Repeat(" ", MaxJSONBody) + "]"
+	r := httptest.NewRequest(http.MethodPost, "/api/thread/1/create", strings.NewReader(body))
+	if err := doc.Validate(r); err != ErrBodyTooLarge {
+		t.Errorf("Validate of a %d byte body = %v, want %v", len(body), err, ErrBodyTooLarge)
+	}
+}
+
+func TestValidateOtherContentTypes(t *testing.T) {
+	doc := testDocument(t)
+	tests := map[string]string{
+		"application/x-ndjson":                "",
+		"application/x-ndjson; charset=utf-8": "",
+		"":                                    "",
+		"application/json":                    "content type application/json is not accepted",
+	}
+	for contentType, want := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/forum/import", strings.NewReader("{}\n{}\n"))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		if got := errorText(doc.Validate(r)); got != want {
+			t.Errorf("Validate with %q = %q, want %q", contentType, got, want)
+		}
+	}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
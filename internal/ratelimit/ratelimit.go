@@ -0,0 +1,54 @@
+// Package ratelimit implements token-bucket request limiting with pluggable
+// bucket storage.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit refills a bucket with Rate tokens per second up to Burst tokens.
+// A zero Rate disables limiting.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store keeps buckets. Take removes one token from the bucket of key and
+// reports whether it was there; if not, it also returns the time until it is.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// Limiter applies per-class limits to keys.
+type Limiter struct {
+	store  Store
+	mu     sync.RWMutex
+	limits map[string]Limit
+}
+
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// SetLimits replaces the limits of every class. Buckets already filled keep
+// their tokens and refill at the new rate.
+func (l *Limiter) SetLimits(limits map[string]Limit) {
+	l.mu.Lock()
+	l.limits = limits
+	l.mu.Unlock()
+}
+
+// Allow takes a token of class for key. Classes without a limit are always allowed.
+func (l *Limiter) Allow(class string, key string) (bool, time.Duration, error) {
+	l.mu.RLock()
+	limit, ok := l.limits[class]
+	l.mu.RUnlock()
+	if !ok || limit.Rate <= 0 {
+		return true, 0, nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return l.store.Take(class+":"+key, limit, time.Now())
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/archive"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"net/http"
+	"time"
+)
+
+const exportFlushEvery = 500
+
+// ExportForum streams the forum as an NDJSON archive. Once the first record
+// is sent the status can no longer change, so a failure midway ends the
+// archive with an error record instead of the end record.
+func (serv *Server) ExportForum(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanManageForum, forumId) {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	var writer *archive.Writer
+	stat := serv.store(r).ExportForum(forumId, func(kind string, data interface{}) error {
+		if writer == nil {
+			forum := data.(archive.Forum)
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+forum.Slug+`.ndjson"`)
+			w.WriteHeader(http.StatusOK)
+			writer = archive.NewWriter(w)
+			header := archive.Header{
+				Version:  archive.Version,
+				Forum:    forum.Slug,
+				Exported: time.Now().Format("2006-01-02T15:04:05.999999999Z07:00"),
+			}
+			err := writer.Write(archive.TypeHeader, header)
+			if err != nil {
+				return err
+			}
+		}
+		err := writer.Write(kind, data)
+		if err != nil {
+			return err
+		}
+		if writer.Records()%exportFlushEvery == 0 {
+			err = writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return err
+	})
+	if writer == nil {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	if stat != database.OK {
+		requestLogger(r).Warn("export aborted", "forum", forumId)
+		writer.Write(archive.TypeError, archive.Error{Message: "Export aborted"})
+		writer.Flush()
+		return
+	}
+	writer.Close()
+}
+
+// ImportForum recreates a forum from the NDJSON archive in the body.
+// ?policy= fail, skip or rename decides what happens on slug and nickname
+// collisions; fail is the default. Skipping a forum that already exists
+// creates nothing and answers 200 with the report.
+func (serv *Server) ImportForum(w http.ResponseWriter, r *http.Request) {
+	policy := r.URL.Query().Get("policy")
+	if policy == "" {
+		policy = archive.PolicyFail
+	}
+	report, stat := serv.store(r).ImportForum(archive.NewReader(r.Body), policy)
+	if stat == database.Invalid {
+		WriteToResponse(w, http.StatusBadRequest, report)
+		return
+	}
+	if stat == database.OK && report.SkippedForum {
+		WriteToResponse(w, http.StatusOK, report)
+		return
+	}
+	DealCreateStatus(w, &report, stat)
+}
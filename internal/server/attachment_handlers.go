@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/blobstore"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	attachmentField    = "file"
+	orphanCleanupBatch = 100
+)
+
+var errTooLarge = errors.New("attachment too large")
+
+// UploadAttachment stores the "file" part of a multipart body. The MIME type
+// is sniffed from the content, the client's claim is ignored.
+func (serv *Server) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	actor := ActingUser(r)
+	if actor == "" {
+		WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	maxSize := serv.conf().Attachments.MaxSize
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+64<<10)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		errText := models.Error{Message: "Expected multipart/form-data body"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			errText := models.Error{Message: "No " + attachmentField + " part in body"}
+			WriteToResponse(w, http.StatusBadRequest, errText)
+			return
+		}
+		if part.FormName() == attachmentField {
+			serv.storeAttachment(w, r, part, actor, maxSize)
+			part.Close()
+			return
+		}
+		part.Close()
+	}
+}
+
+func (serv *Server) storeAttachment(w http.ResponseWriter, r *http.Request, part *multipart.Part, owner string, maxSize int64) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(part, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		writeUploadError(w, r, err, maxSize)
+		return
+	}
+	if n == 0 {
+		errText := models.Error{Message: "Empty file"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return
+	}
+	header = header[:n]
+	contentType := http.DetectContentType(header)
+	if !serv.isAllowedType(contentType) {
+		errText := models.Error{Message: "File type " + contentType + " is not allowed"}
+		WriteToResponse(w, http.StatusUnsupportedMediaType, errText)
+		return
+	}
+	key, err := newBlobKey()
+	if err != nil {
+		DealCreateStatus(w, nil, database.DBError)
+		return
+	}
+	body := &limitedReader{reader: io.MultiReader(bytes.NewReader(header), part), left: maxSize}
+	size, err := serv.blobs.Put(key, body)
+	if err != nil {
+		serv.blobs.Delete(key)
+		writeUploadError(w, r, err, maxSize)
+		return
+	}
+	attachment := models.Attachment{
+		ContentType: contentType,
+		Name:        attachmentName(part),
+		Owner:       owner,
+		Size:        size,
+	}
+	attachment, stat := serv.store(r).CreateAttachment(key, attachment)
+	if stat != database.OK {
+		serv.blobs.Delete(key)
+	}
+	DealCreateStatus(w, &attachment, stat)
+}
+
+// GetAttachment streams the file. Attachments of published posts are public;
+// others are visible to their owner, and held ones also to the forum moderators.
+func (serv *Server) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentId := chi.URLParam(r, "id")
+	attachment, key, pendingForum, stat := serv.store(r).GetAttachment(attachmentId)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	if attachment.Post == 0 {
+		actor := ActingUser(r)
+		if actor == "" {
+			WriteUnauthorized(w, "Authentication required")
+			return
+		}
+		if !strings.EqualFold(actor, attachment.Owner) && !serv.accessOf(r).ActsAsAdmin(actor) {
+			stat = database.Forbidden
+			if pendingForum != "" {
+				stat = serv.accessOf(r).CanModerate(actor, pendingForum)
+			}
+			if stat != database.OK {
+				DealGetStatus(w, nil, stat)
+				return
+			}
+		}
+	}
+	blob, err := serv.blobs.Open(key)
+	if err == blobstore.ErrNotFound {
+		DealGetStatus(w, nil, database.EmptyResult)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("failed to open blob", "key", key, "error", err.Error())
+		DealGetStatus(w, nil, database.DBError)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, blob)
+	if err != nil {
+		requestLogger(r).Warn("attachment download interrupted", "key", key, "error", err.Error())
+	}
+}
+
+// DeleteAttachment lets the owner drop an upload no post uses yet.
+func (serv *Server) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	actor := ActingUser(r)
+	if actor == "" {
+		WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	key, stat := serv.store(r).DeleteAttachment(chi.URLParam(r, "id"), actor)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	err := serv.blobs.Delete(key)
+	if err != nil {
+		requestLogger(r).Error("failed to delete blob", "key", key, "error", err.Error())
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error, maxSize int64) {
+	maxBytesErr := &http.MaxBytesError{}
+	if err == errTooLarge || errors.As(err, &maxBytesErr) {
+		errText := models.Error{Message: "File is larger than " + strconv.FormatInt(maxSize, 10) + " bytes"}
+		WriteToResponse(w, http.StatusRequestEntityTooLarge, errText)
+		return
+	}
+	requestLogger(r).Error("failed to store upload", "error", err.Error())
+	errText := models.Error{Message: "Cannot store file"}
+	WriteToResponse(w, http.StatusInternalServerError, errText)
+}
+
+// CleanupAttachments removes orphaned uploads every cleanup_seconds until
+// stop is closed.
+func (serv *Server) CleanupAttachments(stop <-chan struct{}) {
+	cleanupSeconds := serv.conf().Attachments.CleanupSeconds
+	if cleanupSeconds <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cleanupSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		orphanSeconds := serv.conf().Attachments.OrphanSeconds
+		unusedBefore := time.Now().Add(-time.Duration(orphanSeconds) * time.Second)
+		removed := 0
+		for {
+			ids, stat := serv.db.GetOrphanAttachments(unusedBefore, orphanCleanupBatch)
+			if stat != database.OK || len(ids) == 0 {
+				break
+			}
+			for _, id := range ids {
+				key, stat := serv.db.DeleteOrphanAttachment(id, unusedBefore)
+				if stat != database.OK {
+					continue
+				}
+				err := serv.blobs.Delete(key)
+				if err != nil {
+					serv.log.Error("failed to delete blob", "key", key, "error", err.Error())
+				}
+				removed++
+			}
+			if len(ids) < orphanCleanupBatch {
+				break
+			}
+		}
+		if removed > 0 {
+			serv.log.Info("removed orphaned attachments", "count", removed)
+		}
+	}
+}
+
+func (serv *Server) isAllowedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range serv.conf().Attachments.Types {
+		if strings.EqualFold(allowed, mediaType) {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") &&
+			strings.HasPrefix(mediaType, strings.ToLower(strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func attachmentName(part *multipart.Part) string {
+	name := filepath.Base(part.FileName())
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = "attachment"
+	}
+	return name
+}
+
+func newBlobKey() (string, error) {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+type limitedReader struct {
+	reader io.Reader
+	left   int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		// one more byte tells an oversized file from one of exactly the limit
+		n, _ := io.ReadFull(l.reader, make([]byte, 1))
+		if n > 0 {
+			return 0, errTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.reader.Read(p)
+	l.left -= int64(n)
+	return n, err
+}
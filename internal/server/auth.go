@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"github.com/sergeychur/technopark_db/internal/auth"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	actingUserKey contextKey = iota
+	tokenHashKey
+	clientCertKey
+)
+
+// Authenticate resolves the bearer token of the request, if there is one, to the
+// acting user. Requests without a token pass through anonymously.
+func (serv *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, ref := serv.authenticate(r)
+		if !passes(w, ref) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate returns the context of the request with the acting user of its
+// bearer token and the name of its verified client certificate, if it has
+// them. The REST and gRPC APIs share it.
+func (serv *Server) authenticate(r *http.Request) (context.Context, *refusal) {
+	ctx := r.Context()
+	if name, ok := clientCertName(r); ok {
+		ctx = context.WithValue(ctx, clientCertKey, name)
+	}
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return ctx, nil
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || token == "" {
+		return nil, &refusal{status: http.StatusUnauthorized, message: "Malformed authorization header"}
+	}
+	tokenHash := auth.HashToken(token)
+	nick, stat := serv.store(r).GetTokenUser(tokenHash)
+	if stat == database.DBError {
+		return nil, statusRefusal(stat)
+	}
+	if stat != database.OK {
+		return nil, &refusal{status: http.StatusUnauthorized, message: "Invalid or expired token"}
+	}
+	ctx = context.WithValue(ctx, actingUserKey, nick)
+	ctx = context.WithValue(ctx, tokenHashKey, tokenHash)
+	return ctx, nil
+}
+
+// ActingUser returns the nickname of the authenticated user, empty for anonymous requests.
+func ActingUser(r *http.Request) string {
+	return actorOf(r.Context())
+}
+
+func actorOf(ctx context.Context) string {
+	nick, _ := ctx.Value(actingUserKey).(string)
+	return nick
+}
+
+func WriteUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	errText := models.Error{Message: message}
+	WriteToResponse(w, http.StatusUnauthorized, errText)
+}
+
+// CheckActingUser rejects the request unless it acts on behalf of nickname.
+// Anonymous requests are let through only while auth_required is off.
+func (serv *Server) CheckActingUser(w http.ResponseWriter, r *http.Request, nickname string) bool {
+	return passes(w, serv.checkActingUser(ActingUser(r), nickname))
+}
+
+func (serv *Server) checkActingUser(actor string, nickname string) *refusal {
+	if actor == "" && !serv.conf().AuthRequired {
+		return nil
+	}
+	return requireActingUser(actor, nickname)
+}
+
+// RequireActingUser is CheckActingUser for endpoints that never accept anonymous callers.
+func RequireActingUser(w http.ResponseWriter, r *http.Request, nickname string) bool {
+	return passes(w, requireActingUser(ActingUser(r), nickname))
+}
+
+func requireActingUser(actor string, nickname string) *refusal {
+	if actor == "" {
+		return &refusal{status: http.StatusUnauthorized, message: "Authentication required"}
+	}
+	if !strings.EqualFold(actor, nickname) {
+		return &refusal{status: http.StatusForbidden, message: "Can't act on behalf of user " + nickname}
+	}
+	return nil
+}
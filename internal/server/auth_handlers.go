@@ -0,0 +1,110 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/auth"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"time"
+)
+
+const sessionLifetime = 24 * time.Hour
+
+// Login checks the password of a user, or of the admin account for a listed
+// admin nickname, and issues a session token.
+func (serv *Server) Login(w http.ResponseWriter, r *http.Request) {
+	credentials := models.Credentials{}
+	err := ReadFromBody(r, w, &credentials)
+	if err != nil {
+		return
+	}
+	getCredentials := serv.store(r).GetCredentials
+	if serv.conf().HasAdmin(credentials.Nickname) {
+		getCredentials = serv.store(r).GetAdminCredentials
+	}
+	nick, passwordHash, stat := getCredentials(credentials.Nickname)
+	if stat == database.DBError {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	if stat != database.OK || !auth.CheckPassword(passwordHash, credentials.Password) {
+		WriteUnauthorized(w, "Invalid nickname or password")
+		return
+	}
+	serv.issueToken(w, r, nick, auth.SessionToken, "", time.Now().Add(sessionLifetime))
+}
+
+func (serv *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	tokenHash, ok := r.Context().Value(tokenHashKey).(string)
+	if !ok {
+		WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	stat := serv.store(r).DeleteTokenByHash(tokenHash)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (serv *Server) CreateUserToken(w http.ResponseWriter, r *http.Request) {
+	userNick := chi.URLParam(r, "nickname")
+	if !RequireActingUser(w, r, userNick) {
+		return
+	}
+	request := models.Token{}
+	err := ReadFromBody(r, w, &request)
+	if err != nil {
+		return
+	}
+	expires := time.Time{}
+	if request.Expires != "" {
+		expires, err = time.Parse("2006-01-02T15:04:05.999999999Z07:00", request.Expires)
+		if err != nil || expires.Before(time.Now()) {
+			errText := models.Error{Message: "expires incorrect"}
+			WriteToResponse(w, http.StatusBadRequest, errText)
+			return
+		}
+	}
+	serv.issueToken(w, r, ActingUser(r), auth.PersonalToken, request.Name, expires)
+}
+
+func (serv *Server) GetUserTokens(w http.ResponseWriter, r *http.Request) {
+	userNick := chi.URLParam(r, "nickname")
+	if !RequireActingUser(w, r, userNick) {
+		return
+	}
+	tokens, stat := serv.store(r).GetUserTokens(ActingUser(r))
+	DealGetStatus(w, &tokens, stat)
+}
+
+func (serv *Server) DeleteUserToken(w http.ResponseWriter, r *http.Request) {
+	userNick := chi.URLParam(r, "nickname")
+	tokenId := chi.URLParam(r, "id")
+	if !RequireActingUser(w, r, userNick) {
+		return
+	}
+	stat := serv.store(r).DeleteToken(ActingUser(r), tokenId)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (serv *Server) issueToken(w http.ResponseWriter, r *http.Request, nick string, kind string,
+	name string, expires time.Time) {
+	token, err := auth.NewToken()
+	if err != nil {
+		errText := models.Error{Message: "Cannot generate token"}
+		WriteToResponse(w, http.StatusInternalServerError, errText)
+		return
+	}
+	stored, stat := serv.store(r).CreateToken(nick, kind, name, auth.HashToken(token), expires)
+	if stat == database.OK {
+		stored.Token = token
+	}
+	DealCreateStatus(w, &stored, stat)
+}
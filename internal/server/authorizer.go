@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	RoleUser = iota
+	RoleModerator
+	RoleOwner
+	RoleAdmin
+)
+
+// Authorizer decides whether a user may modify a resource. Every check returns
+// a database status: OK when allowed, Forbidden when denied, EmptyResult when
+// the resource does not exist.
+type Authorizer struct {
+	db     *database.DB
+	mu     sync.RWMutex
+	config *config.Config
+}
+
+func NewAuthorizer(db *database.DB, conf *config.Config) *Authorizer {
+	return &Authorizer{db: db, config: conf}
+}
+
+// SetConfig swaps the config the admins are read from, on reload.
+func (a *Authorizer) SetConfig(conf *config.Config) {
+	a.mu.Lock()
+	a.config = conf
+	a.mu.Unlock()
+}
+
+// IsAdmin tells whether nick is a listed admin whose account has been set up,
+// so that nobody gets admin rights by registering a listed nickname first.
+func (a *Authorizer) IsAdmin(nick string) bool {
+	a.mu.RLock()
+	listed := a.config.HasAdmin(nick)
+	a.mu.RUnlock()
+	if !listed {
+		return false
+	}
+	seeded, stat := a.db.HasAdminCredentials(nick)
+	return stat == database.OK && seeded
+}
+
+// For returns the checks as the request of ctx sees them.
+func (a *Authorizer) For(ctx context.Context) Access {
+	certName, _ := ctx.Value(clientCertKey).(string)
+	return Access{Authorizer: a, certName: certName}
+}
+
+// Access runs the checks for one request. Other users are admins as IsAdmin
+// tells, but the acting user uses admin rights only if the request may: with
+// tls.admin_client_cert it has to come with a verified client certificate
+// naming them.
+type Access struct {
+	*Authorizer
+	certName string
+}
+
+// ActsAsAdmin tells whether actor may use admin rights in the request.
+func (a Access) ActsAsAdmin(actor string) bool {
+	a.mu.RLock()
+	certRequired, listed := a.config.TLS.AdminClientCert, a.config.HasAdmin(actor)
+	a.mu.RUnlock()
+	if certRequired {
+		return listed && strings.EqualFold(a.certName, actor)
+	}
+	return a.IsAdmin(actor)
+}
+
+// ForumRole returns the highest role the acting user holds in the forum.
+func (a Access) ForumRole(actor string, forumId string) (int, int) {
+	return a.forumRole(actor, forumId, a.ActsAsAdmin(actor))
+}
+
+func (a Access) forumRole(nick string, forumId string, admin bool) (int, int) {
+	if admin {
+		return RoleAdmin, database.OK
+	}
+	owner, isModerator, stat := a.db.GetForumRole(forumId, nick)
+	if stat != database.OK {
+		return RoleUser, stat
+	}
+	if strings.EqualFold(nick, owner) {
+		return RoleOwner, database.OK
+	}
+	if isModerator {
+		return RoleModerator, database.OK
+	}
+	return RoleUser, database.OK
+}
+
+func (a Access) CanEditPost(actor string, postId string) int {
+	author, forumId, stat := a.db.GetPostAuthor(postId)
+	if stat != database.OK {
+		return stat
+	}
+	return a.authorOrRole(actor, author, forumId, RoleModerator)
+}
+
+func (a Access) CanEditThreadById(actor string, id string) int {
+	author, forumId, stat := a.db.GetThreadAuthorById(id)
+	if stat != database.OK {
+		return stat
+	}
+	return a.authorOrRole(actor, author, forumId, RoleModerator)
+}
+
+func (a Access) CanEditThreadBySlug(actor string, slug string) int {
+	author, forumId, stat := a.db.GetThreadAuthorBySlug(slug)
+	if stat != database.OK {
+		return stat
+	}
+	return a.authorOrRole(actor, author, forumId, RoleModerator)
+}
+
+func (a Access) CanEditUser(actor string, nick string) int {
+	if strings.EqualFold(actor, nick) || a.ActsAsAdmin(actor) {
+		return database.OK
+	}
+	return database.Forbidden
+}
+
+// CanModerate allows forum moderators, the forum owner and admins.
+func (a Access) CanModerate(actor string, forumId string) int {
+	return a.hasRole(actor, forumId, RoleModerator)
+}
+
+// CanManageForum allows the forum owner and admins.
+func (a Access) CanManageForum(actor string, forumId string) int {
+	return a.hasRole(actor, forumId, RoleOwner)
+}
+
+// CanBan allows banning only users ranked below the actor in the forum.
+func (a Access) CanBan(actor string, forumId string, target string) int {
+	actorRole, stat := a.ForumRole(actor, forumId)
+	if stat != database.OK {
+		return stat
+	}
+	targetRole, stat := a.forumRole(target, forumId, a.IsAdmin(target))
+	if stat != database.OK {
+		return stat
+	}
+	if actorRole < RoleModerator || targetRole >= actorRole {
+		return database.Forbidden
+	}
+	return database.OK
+}
+
+// CanBanItemAuthor is CanBan for the author of a reported post or thread.
+func (a Access) CanBanItemAuthor(actor string, forumId string, kind string, itemId string) int {
+	author, stat := "", database.OK
+	if kind == database.ItemPost {
+		author, _, stat = a.db.GetPostAuthor(itemId)
+	} else {
+		author, _, stat = a.db.GetThreadAuthorById(itemId)
+	}
+	if stat != database.OK {
+		return stat
+	}
+	return a.CanBan(actor, forumId, author)
+}
+
+func (a Access) authorOrRole(actor string, author string, forumId string, role int) int {
+	if strings.EqualFold(actor, author) {
+		return database.OK
+	}
+	return a.hasRole(actor, forumId, role)
+}
+
+func (a Access) hasRole(actor string, forumId string, role int) int {
+	actual, stat := a.ForumRole(actor, forumId)
+	if stat != database.OK {
+		return stat
+	}
+	if actual < role {
+		return database.Forbidden
+	}
+	return database.OK
+}
+
+func (serv *Server) accessOf(r *http.Request) Access {
+	return serv.access.For(r.Context())
+}
+
+// Authorize runs check for the acting user of the request and writes the denial
+// if there is one. Anonymous requests pass only while auth_required is off.
+func (serv *Server) Authorize(w http.ResponseWriter, r *http.Request,
+	check func(actor string, resource string) int, resource string) bool {
+	return passes(w, serv.authorize(ActingUser(r), check, resource))
+}
+
+func (serv *Server) authorize(actor string, check func(actor string, resource string) int, resource string) *refusal {
+	if actor == "" && !serv.conf().AuthRequired {
+		return nil
+	}
+	return requireActor(actor, check, resource)
+}
+
+// RequireActor is the strict variant of Authorize for moderation endpoints:
+// anonymous requests are always rejected.
+func (serv *Server) RequireActor(w http.ResponseWriter, r *http.Request,
+	check func(actor string, resource string) int, resource string) bool {
+	return passes(w, requireActor(ActingUser(r), check, resource))
+}
+
+func requireActor(actor string, check func(actor string, resource string) int, resource string) *refusal {
+	if actor == "" {
+		return &refusal{status: http.StatusUnauthorized, message: "Authentication required"}
+	}
+	return statusRefusal(check(actor, resource))
+}
+
+// RequireAdmin guards administrative routes. With tls.admin_client_cert the
+// admin is named by a verified client certificate instead of a token.
+func (serv *Server) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, ref := serv.requireAdmin(r.Context())
+		if !passes(w, ref) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actingUserKey, actor)))
+	})
+}
+
+// requireAdmin names the admin acting in ctx, as authenticate left it.
+func (serv *Server) requireAdmin(ctx context.Context) (string, *refusal) {
+	if serv.conf().TLS.AdminClientCert {
+		actor, _ := ctx.Value(clientCertKey).(string)
+		if actor == "" {
+			return "", &refusal{status: http.StatusUnauthorized, message: "Client certificate required"}
+		}
+		if !serv.conf().HasAdmin(actor) {
+			return "", &refusal{status: http.StatusForbidden, message: "Administrator role required"}
+		}
+		return actor, nil
+	}
+	actor := actorOf(ctx)
+	if actor == "" {
+		return "", &refusal{status: http.StatusUnauthorized, message: "Authentication required"}
+	}
+	if !serv.access.IsAdmin(actor) {
+		return "", &refusal{status: http.StatusForbidden, message: "Administrator role required"}
+	}
+	return actor, nil
+}
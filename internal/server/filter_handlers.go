@@ -0,0 +1,219 @@
+package server
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/filter"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errFilterFacts = errors.New("cannot load filter facts")
+
+func (serv *Server) GetFilterRules(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	rules, stat := serv.store(r).GetFilterRules(forumId)
+	DealGetStatus(w, &rules, stat)
+}
+
+func (serv *Server) CreateFilterRule(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	rule := models.FilterRule{}
+	err := ReadFromBody(r, w, &rule)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	err = filter.Validate(&rule)
+	if err != nil {
+		errText := models.Error{Message: err.Error()}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return
+	}
+	rule.CreatedBy = ActingUser(r)
+	rule, stat := serv.store(r).CreateFilterRule(forumId, rule)
+	if stat == database.OK {
+		serv.filters.Invalidate(rule.Forum)
+	}
+	DealCreateStatus(w, &rule, stat)
+}
+
+func (serv *Server) DeleteFilterRule(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	ruleId, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		errText := models.Error{Message: "Invalid id"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	stat := serv.store(r).DeleteFilterRule(forumId, ruleId)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	serv.filters.Invalidate(forumId)
+	w.WriteHeader(http.StatusOK)
+}
+
+// forumFilter returns the compiled site-wide and forum rules, reading the
+// forum rules with load when they are not cached. Unknown forums get only the
+// site-wide rules; the create call reports them as missing.
+func (serv *Server) forumFilter(forumId string,
+	load func(forumId string) (models.FilterRules, int)) (*filter.RuleSet, int) {
+	set, ok := serv.filters.Get(forumId)
+	if ok {
+		return set, database.OK
+	}
+	rules := models.FilterRules{}
+	for _, word := range serv.conf().Filter.Words {
+		rules = append(rules, &models.FilterRule{Kind: filter.KindWord, Action: filter.ActionReject, Pattern: word})
+	}
+	forumRules, stat := load(forumId)
+	if stat == database.DBError {
+		return nil, stat
+	}
+	set = filter.Compile(append(rules, forumRules...))
+	if stat == database.OK {
+		serv.filters.Put(forumId, set)
+	}
+	return set, database.OK
+}
+
+// postsFilter checks batches of new posts inside their create transaction,
+// masking messages in place and marking held ones. A refused post stops the
+// batch with Invalid and leaves the rule that refused it in rejected.
+func (serv *Server) postsFilter(rejected **models.FilterRule) database.PostsFilter {
+	return func(tx *database.Tx, forumId string, posts models.Posts) int {
+		set, stat := serv.forumFilter(forumId, func(forumId string) (models.FilterRules, int) {
+			return database.GetFilterRules(tx, forumId)
+		})
+		if stat != database.OK {
+			return stat
+		}
+		if set.Len() == 0 {
+			return database.OK
+		}
+		if set.Has(filter.KindDuplicate) {
+			authors := make([]string, 0, len(posts))
+			for _, post := range posts {
+				authors = append(authors, post.Author)
+			}
+			stat = database.LockAuthors(tx, authors)
+			if stat != database.OK {
+				return stat
+			}
+		}
+		facts := &filterFacts{store: txFacts{tx: tx}, seen: make(map[string]bool)}
+		for _, post := range posts {
+			verdict, err := set.Check(post.Author, post.Message, facts)
+			if err != nil {
+				return database.DBError
+			}
+			if verdict.Action == filter.ActionReject {
+				*rejected = verdict.Rule
+				return database.Invalid
+			}
+			facts.seen[strings.ToLower(post.Author)+"\x00"+post.Message] = true
+			post.Message = verdict.Message
+			post.Hold = verdict.Action == filter.ActionHold
+		}
+		return database.OK
+	}
+}
+
+// FilterThread checks the opening message of a new thread. Threads have no
+// moderation queue, so hold rules refuse them too; duplicate rules only apply
+// to posts.
+func (serv *Server) FilterThread(w http.ResponseWriter, r *http.Request, forumId string, thread *models.Thread) bool {
+	return passes(w, serv.filterThread(serv.store(r), forumId, thread))
+}
+
+func (serv *Server) filterThread(store *database.DB, forumId string, thread *models.Thread) *refusal {
+	set, stat := serv.forumFilter(forumId, store.GetFilterRules)
+	if stat != database.OK {
+		return statusRefusal(stat)
+	}
+	if set.Len() == 0 {
+		return nil
+	}
+	verdict, err := set.Check(thread.Author, thread.Message, &filterFacts{store: store, threads: true})
+	if err != nil {
+		return statusRefusal(database.DBError)
+	}
+	if verdict.Action != "" {
+		return rejectedBy(verdict.Rule)
+	}
+	thread.Message = verdict.Message
+	return nil
+}
+
+func WriteRejected(w http.ResponseWriter, rule *models.FilterRule) {
+	rejectedBy(rule).write(w)
+}
+
+func rejectedBy(rule *models.FilterRule) *refusal {
+	return &refusal{status: http.StatusUnprocessableEntity, message: "Message refused by " + filter.Describe(rule), rule: rule}
+}
+
+// factsStore is the storage filterFacts reads: the database, or the create
+// transaction of a batch of posts.
+type factsStore interface {
+	GetUserCreated(userNick string) (time.Time, int)
+	HasRecentDuplicate(userNick string, message string, since time.Time) (bool, int)
+}
+
+type txFacts struct {
+	tx *database.Tx
+}
+
+func (f txFacts) GetUserCreated(userNick string) (time.Time, int) {
+	return database.GetUserCreated(f.tx, userNick)
+}
+
+func (f txFacts) HasRecentDuplicate(userNick string, message string, since time.Time) (bool, int) {
+	return database.HasRecentDuplicate(f.tx, userNick, message, since)
+}
+
+type filterFacts struct {
+	store   factsStore
+	seen    map[string]bool
+	threads bool
+}
+
+func (f *filterFacts) AccountAge(author string) (time.Duration, error) {
+	created, stat := f.store.GetUserCreated(author)
+	if stat == database.EmptyResult {
+		// the create call reports the missing author
+		return time.Duration(1<<63 - 1), nil
+	}
+	if stat != database.OK {
+		return 0, errFilterFacts
+	}
+	return time.Since(created), nil
+}
+
+func (f *filterFacts) RecentDuplicate(author string, message string, window time.Duration) (bool, error) {
+	if f.threads {
+		return false, nil
+	}
+	if f.seen[strings.ToLower(author)+"\x00"+message] {
+		return true, nil
+	}
+	ifDuplicate, stat := f.store.HasRecentDuplicate(author, message, time.Now().Add(-window))
+	if stat != database.OK {
+		return false, errFilterFacts
+	}
+	return ifDuplicate, nil
+}
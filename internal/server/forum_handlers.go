@@ -15,7 +15,10 @@ func (serv *Server) CreateForum(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	forum, stat := serv.db.CreateForum(forum)
+	if !serv.CheckActingUser(w, r, forum.User) {
+		return
+	}
+	forum, stat := serv.store(r).CreateForum(forum)
 	DealCreateStatus(w, &forum, stat)
 }
 
@@ -26,14 +29,20 @@ func (serv *Server) CreateThread(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	thread, stat := serv.db.CreateThread(thread, forumId)
+	if !serv.CheckActingUser(w, r, thread.Author) {
+		return
+	}
+	if !serv.FilterThread(w, r, forumId, &thread) {
+		return
+	}
+	thread, stat := serv.store(r).CreateThread(thread, forumId)
 	DealCreateStatus(w, &thread, stat)
 }
 
 func (serv *Server) GetForumInfo(w http.ResponseWriter, r *http.Request) {
 	forumId := chi.URLParam(r, "slug")
 	forum := models.Forum{}
-	forum, stat := serv.db.GetForum(forumId)
+	forum, stat := serv.store(r).GetForum(forumId)
 	DealGetStatus(w, &forum, stat)
 }
 
@@ -58,7 +67,8 @@ func (serv *Server) GetForumThreads(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	threads := models.Threads{}
-	threads, stat := serv.db.GetForumThreads(forumId, limit, since, desc)
+	threads, stat := serv.store(r).GetForumThreads(forumId, limit, since, desc)
+	StripThreadsHTML(r, threads...)
 	DealGetStatus(w, &threads, stat)
 }
 
@@ -82,6 +92,6 @@ func (serv *Server) GetUsersByForum(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	users, stat := serv.db.GetForumUsers(forumId, limit, since, desc)
+	users, stat := serv.store(r).GetForumUsers(forumId, limit, since, desc)
 	DealGetStatus(w, &users, stat)
 }
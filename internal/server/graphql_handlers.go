@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sergeychur/technopark_db/internal/graphql"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+)
+
+// GraphQL answers a query given as the query, operationName and variables
+// parameters of a GET or as a JSON body of a POST. A query that does not
+// parse or validate gets 400; once it runs the answer is 200, with any
+// field errors next to the data.
+func (serv *Server) GraphQL(w http.ResponseWriter, r *http.Request) {
+	request := graphql.Request{}
+	if r.Method == http.MethodGet {
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &request.Variables)
+			if err != nil {
+				errText := models.Error{Message: "variables must be a JSON object"}
+				WriteToResponse(w, http.StatusBadRequest, errText)
+				return
+			}
+		}
+	} else {
+		err := ReadFromBody(r, w, &request)
+		if err != nil {
+			return
+		}
+	}
+	conf := serv.conf().GraphQL
+	limits := graphql.Limits{MaxDepth: conf.MaxDepth, MaxComplexity: conf.MaxComplexity}
+	ctx := context.WithValue(r.Context(), graphqlLoaderKey{}, newGraphQLLoader(serv.store(r)))
+	response := serv.graph.Execute(ctx, request, limits)
+	if response.Data == nil {
+		WriteToResponse(w, http.StatusBadRequest, response)
+		return
+	}
+	WriteToResponse(w, http.StatusOK, response)
+}
+
+// GetGraphQLSchema serves the schema in the GraphQL schema language.
+func (serv *Server) GetGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte(serv.graph.String()))
+	if err != nil {
+		requestLogger(r).Warn("unable to write the GraphQL schema", "error", err.Error())
+	}
+}
@@ -0,0 +1,502 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/graphql"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"strconv"
+)
+
+var errGraphQLDB = errors.New("Error in DB")
+
+// graphqlLoader loads the objects a query links to, all the keys of a level
+// in one statement, and keeps them for the rest of the request so an object
+// reached twice is read once.
+type graphqlLoader struct {
+	db      *database.DB
+	users   map[string]*models.User
+	forums  map[string]*models.Forum
+	threads map[int32]*models.Thread
+	posts   map[int64]*models.Post
+}
+
+type graphqlLoaderKey struct{}
+
+func newGraphQLLoader(db *database.DB) *graphqlLoader {
+	return &graphqlLoader{
+		db:      db,
+		users:   map[string]*models.User{},
+		forums:  map[string]*models.Forum{},
+		threads: map[int32]*models.Thread{},
+		posts:   map[int64]*models.Post{},
+	}
+}
+
+func loaderFrom(ctx context.Context) *graphqlLoader {
+	return ctx.Value(graphqlLoaderKey{}).(*graphqlLoader)
+}
+
+// The loaders record a key with no row as nil, so it is not asked for again.
+
+func (l *graphqlLoader) loadUsers(nicks []string) error {
+	missing := make([]string, 0)
+	for _, nick := range nicks {
+		if _, ok := l.users[nick]; !ok && nick != "" {
+			l.users[nick] = nil
+			missing = append(missing, nick)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	users, stat := l.db.GetUsersByNicknames(missing)
+	if stat != database.OK {
+		return errGraphQLDB
+	}
+	for _, user := range users {
+		l.users[user.Nickname] = user
+	}
+	return nil
+}
+
+func (l *graphqlLoader) loadForums(slugs []string) error {
+	missing := make([]string, 0)
+	for _, slug := range slugs {
+		if _, ok := l.forums[slug]; !ok && slug != "" {
+			l.forums[slug] = nil
+			missing = append(missing, slug)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	forums, stat := l.db.GetForumsBySlugs(missing)
+	if stat != database.OK {
+		return errGraphQLDB
+	}
+	for _, forum := range forums {
+		l.forums[forum.Slug] = forum
+	}
+	return nil
+}
+
+func (l *graphqlLoader) loadThreads(ids []int32) error {
+	missing := make([]int32, 0)
+	for _, id := range ids {
+		if _, ok := l.threads[id]; !ok && id != 0 {
+			l.threads[id] = nil
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	threads, stat := l.db.GetThreadsByIds(missing)
+	if stat != database.OK {
+		return errGraphQLDB
+	}
+	l.keepThreads(threads)
+	return nil
+}
+
+func (l *graphqlLoader) loadPosts(ids []int64) error {
+	missing := make([]int64, 0)
+	for _, id := range ids {
+		if _, ok := l.posts[id]; !ok && id != 0 {
+			l.posts[id] = nil
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	posts, stat := l.db.GetPostsByIds(missing)
+	if stat != database.OK {
+		return errGraphQLDB
+	}
+	l.keepPosts(posts)
+	return nil
+}
+
+// keepThreads and keepPosts remember objects read some other way, such as a
+// page of a list.
+func (l *graphqlLoader) keepThreads(threads models.Threads) {
+	for _, thread := range threads {
+		l.threads[thread.ID] = thread
+	}
+}
+
+func (l *graphqlLoader) keepPosts(posts models.Posts) {
+	for _, post := range posts {
+		l.posts[post.ID] = post
+	}
+}
+
+// userLink resolves a field naming a user by nickname.
+func userLink(nick func(source interface{}) string) graphql.Resolver {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		loader := loaderFrom(ctx)
+		nicks := make([]string, len(sources))
+		for i, source := range sources {
+			nicks[i] = nick(source)
+		}
+		err := loader.loadUsers(nicks)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(sources))
+		for i, nick := range nicks {
+			if user := loader.users[nick]; user != nil {
+				values[i] = user
+			}
+		}
+		return values, nil
+	}
+}
+
+func forumLink(slug func(source interface{}) string) graphql.Resolver {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		loader := loaderFrom(ctx)
+		slugs := make([]string, len(sources))
+		for i, source := range sources {
+			slugs[i] = slug(source)
+		}
+		err := loader.loadForums(slugs)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(sources))
+		for i, slug := range slugs {
+			if forum := loader.forums[slug]; forum != nil {
+				values[i] = forum
+			}
+		}
+		return values, nil
+	}
+}
+
+func threadLink(id func(source interface{}) int32) graphql.Resolver {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		loader := loaderFrom(ctx)
+		ids := make([]int32, len(sources))
+		for i, source := range sources {
+			ids[i] = id(source)
+		}
+		err := loader.loadThreads(ids)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(sources))
+		for i, id := range ids {
+			if thread := loader.threads[id]; thread != nil {
+				values[i] = thread
+			}
+		}
+		return values, nil
+	}
+}
+
+func postLink(id func(source interface{}) int64) graphql.Resolver {
+	return func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		loader := loaderFrom(ctx)
+		ids := make([]int64, len(sources))
+		for i, source := range sources {
+			ids[i] = id(source)
+		}
+		err := loader.loadPosts(ids)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(sources))
+		for i, id := range ids {
+			if post := loader.posts[id]; post != nil {
+				values[i] = post
+			}
+		}
+		return values, nil
+	}
+}
+
+// pageArgs turns the list arguments into the strings storage takes.
+func pageArgs(args map[string]interface{}) (limit string, since string, desc bool) {
+	if n, ok := args["limit"].(int64); ok {
+		limit = strconv.FormatInt(n, 10)
+	}
+	switch value := args["since"].(type) {
+	case string:
+		since = value
+	case int64:
+		since = strconv.FormatInt(value, 10)
+	}
+	desc, _ = args["desc"].(bool)
+	return limit, since, desc
+}
+
+func checkLimit(args map[string]interface{}) error {
+	if n, ok := args["limit"].(int64); ok && n <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+var listArgs = []graphql.Argument{
+	{Name: "limit", Type: "Int", Default: 100},
+	{Name: "since", Type: "String"},
+	{Name: "desc", Type: "Boolean", Default: false},
+}
+
+func newGraphQLSchema() (*graphql.Schema, error) {
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.Field{
+			{Name: "forum", Type: "Forum", Args: []graphql.Argument{{Name: "slug", Type: "String!"}},
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					forum, stat := loaderFrom(ctx).db.GetForum(args["slug"].(string))
+					return rootValue(&forum, stat)
+				}},
+			{Name: "thread", Type: "Thread", Args: []graphql.Argument{{Name: "slugOrId", Type: "String!"}},
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					key := args["slugOrId"].(string)
+					thread, stat := models.Thread{}, database.EmptyResult
+					switch SlugOrId(key) {
+					case id:
+						thread, stat = loaderFrom(ctx).db.GetThreadById(key)
+					case slug:
+						thread, stat = loaderFrom(ctx).db.GetThreadBySlug(key)
+					}
+					return rootValue(&thread, stat)
+				}},
+			{Name: "post", Type: "Post", Args: []graphql.Argument{{Name: "id", Type: "Int!"}},
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					post, stat := loaderFrom(ctx).db.GetPost(strconv.FormatInt(args["id"].(int64), 10))
+					return rootValue(&post, stat)
+				}},
+			{Name: "user", Type: "User", Args: []graphql.Argument{{Name: "nickname", Type: "String!"}},
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					user, stat := loaderFrom(ctx).db.GetUser(args["nickname"].(string))
+					return rootValue(&user, stat)
+				}},
+		},
+	}
+	forum := &graphql.Object{
+		Name: "Forum",
+		Fields: []*graphql.Field{
+			{Name: "slug", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Forum).Slug })},
+			{Name: "title", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Forum).Title })},
+			{Name: "postCount", Type: "Int!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Forum).Posts })},
+			{Name: "threadCount", Type: "Int!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Forum).Threads })},
+			{Name: "user", Type: "User", Resolve: userLink(func(s interface{}) string { return s.(*models.Forum).User })},
+			{Name: "threads", Type: "[Thread!]!", Args: listArgs, ListSize: 100,
+				Description: "Threads by creation time; since is a timestamp.",
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					err := checkLimit(args)
+					if err != nil {
+						return nil, err
+					}
+					loader := loaderFrom(ctx)
+					limit, since, desc := pageArgs(args)
+					slugs := make([]string, len(sources))
+					for i, source := range sources {
+						slugs[i] = source.(*models.Forum).Slug
+					}
+					threads, stat := loader.db.GetForumsThreads(slugs, limit, since, desc)
+					if stat != database.OK {
+						return nil, errGraphQLDB
+					}
+					values := make([]interface{}, len(sources))
+					for i, slug := range slugs {
+						loader.keepThreads(threads[slug])
+						list := make([]interface{}, len(threads[slug]))
+						for j, thread := range threads[slug] {
+							list[j] = thread
+						}
+						values[i] = list
+					}
+					return values, nil
+				}},
+			{Name: "users", Type: "[User!]!", Args: listArgs, ListSize: 100,
+				Description: "Users who posted in the forum, by nickname; since is a nickname.",
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					err := checkLimit(args)
+					if err != nil {
+						return nil, err
+					}
+					loader := loaderFrom(ctx)
+					limit, since, desc := pageArgs(args)
+					slugs := make([]string, len(sources))
+					for i, source := range sources {
+						slugs[i] = source.(*models.Forum).Slug
+					}
+					users, stat := loader.db.GetForumsUsers(slugs, limit, since, desc)
+					if stat != database.OK {
+						return nil, errGraphQLDB
+					}
+					values := make([]interface{}, len(sources))
+					for i, slug := range slugs {
+						list := make([]interface{}, len(users[slug]))
+						for j, user := range users[slug] {
+							loader.users[user.Nickname] = user
+							list[j] = user
+						}
+						values[i] = list
+					}
+					return values, nil
+				}},
+		},
+	}
+	thread := &graphql.Object{
+		Name: "Thread",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: "Int!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Thread).ID })},
+			{Name: "slug", Type: "String", Resolve: graphql.Each(func(s interface{}) interface{} {
+				if slug := s.(*models.Thread).Slug; slug != "" {
+					return slug
+				}
+				return nil
+			})},
+			{Name: "title", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Thread).Title })},
+			{Name: "message", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Thread).Message })},
+			{Name: "messageHtml", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Thread).MessageHTML })},
+			{Name: "created", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Thread).Created })},
+			{Name: "votes", Type: "Int!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Thread).Votes })},
+			{Name: "author", Type: "User", Resolve: userLink(func(s interface{}) string { return s.(*models.Thread).Author })},
+			{Name: "forum", Type: "Forum", Resolve: forumLink(func(s interface{}) string { return s.(*models.Thread).Forum })},
+			{Name: "posts", Type: "[Post!]!", ListSize: 100,
+				Description: "Posts in flat, tree or parent_tree order; since is a post id. For parent_tree, limit counts root posts.",
+				Args: []graphql.Argument{
+					{Name: "limit", Type: "Int", Default: 100},
+					{Name: "since", Type: "Int"},
+					{Name: "sort", Type: "String", Default: "flat"},
+					{Name: "desc", Type: "Boolean", Default: false},
+				},
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					err := checkLimit(args)
+					if err != nil {
+						return nil, err
+					}
+					sort := args["sort"].(string)
+					if sort != "flat" && sort != "tree" && sort != "parent_tree" {
+						return nil, errors.New("sort must be flat, tree or parent_tree")
+					}
+					loader := loaderFrom(ctx)
+					limit, since, desc := pageArgs(args)
+					ids := make([]int32, len(sources))
+					for i, source := range sources {
+						ids[i] = source.(*models.Thread).ID
+					}
+					posts, stat := loader.db.GetThreadsPosts(ids, limit, since, sort, desc)
+					if stat != database.OK {
+						return nil, errGraphQLDB
+					}
+					values := make([]interface{}, len(sources))
+					for i, id := range ids {
+						loader.keepPosts(posts[id])
+						list := make([]interface{}, len(posts[id]))
+						for j, post := range posts[id] {
+							list[j] = post
+						}
+						values[i] = list
+					}
+					return values, nil
+				}},
+			{Name: "voters", Type: "[Vote!]!", ListSize: 100,
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					ids := make([]int32, len(sources))
+					for i, source := range sources {
+						ids[i] = source.(*models.Thread).ID
+					}
+					votes, stat := loaderFrom(ctx).db.GetThreadsVotes(ids)
+					if stat != database.OK {
+						return nil, errGraphQLDB
+					}
+					values := make([]interface{}, len(sources))
+					for i, id := range ids {
+						list := make([]interface{}, len(votes[id]))
+						for j, vote := range votes[id] {
+							list[j] = vote
+						}
+						values[i] = list
+					}
+					return values, nil
+				}},
+		},
+	}
+	post := &graphql.Object{
+		Name: "Post",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: "Int!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Post).ID })},
+			{Name: "message", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Post).Message })},
+			{Name: "messageHtml", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Post).MessageHTML })},
+			{Name: "created", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Post).Created })},
+			{Name: "isEdited", Type: "Boolean!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Post).IsEdited })},
+			{Name: "author", Type: "User", Resolve: userLink(func(s interface{}) string { return s.(*models.Post).Author })},
+			{Name: "thread", Type: "Thread", Resolve: threadLink(func(s interface{}) int32 { return s.(*models.Post).Thread })},
+			{Name: "forum", Type: "Forum", Resolve: forumLink(func(s interface{}) string { return s.(*models.Post).Forum })},
+			{Name: "parent", Type: "Post", Resolve: postLink(func(s interface{}) int64 { return s.(*models.Post).Parent })},
+			{Name: "children", Type: "[Post!]!", ListSize: 10,
+				Description: "Direct answers to the post, oldest first.",
+				Args:        []graphql.Argument{{Name: "limit", Type: "Int", Default: 10}},
+				Resolve: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+					err := checkLimit(args)
+					if err != nil {
+						return nil, err
+					}
+					limit, _, _ := pageArgs(args)
+					ids := make([]int64, len(sources))
+					for i, source := range sources {
+						ids[i] = source.(*models.Post).ID
+					}
+					loader := loaderFrom(ctx)
+					children, stat := loader.db.GetPostsByParents(ids, limit)
+					if stat != database.OK {
+						return nil, errGraphQLDB
+					}
+					loader.keepPosts(children)
+					byParent := map[int64][]interface{}{}
+					for _, child := range children {
+						byParent[child.Parent] = append(byParent[child.Parent], child)
+					}
+					values := make([]interface{}, len(sources))
+					for i, id := range ids {
+						values[i] = byParent[id]
+						if byParent[id] == nil {
+							values[i] = []interface{}{}
+						}
+					}
+					return values, nil
+				}},
+		},
+	}
+	user := &graphql.Object{
+		Name: "User",
+		Fields: []*graphql.Field{
+			{Name: "nickname", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.User).Nickname })},
+			{Name: "fullname", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.User).Fullname })},
+			{Name: "about", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.User).About })},
+			{Name: "email", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.User).Email })},
+		},
+	}
+	vote := &graphql.Object{
+		Name: "Vote",
+		Fields: []*graphql.Field{
+			{Name: "nickname", Type: "String!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Vote).Nickname })},
+			{Name: "voice", Type: "Int!", Resolve: graphql.Each(func(s interface{}) interface{} { return s.(*models.Vote).Voice })},
+			{Name: "user", Type: "User", Resolve: userLink(func(s interface{}) string { return s.(*models.Vote).Nickname })},
+		},
+	}
+	return graphql.NewSchema(query, forum, thread, post, user, vote)
+}
+
+// rootValue answers a root field with the object storage returned, or null
+// when there is none.
+func rootValue(value interface{}, stat int) ([]interface{}, error) {
+	switch stat {
+	case database.OK:
+		return []interface{}{value}, nil
+	case database.EmptyResult:
+		return []interface{}{nil}, nil
+	}
+	return nil, errGraphQLDB
+}
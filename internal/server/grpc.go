@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/grpcapi"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// newGRPCServer serves the gRPC API on port. gRPC needs HTTP/2, which
+// without TLS is spoken from the first byte (h2c with prior knowledge).
+func (serv *Server) newGRPCServer(port int) *http.Server {
+	protocols := new(http.Protocols)
+	if serv.tls != nil {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	handler := grpcapi.NewHandler(grpcService{serv: serv})
+	return &http.Server{
+		Addr:      ":" + strconv.Itoa(port),
+		Handler:   serv.RequestID(serv.Trace(serv.AccessLog(handler))),
+		TLSConfig: serv.tls,
+		Protocols: protocols,
+	}
+}
+
+// grpcService answers gRPC calls from storage, making the checks the REST
+// handlers of the same operations make.
+type grpcService struct {
+	serv *Server
+}
+
+func grpcError(ref *refusal) error {
+	if ref == nil {
+		return nil
+	}
+	return grpcapi.Error(ref.status, ref.message)
+}
+
+func grpcStatus(stat int) error {
+	return grpcError(statusRefusal(stat))
+}
+
+var errBadThread = grpcapi.Error(http.StatusBadRequest, "Invalid thread slug or id")
+
+// listParams turns the paging of a list call into the parameters ParseParams
+// reads from the query.
+func listParams(limit int, desc bool) (string, string) {
+	order := "asc"
+	if desc {
+		order = "desc"
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	return strconv.Itoa(limit), order
+}
+
+func (s grpcService) Authenticate(r *http.Request) (context.Context, error) {
+	ctx, ref := s.serv.authenticate(r)
+	return ctx, grpcError(ref)
+}
+
+func (s grpcService) CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error) {
+	err := grpcError(s.serv.checkActingUser(actorOf(ctx), forum.User))
+	if err != nil {
+		return models.Forum{}, err
+	}
+	forum, stat := s.serv.storeFor(ctx).CreateForum(forum)
+	return forum, grpcStatus(stat)
+}
+
+func (s grpcService) GetForum(ctx context.Context, slug string) (models.Forum, error) {
+	forum, stat := s.serv.storeFor(ctx).GetForum(slug)
+	return forum, grpcStatus(stat)
+}
+
+func (s grpcService) GetForumThreads(ctx context.Context, slug string, limit int, since string,
+	desc bool) (models.Threads, error) {
+	limitParam, order := listParams(limit, desc)
+	threads, stat := s.serv.storeFor(ctx).GetForumThreads(slug, limitParam, since, order)
+	return threads, grpcStatus(stat)
+}
+
+func (s grpcService) GetForumUsers(ctx context.Context, slug string, limit int, since string,
+	desc bool) (models.Users, error) {
+	limitParam, order := listParams(limit, desc)
+	users, stat := s.serv.storeFor(ctx).GetForumUsers(slug, limitParam, since, order)
+	return users, grpcStatus(stat)
+}
+
+func (s grpcService) CreateThread(ctx context.Context, forumId string, thread models.Thread) (models.Thread, error) {
+	store := s.serv.storeFor(ctx)
+	ref := s.serv.checkActingUser(actorOf(ctx), thread.Author)
+	if ref == nil {
+		ref = s.serv.filterThread(store, forumId, &thread)
+	}
+	if ref != nil {
+		return models.Thread{}, grpcError(ref)
+	}
+	thread, stat := store.CreateThread(thread, forumId)
+	return thread, grpcStatus(stat)
+}
+
+func (s grpcService) GetThread(ctx context.Context, slugOrId string) (models.Thread, error) {
+	thread, stat := models.Thread{}, database.OK
+	switch SlugOrId(slugOrId) {
+	case slug:
+		thread, stat = s.serv.storeFor(ctx).GetThreadBySlug(slugOrId)
+	case id:
+		thread, stat = s.serv.storeFor(ctx).GetThreadById(slugOrId)
+	default:
+		return thread, errBadThread
+	}
+	return thread, grpcStatus(stat)
+}
+
+func (s grpcService) UpdateThread(ctx context.Context, slugOrId string,
+	update models.ThreadUpdate) (models.Thread, error) {
+	store := s.serv.storeFor(ctx)
+	thread, stat := models.Thread{}, database.OK
+	switch SlugOrId(slugOrId) {
+	case slug:
+		err := grpcError(s.serv.authorize(actorOf(ctx), s.serv.access.For(ctx).CanEditThreadBySlug, slugOrId))
+		if err != nil {
+			return thread, err
+		}
+		thread, stat = store.UpdateThreadBySlug(slugOrId, update)
+	case id:
+		err := grpcError(s.serv.authorize(actorOf(ctx), s.serv.access.For(ctx).CanEditThreadById, slugOrId))
+		if err != nil {
+			return thread, err
+		}
+		thread, stat = store.UpdateThreadById(slugOrId, update)
+	default:
+		return thread, errBadThread
+	}
+	return thread, grpcStatus(stat)
+}
+
+func (s grpcService) Vote(ctx context.Context, slugOrId string, vote models.Vote) (models.Thread, error) {
+	err := grpcError(s.serv.checkActingUser(actorOf(ctx), vote.Nickname))
+	if err != nil {
+		return models.Thread{}, err
+	}
+	thread, stat := models.Thread{}, database.OK
+	switch SlugOrId(slugOrId) {
+	case slug:
+		thread, stat = s.serv.storeFor(ctx).VoteBySlug(slugOrId, vote)
+	case id:
+		thread, stat = s.serv.storeFor(ctx).VoteById(slugOrId, vote)
+	default:
+		return thread, errBadThread
+	}
+	return thread, grpcStatus(stat)
+}
+
+func (s grpcService) CreatePosts(ctx context.Context, slugOrId string, posts models.Posts) (models.Posts, error) {
+	store := s.serv.storeFor(ctx)
+	err := grpcError(s.serv.checkNewPosts(store, actorOf(ctx), posts))
+	if err != nil {
+		return nil, err
+	}
+	var rejected *models.FilterRule
+	stat := database.OK
+	switch SlugOrId(slugOrId) {
+	case slug:
+		posts, stat = store.CreatePostsBySlug(slugOrId, posts, s.serv.postsFilter(&rejected))
+	case id:
+		posts, stat = store.CreatePostsById(slugOrId, posts, s.serv.postsFilter(&rejected))
+	default:
+		return nil, errBadThread
+	}
+	if rejected != nil {
+		return nil, grpcError(rejectedBy(rejected))
+	}
+	return posts, grpcStatus(stat)
+}
+
+func (s grpcService) GetThreadPosts(ctx context.Context, slugOrId string, limit int, since int64,
+	sort string, desc bool) (models.Posts, error) {
+	sinceParam := ""
+	if since != 0 {
+		sinceParam = strconv.FormatInt(since, 10)
+	}
+	limitParam, descParam := strconv.Itoa(limit), strconv.FormatBool(desc)
+	posts, stat := models.Posts{}, database.OK
+	switch SlugOrId(slugOrId) {
+	case slug:
+		posts, stat = s.serv.storeFor(ctx).GetPostsBySlug(slugOrId, limitParam, sinceParam, sort, descParam)
+	case id:
+		posts, stat = s.serv.storeFor(ctx).GetPostsById(slugOrId, limitParam, sinceParam, sort, descParam)
+	default:
+		return nil, errBadThread
+	}
+	return posts, grpcStatus(stat)
+}
+
+func (s grpcService) GetPost(ctx context.Context, postId int64, related []string) (models.PostFull, error) {
+	post, stat := s.serv.storeFor(ctx).GetPostInfo(strconv.FormatInt(postId, 10), related)
+	return post, grpcStatus(stat)
+}
+
+func (s grpcService) UpdatePost(ctx context.Context, postId int64, update models.PostUpdate) (models.Post, error) {
+	postIdParam := strconv.FormatInt(postId, 10)
+	err := grpcError(s.serv.authorize(actorOf(ctx), s.serv.access.For(ctx).CanEditPost, postIdParam))
+	if err != nil {
+		return models.Post{}, err
+	}
+	post, stat := s.serv.storeFor(ctx).UpdatePost(postIdParam, update)
+	return post, grpcStatus(stat)
+}
+
+func (s grpcService) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	passwordHash, ref := s.serv.checkNewUser(user)
+	if ref != nil {
+		return models.User{}, grpcError(ref)
+	}
+	users, stat := s.serv.storeFor(ctx).CreateUser(user, passwordHash)
+	if stat != database.OK || len(users) == 0 {
+		return models.User{}, grpcStatus(stat)
+	}
+	return *users[0], nil
+}
+
+func (s grpcService) GetUser(ctx context.Context, nickname string) (models.User, error) {
+	user, stat := s.serv.storeFor(ctx).GetUser(nickname)
+	return user, grpcStatus(stat)
+}
+
+func (s grpcService) UpdateUser(ctx context.Context, nickname string, update models.UserUpdate) (models.User, error) {
+	err := grpcError(s.serv.authorize(actorOf(ctx), s.serv.access.For(ctx).CanEditUser, nickname))
+	if err != nil {
+		return models.User{}, err
+	}
+	user, stat := s.serv.storeFor(ctx).UpdateUser(nickname, update)
+	return user, grpcStatus(stat)
+}
+
+func (s grpcService) GetStatus(ctx context.Context) (models.Status, error) {
+	status, stat := s.serv.storeFor(ctx).GetDBInfo()
+	return status, grpcStatus(stat)
+}
+
+func (s grpcService) Clear(ctx context.Context) error {
+	_, ref := s.serv.requireAdmin(ctx)
+	if ref != nil {
+		return grpcError(ref)
+	}
+	err := s.serv.clearDB(ctx)
+	if err != nil {
+		return grpcapi.Error(http.StatusInternalServerError, "error in database")
+	}
+	return nil
+}
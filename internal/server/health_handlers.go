@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"sync/atomic"
+)
+
+// Healthz answers as long as the process serves HTTP at all.
+func (serv *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	WriteToResponse(w, http.StatusOK, models.Health{Status: "ok"})
+}
+
+// Readyz answers 200 only while the server should get traffic: the database
+// answers, it is migrated to the version this build expects and the server is
+// not shutting down.
+func (serv *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	health := models.Health{Status: "ready", Checks: map[string]string{}}
+	ready := true
+	if atomic.LoadInt32(&serv.draining) != 0 {
+		health.Checks["server"] = "shutting down"
+		ready = false
+	}
+	version, stat := serv.store(r).GetSchemaVersion()
+	latest := serv.db.LatestSchemaVersion()
+	switch {
+	case stat != database.OK:
+		health.Checks["database"] = "unreachable"
+		ready = false
+	case version != latest:
+		health.Checks["database"] = "ok"
+		health.Checks["migrations"] = fmt.Sprintf("at version %d of %d", version, latest)
+		ready = false
+	default:
+		health.Checks["database"] = "ok"
+		health.Checks["migrations"] = "ok"
+	}
+	if !ready {
+		health.Status = "not ready"
+		WriteToResponse(w, http.StatusServiceUnavailable, health)
+		return
+	}
+	WriteToResponse(w, http.StatusOK, health)
+}
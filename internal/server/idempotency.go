@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/idempotency"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const expiredKeysCleanup = 10 * time.Minute
+
+func NewIdempotencyStore(db *database.DB, conf config.Idempotency) idempotency.Store {
+	if conf.Store == "postgres" {
+		return &pgIdempotencyStore{db: db, lastCleanup: time.Now()}
+	}
+	return idempotency.NewMemoryStore()
+}
+
+// Idempotent serves a request sent with an Idempotency-Key header once. A
+// retry with the same key and request gets the stored response again, byte
+// for byte, with Idempotent-Replayed set; reusing the key for a different
+// request gets 422, and retrying while the first request runs gets 409.
+// Keys belong to the acting user, or to the client address for anonymous
+// requests. Server errors and panics are not kept, so a retry after one runs
+// again.
+func (serv *Server) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			errText := models.Error{Message: "Cannot read body"}
+			WriteToResponse(w, http.StatusBadRequest, errText)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		if nickname := ActingUser(r); nickname != "" {
+			key = "user:" + nickname + ":" + key
+		} else {
+			key = "ip:" + serv.clientIP(r) + ":" + key
+		}
+		ttl := time.Duration(serv.conf().Idempotency.TTLSeconds) * time.Second
+		stored, err := serv.replays.Begin(key, fingerprint, ttl, time.Now())
+		if err != nil {
+			requestLogger(r).Error("idempotency store failed", "error", err.Error())
+			errText := models.Error{Message: "Error in DB"}
+			WriteToResponse(w, http.StatusInternalServerError, errText)
+			return
+		}
+		if stored != nil {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				errText := models.Error{Message: "Idempotency-Key was used for a different request"}
+				WriteToResponse(w, http.StatusUnprocessableEntity, errText)
+			case !stored.Done():
+				errText := models.Error{Message: "A request with this Idempotency-Key is in progress"}
+				WriteToResponse(w, http.StatusConflict, errText)
+			default:
+				replay(w, r, stored)
+			}
+			return
+		}
+
+		capturing := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// a handler that panicked answered nothing worth replaying
+			err := serv.replays.Release(key)
+			if err != nil {
+				requestLogger(r).Error("idempotency store failed", "error", err.Error())
+			}
+			panic(recovered)
+		}()
+		next.ServeHTTP(capturing, r)
+		if capturing.status >= http.StatusInternalServerError {
+			err = serv.replays.Release(key)
+		} else {
+			err = serv.replays.Complete(key, idempotency.Response{
+				Fingerprint: fingerprint,
+				Status:      capturing.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        capturing.body.Bytes(),
+			})
+		}
+		if err != nil {
+			requestLogger(r).Error("idempotency store failed", "error", err.Error())
+		}
+	})
+}
+
+func replay(w http.ResponseWriter, r *http.Request, stored *idempotency.Response) {
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	if negotiating := negotiatorOf(w); negotiating != nil {
+		negotiating.compress(w.Header(), len(stored.Body))
+	}
+	w.WriteHeader(stored.Status)
+	_, err := w.Write(stored.Body)
+	if err != nil {
+		requestLogger(r).Warn("unable to write to response", "error", err.Error())
+	}
+}
+
+// capturingWriter keeps a copy of the response for Idempotent.
+type capturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (cw *capturingWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.status = status
+		cw.wroteHeader = true
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *capturingWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+	cw.body.Write(p)
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *capturingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// pgIdempotencyStore keeps the responses in Postgres so that they are shared
+// by all instances.
+type pgIdempotencyStore struct {
+	db          *database.DB
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func (s *pgIdempotencyStore) Begin(key string, fingerprint string, ttl time.Duration, now time.Time) (*idempotency.Response, error) {
+	s.mu.Lock()
+	if now.Sub(s.lastCleanup) > expiredKeysCleanup {
+		s.lastCleanup = now
+		go s.db.DeleteExpiredIdempotencyKeys()
+	}
+	s.mu.Unlock()
+	return s.db.ClaimIdempotencyKey(key, fingerprint, ttl.Seconds())
+}
+
+func (s *pgIdempotencyStore) Complete(key string, resp idempotency.Response) error {
+	return s.db.CompleteIdempotencyKey(key, resp)
+}
+
+func (s *pgIdempotencyStore) Release(key string) error {
+	return s.db.ReleaseIdempotencyKey(key)
+}
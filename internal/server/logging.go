@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/logging"
+	"github.com/sergeychur/technopark_db/internal/tracing"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const requestIdHeader = "X-Request-ID"
+
+// RequestID takes the id from X-Request-ID or makes one, echoes it back and
+// puts a logger carrying it into the request context.
+func (serv *Server) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIdHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(requestIdHeader, id)
+		ctx := logging.WithRequestID(r.Context(), id)
+		ctx = logging.WithLogger(ctx, serv.log.With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AccessLog logs every request once it is answered.
+func (serv *Server) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		status := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(status, r)
+		if status.status == 0 {
+			status.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status.status),
+			slog.Int64("bytes", status.written),
+			slog.Float64("duration_ms", float64(time.Since(started).Microseconds())/1000),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+		}
+		requestLogger(r).LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+func requestLogger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context())
+}
+
+// store returns the storage with the logger and span of the request, so that
+// storage errors and statements can be traced back to it.
+func (serv *Server) store(r *http.Request) *database.DB {
+	return serv.storeFor(r.Context())
+}
+
+func (serv *Server) storeFor(ctx context.Context) *database.DB {
+	return serv.db.WithLogger(logging.FromContext(ctx)).WithSpan(tracing.SpanFromContext(ctx))
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newHttpMetrics(registry *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: registry.NewCounter("forum_http_requests_total",
+			"HTTP requests answered, by route pattern, method and status.", "route", "method", "status"),
+		duration: registry.NewHistogram("forum_http_request_duration_seconds",
+			"Time to answer an HTTP request, by route pattern, method and status.",
+			metrics.DefaultBuckets, "route", "method", "status"),
+	}
+}
+
+// Measure records every request under the chi pattern it matched rather than
+// its path, so that ids and slugs do not make a series each.
+func (serv *Server) Measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		status := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(status, r)
+		if status.status == 0 {
+			status.status = http.StatusOK
+		}
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := strconv.Itoa(status.status)
+		serv.httpMetrics.requests.Inc(route, r.Method, code)
+		serv.httpMetrics.duration.Observe(time.Since(started).Seconds(), route, r.Method, code)
+	})
+}
+
+func (serv *Server) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	serv.metrics.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"time"
+)
+
+func (serv *Server) GetForumBans(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	bans, stat := serv.store(r).GetForumBans(forumId)
+	DealGetStatus(w, &bans, stat)
+}
+
+func (serv *Server) BanUser(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	ban := models.Ban{}
+	err := ReadFromBody(r, w, &ban)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	stat := serv.accessOf(r).CanBan(ActingUser(r), forumId, ban.Nickname)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	expires := time.Time{}
+	if ban.Expires != "" {
+		expires, err = time.Parse("2006-01-02T15:04:05.999999999Z07:00", ban.Expires)
+		if err != nil || expires.Before(time.Now()) {
+			errText := models.Error{Message: "expires incorrect"}
+			WriteToResponse(w, http.StatusBadRequest, errText)
+			return
+		}
+	}
+	ban, stat = serv.store(r).BanUser(forumId, ban.Nickname, ban.Reason, ActingUser(r), expires)
+	DealCreateStatus(w, &ban, stat)
+}
+
+func (serv *Server) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	userNick := chi.URLParam(r, "nickname")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	stat := serv.store(r).UnbanUser(forumId, userNick, ActingUser(r))
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (serv *Server) GetForumSettings(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	settings, stat := serv.store(r).GetForumSettings(forumId)
+	DealGetStatus(w, &settings, stat)
+}
+
+func (serv *Server) UpdateForumSettings(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	settings := models.ForumSettings{TrustedAfter: 1}
+	err := ReadFromBody(r, w, &settings)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanManageForum, forumId) {
+		return
+	}
+	settings, stat := serv.store(r).UpdateForumSettings(forumId, settings)
+	DealGetStatus(w, &settings, stat)
+}
+
+func (serv *Server) GetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	var (
+		limit = ""
+		since = ""
+	)
+	err := ParsePage(w, r, &limit, &since)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	posts, stat := serv.store(r).GetPendingPosts(forumId, limit, since)
+	DealGetStatus(w, &posts, stat)
+}
+
+func (serv *Server) ApprovePendingPost(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	pendingId := chi.URLParam(r, "id")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	post, stat := serv.store(r).ApprovePendingPost(forumId, pendingId, ActingUser(r))
+	DealGetStatus(w, &post, stat)
+}
+
+func (serv *Server) RejectPendingPost(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	pendingId := chi.URLParam(r, "id")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	stat := serv.store(r).RejectPendingPost(forumId, pendingId, ActingUser(r))
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+)
+
+func (serv *Server) GetForumModerators(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	moderators, stat := serv.store(r).GetForumModerators(forumId)
+	DealGetStatus(w, &moderators, stat)
+}
+
+func (serv *Server) AddForumModerator(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	moderator := models.Moderator{}
+	err := ReadFromBody(r, w, &moderator)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanManageForum, forumId) {
+		return
+	}
+	moderator, stat := serv.store(r).AddForumModerator(forumId, moderator.Nickname, ActingUser(r))
+	DealCreateStatus(w, &moderator, stat)
+}
+
+func (serv *Server) RemoveForumModerator(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	userNick := chi.URLParam(r, "nickname")
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanManageForum, forumId) {
+		return
+	}
+	stat := serv.store(r).RemoveForumModerator(forumId, userNick)
+	if stat != database.OK {
+		DealGetStatus(w, nil, stat)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
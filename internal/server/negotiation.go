@@ -0,0 +1,144 @@
+package server
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sergeychur/technopark_db/config"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiate lets WriteToResponse answer conditional GETs and compress bodies
+// for the request. It sits outside RecordTraffic, so recorded bodies are the
+// ones the handlers wrote, not their gzipped form.
+func (serv *Server) Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		negotiating := &negotiatingWriter{ResponseWriter: w, request: r, conf: serv.conf().Responses}
+		defer func() {
+			err := negotiating.close()
+			if err != nil {
+				requestLogger(r).Warn("unable to finish compressed response", "error", err.Error())
+			}
+		}()
+		next.ServeHTTP(negotiating, r)
+	})
+}
+
+// negotiatingWriter gzips what is written once WriteToResponse has picked
+// gzip for the response.
+type negotiatingWriter struct {
+	http.ResponseWriter
+	request *http.Request
+	conf    config.Responses
+	gzip    *gzip.Writer
+}
+
+func (w *negotiatingWriter) Write(p []byte) (int, error) {
+	if w.gzip != nil {
+		return w.gzip.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *negotiatingWriter) Flush() {
+	if w.gzip != nil {
+		_ = w.gzip.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *negotiatingWriter) close() error {
+	if w.gzip == nil {
+		return nil
+	}
+	return w.gzip.Close()
+}
+
+// negotiatorOf finds the negotiatingWriter under the writers wrapping it.
+func negotiatorOf(w http.ResponseWriter) *negotiatingWriter {
+	for {
+		if negotiating, ok := w.(*negotiatingWriter); ok {
+			return negotiating
+		}
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = wrapper.Unwrap()
+	}
+}
+
+// notModified sets the ETag of a successful GET and tells whether the
+// request already holds that version. The tag is the same for the identity
+// and the gzipped body but for a -gzip suffix, so either cached form matches.
+func (w *negotiatingWriter) notModified(header http.Header, status int, body []byte) bool {
+	method := w.request.Method
+	if !w.conf.ETags || status != http.StatusOK || (method != http.MethodGet && method != http.MethodHead) {
+		return false
+	}
+	sum := sha256.Sum256(body)
+	tag := hex.EncodeToString(sum[:16])
+	header.Set("ETag", strconv.Quote(tag))
+	for _, candidate := range strings.Split(w.request.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || strings.TrimSuffix(strings.Trim(candidate, `"`), "-gzip") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// compress switches the response to gzip when the body is large enough and
+// the client accepts it. Brotli is not offered: the standard library has no
+// encoder for it.
+func (w *negotiatingWriter) compress(header http.Header, size int) {
+	if !w.conf.Compress || size < w.conf.CompressMinSize || header.Get("Content-Encoding") != "" {
+		return
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(w.request.Header.Get("Accept-Encoding")) {
+		return
+	}
+	writer, err := gzip.NewWriterLevel(w.ResponseWriter, w.conf.CompressLevel)
+	if err != nil {
+		return
+	}
+	w.gzip = writer
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); etag != "" {
+		header.Set("ETag", strings.TrimSuffix(etag, `"`)+`-gzip"`)
+	}
+}
+
+// acceptsGzip reads an Accept-Encoding header; gzip is acceptable when it,
+// or *, is listed with a non-zero quality.
+func acceptsGzip(acceptEncoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+		if coding != "*" {
+			return quality > 0
+		}
+		accepted = quality > 0
+	}
+	return accepted
+}
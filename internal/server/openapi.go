@@ -0,0 +1,36 @@
+package server
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"github.com/sergeychur/technopark_db/internal/openapi"
+	"net/http"
+)
+
+// ValidateRequest answers 400 to requests whose parameters or body do not
+// match the OpenAPI document, and 413 to JSON bodies over openapi.MaxJSONBody.
+// Requests the document does not describe are left to the router.
+func (serv *Server) ValidateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := serv.api.Validate(r)
+		if err == openapi.ErrBodyTooLarge {
+			errText := models.Error{Message: err.Error()}
+			WriteToResponse(w, http.StatusRequestEntityTooLarge, errText)
+			return
+		}
+		if err != nil {
+			errText := models.Error{Message: err.Error()}
+			WriteToResponse(w, http.StatusBadRequest, errText)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (serv *Server) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(openapi.Spec)
+	if err != nil {
+		requestLogger(r).Warn("unable to write the OpenAPI document", "error", err.Error())
+	}
+}
@@ -16,7 +16,9 @@ func (serv *Server) GetPostInfo(w http.ResponseWriter, r *http.Request) {
 		related = strings.Split(relatedStr[0], ",")
 	}
 	post := models.PostFull{}
-	post, stat := serv.db.GetPostInfo(PostId, related)
+	post, stat := serv.store(r).GetPostInfo(PostId, related)
+	StripPostsHTML(r, post.Post)
+	StripThreadsHTML(r, post.Thread)
 	DealGetStatus(w, &post, stat)
 }
 
@@ -27,6 +29,9 @@ func (serv *Server) EditPost(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	post, stat := serv.db.UpdatePost(PostId, postUpdate)
+	if !serv.Authorize(w, r, serv.accessOf(r).CanEditPost, PostId) {
+		return
+	}
+	post, stat := serv.store(r).UpdatePost(PostId, postUpdate)
 	DealGetStatus(w, &post, stat)
 }
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"github.com/sergeychur/technopark_db/internal/ratelimit"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	writesClass = "writes"
+	votesClass  = "votes"
+	readsClass  = "reads"
+
+	staleLimitsCleanup = 10 * time.Minute
+)
+
+func NewLimiter(db *database.DB, conf config.RateLimits) *ratelimit.Limiter {
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if conf.Store == "postgres" {
+		store = &pgLimitStore{db: db, lastCleanup: time.Now()}
+	}
+	return ratelimit.NewLimiter(store, RouteLimits(conf))
+}
+
+func RouteLimits(conf config.RateLimits) map[string]ratelimit.Limit {
+	return map[string]ratelimit.Limit{
+		writesClass: {Rate: conf.Writes.Rate, Burst: conf.Writes.Burst},
+		votesClass:  {Rate: conf.Votes.Rate, Burst: conf.Votes.Burst},
+		readsClass:  {Rate: conf.Reads.Rate, Burst: conf.Reads.Burst},
+	}
+}
+
+// RateLimit throttles requests per route class, keyed by the acting user or,
+// for anonymous requests, by the client address.
+func (serv *Server) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "user:" + ActingUser(r)
+		if ActingUser(r) == "" {
+			key = "ip:" + serv.clientIP(r)
+		}
+		allowed, retryAfter, err := serv.limiter.Allow(routeClass(r), key)
+		if err != nil {
+			requestLogger(r).Error("rate limit store failed, letting request through", "error", err.Error())
+			allowed = true
+		}
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			errText := models.Error{Message: "Too many requests"}
+			WriteToResponse(w, http.StatusTooManyRequests, errText)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func routeClass(r *http.Request) string {
+	if strings.HasSuffix(r.URL.Path, "/vote") {
+		return votesClass
+	}
+	// GraphQL only serves queries, whichever the method.
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || strings.HasSuffix(r.URL.Path, "/graphql") {
+		return readsClass
+	}
+	return writesClass
+}
+
+func (serv *Server) clientIP(r *http.Request) string {
+	if serv.conf().RateLimits.TrustForwarded {
+		forwarded := r.Header.Get("X-Forwarded-For")
+		if forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		realIP := r.Header.Get("X-Real-IP")
+		if realIP != "" {
+			return realIP
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// pgLimitStore keeps the buckets in Postgres so that they are shared by all instances.
+type pgLimitStore struct {
+	db          *database.DB
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func (s *pgLimitStore) Take(key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	if now.Sub(s.lastCleanup) > staleLimitsCleanup {
+		s.lastCleanup = now
+		go s.db.DeleteStaleRateLimits(staleLimitsCleanup.Seconds())
+	}
+	s.mu.Unlock()
+	allowed, tokens, err := s.db.TakeRateLimitToken(key, limit.Rate, limit.Burst)
+	if err != nil || allowed {
+		return allowed, 0, err
+	}
+	return false, time.Duration((1 - tokens) / limit.Rate * float64(time.Second)), nil
+}
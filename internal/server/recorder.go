@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sergeychur/technopark_db/internal/traffic"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultRecordedBody = 64 << 10
+
+// redactedFields are the body fields replaced with redactedValue, at any depth.
+var redactedFields = map[string]bool{
+	"password": true,
+	"token":    true,
+}
+
+const redactedValue = "[redacted]"
+
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// RecordTraffic writes every API exchange to the recorder, if one is
+// configured. Credentials are not recorded: neither the credential headers
+// nor the password and token fields of bodies. Non-text bodies are left out.
+func (serv *Server) RecordTraffic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serv.recorder == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit := serv.conf().Recorder.MaxBody
+		if limit <= 0 {
+			limit = defaultRecordedBody
+		}
+		started := time.Now()
+		exchange := traffic.Exchange{
+			Time: started.Format("2006-01-02T15:04:05.999999999Z07:00"),
+			Request: traffic.Request{
+				Method:  r.Method,
+				Path:    r.URL.RequestURI(),
+				Headers: recordedHeaders(r.Header),
+			},
+		}
+		requestBody, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+		exchange.Request.Body, exchange.Request.Truncated = recordedBody(requestBody, limit)
+
+		recording := &recordingWriter{ResponseWriter: w, status: http.StatusOK, limit: limit}
+		next.ServeHTTP(recording, r)
+
+		exchange.Duration = float64(time.Since(started).Microseconds()) / 1000
+		exchange.Response.Status = recording.status
+		exchange.Response.Headers = recordedHeaders(w.Header())
+		exchange.Response.Body, exchange.Response.Truncated = recordedBody(recording.body.Bytes(), limit)
+		exchange.Response.Truncated = exchange.Response.Truncated || recording.truncated
+		err = serv.recorder.Record(exchange)
+		if err != nil {
+			requestLogger(r).Error("failed to record exchange", "error", err.Error())
+		}
+	})
+}
+
+func recordedHeaders(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+	recorded := make(map[string]string, len(header))
+	for name, values := range header {
+		if redactedHeaders[name] {
+			continue
+		}
+		recorded[name] = strings.Join(values, ", ")
+	}
+	return recorded
+}
+
+func recordedBody(body []byte, limit int) (string, bool) {
+	body, ok := redactBody(body)
+	if !ok {
+		return "", true
+	}
+	truncated := len(body) > limit
+	if truncated {
+		body = body[:limit]
+	}
+	if !utf8.Valid(body) {
+		return "", true
+	}
+	return string(body), truncated
+}
+
+// redactBody replaces the redacted fields of a JSON body. A body that is not
+// JSON, or was cut short, but mentions one of them is not recorded at all.
+func redactBody(body []byte) ([]byte, bool) {
+	if len(body) == 0 {
+		return body, true
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		lower := bytes.ToLower(body)
+		for field := range redactedFields {
+			if bytes.Contains(lower, []byte(`"`+field+`"`)) {
+				return nil, false
+			}
+		}
+		return body, true
+	}
+	if !redactValue(value) {
+		return body, true
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	return redacted, true
+}
+
+func redactValue(value interface{}) bool {
+	redacted := false
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if redactedFields[strings.ToLower(key)] {
+				value[key] = redactedValue
+				redacted = true
+				continue
+			}
+			redacted = redactValue(field) || redacted
+		}
+	case []interface{}:
+		for _, item := range value {
+			redacted = redactValue(item) || redacted
+		}
+	}
+	return redacted
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	limit       int
+	truncated   bool
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	left := rw.limit + 1 - rw.body.Len()
+	if left > 0 {
+		if len(p) > left {
+			rw.body.Write(p[:left])
+		} else {
+			rw.body.Write(p)
+		}
+	} else {
+		rw.truncated = true
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *recordingWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
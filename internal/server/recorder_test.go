@@ -0,0 +1,59 @@
+package server
+
+import (
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"github.com/sergeychur/technopark_db/internal/traffic"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordTrafficRedactsCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	recorder, err := traffic.NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serv := &Server{config: config.Default(), recorder: recorder}
+	login := serv.RecordTraffic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credentials := models.Credentials{}
+		if ReadFromBody(r, w, &credentials) != nil {
+			return
+		}
+		WriteToResponse(w, http.StatusCreated, models.Token{Token: "secret-session-token"})
+	}))
+
+	body := `{"nickname":"alice","password":"hunter2-password"}`
+	r := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret-header-token")
+	w := httptest.NewRecorder()
+	login.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusCreated)
+	}
+	if !strings.Contains(w.Body.String(), "secret-session-token") {
+		t.Fatalf("the client did not get its token: %s", w.Body.String())
+	}
+	err = recorder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(recorded)
+	for _, secret := range []string{"hunter2-password", "secret-session-token", "secret-header-token"} {
+		if strings.Contains(line, secret) {
+			t.Errorf("recorded exchange contains %q: %s", secret, line)
+		}
+	}
+	if !strings.Contains(line, "alice") {
+		t.Errorf("recorded exchange lost the fields that are not credentials: %s", line)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/logging"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"time"
+)
+
+// SetConfigLoader sets how Reload reads the configuration again, usually the
+// same way it was read at startup.
+func (serv *Server) SetConfigLoader(load func() (*config.Config, error)) {
+	serv.loadConfig = load
+}
+
+// conf returns the running configuration. Read it once per use: a reload
+// may swap it at any time.
+func (serv *Server) conf() *config.Config {
+	serv.configMu.RLock()
+	defer serv.configMu.RUnlock()
+	return serv.config
+}
+
+// Reload reads the configuration again and applies whatever can change while
+// the server runs: log level, rate limits, the word filter and its cache,
+// auth, admins and the other per-request settings. A configuration that does
+// not load or validate changes nothing.
+func (serv *Server) Reload() (models.ReloadReport, error) {
+	serv.reloadMu.Lock()
+	defer serv.reloadMu.Unlock()
+	if serv.loadConfig == nil {
+		return models.ReloadReport{}, errors.New("the server was not started with a config it can reload")
+	}
+	next, err := serv.loadConfig()
+	if err != nil {
+		return models.ReloadReport{}, err
+	}
+	running := serv.conf()
+	effective, applied, pending := config.Reload(running, next)
+	level, err := logging.ParseLevel(effective.Log.Level)
+	if err != nil {
+		return models.ReloadReport{}, err
+	}
+
+	serv.configMu.Lock()
+	serv.config = effective
+	serv.access.SetConfig(effective)
+	serv.logLevel.Set(level)
+	serv.limiter.SetLimits(RouteLimits(effective.RateLimits))
+	serv.filters.Reset(effective.Filter.CacheSize, time.Duration(effective.Filter.CacheSeconds)*time.Second)
+	serv.configMu.Unlock()
+
+	serv.log.Info("config reloaded", "applied", applied, "pending_restart", pending)
+	return models.ReloadReport{Applied: applied, Pending: pending}, nil
+}
+
+func (serv *Server) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	report, err := serv.Reload()
+	if err != nil {
+		requestLogger(r).Error("config reload failed", "error", err.Error())
+		errText := models.Error{Message: "Reload failed: " + err.Error()}
+		WriteToResponse(w, http.StatusInternalServerError, errText)
+		return
+	}
+	WriteToResponse(w, http.StatusOK, report)
+}
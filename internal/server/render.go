@@ -0,0 +1,36 @@
+package server
+
+import (
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// RenderRequested reports whether messageHtml should be returned; reads opt
+// out with ?render=false.
+func RenderRequested(r *http.Request) bool {
+	render, err := strconv.ParseBool(r.URL.Query().Get("render"))
+	return err != nil || render
+}
+
+func StripPostsHTML(r *http.Request, posts ...*models.Post) {
+	if RenderRequested(r) {
+		return
+	}
+	for _, post := range posts {
+		if post != nil {
+			post.MessageHTML = ""
+		}
+	}
+}
+
+func StripThreadsHTML(r *http.Request, threads ...*models.Thread) {
+	if RenderRequested(r) {
+		return
+	}
+	for _, thread := range threads {
+		if thread != nil {
+			thread.MessageHTML = ""
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/database"
+	"github.com/sergeychur/technopark_db/internal/models"
+	"net/http"
+	"time"
+)
+
+func (serv *Server) ReportPost(w http.ResponseWriter, r *http.Request) {
+	postId := chi.URLParam(r, "id")
+	report := models.Report{}
+	err := ReadFromBody(r, w, &report)
+	if err != nil {
+		return
+	}
+	if ActingUser(r) == "" {
+		WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	report, stat := serv.store(r).ReportPost(postId, ActingUser(r), report.Reason)
+	DealCreateStatus(w, &report, stat)
+}
+
+func (serv *Server) ReportThread(w http.ResponseWriter, r *http.Request) {
+	threadId := chi.URLParam(r, "slug_or_id")
+	slugOrId := SlugOrId(threadId)
+	report := models.Report{}
+	err := ReadFromBody(r, w, &report)
+	if err != nil {
+		return
+	}
+	if ActingUser(r) == "" {
+		WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	stat := 0
+	if slugOrId == slug {
+		report, stat = serv.store(r).ReportThreadBySlug(threadId, ActingUser(r), report.Reason)
+		DealCreateStatus(w, &report, stat)
+		return
+	}
+	if slugOrId == id {
+		report, stat = serv.store(r).ReportThreadById(threadId, ActingUser(r), report.Reason)
+		DealCreateStatus(w, &report, stat)
+		return
+	}
+	errText := models.Error{Message: "Invalid url"}
+	WriteToResponse(w, http.StatusBadRequest, errText)
+}
+
+func (serv *Server) GetForumReports(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	limit := ""
+	err := ParseLimit(w, r, &limit)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	items, stat := serv.store(r).GetReportedItems(forumId, limit)
+	DealGetStatus(w, &items, stat)
+}
+
+func (serv *Server) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	kind := chi.URLParam(r, "kind")
+	itemId := chi.URLParam(r, "id")
+	resolution := models.ReportResolution{}
+	err := ReadFromBody(r, w, &resolution)
+	if err != nil {
+		return
+	}
+	expires := time.Time{}
+	if resolution.Action == database.ActionBan && resolution.Expires != "" {
+		expires, err = time.Parse("2006-01-02T15:04:05.999999999Z07:00", resolution.Expires)
+		if err != nil || expires.Before(time.Now()) {
+			errText := models.Error{Message: "expires incorrect"}
+			WriteToResponse(w, http.StatusBadRequest, errText)
+			return
+		}
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	if resolution.Action == database.ActionBan {
+		stat := serv.accessOf(r).CanBanItemAuthor(ActingUser(r), forumId, kind, itemId)
+		if stat != database.OK {
+			DealGetStatus(w, nil, stat)
+			return
+		}
+	}
+	action, stat := serv.store(r).ResolveReports(forumId, kind, itemId, ActingUser(r), resolution, expires)
+	if stat == database.Invalid {
+		errText := models.Error{Message: "action incorrect"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return
+	}
+	DealGetStatus(w, &action, stat)
+}
+
+func (serv *Server) GetModerationLog(w http.ResponseWriter, r *http.Request) {
+	forumId := chi.URLParam(r, "slug")
+	var (
+		limit = ""
+		since = ""
+	)
+	err := ParsePage(w, r, &limit, &since)
+	if err != nil {
+		return
+	}
+	if !serv.RequireActor(w, r, serv.accessOf(r).CanModerate, forumId) {
+		return
+	}
+	actions, stat := serv.store(r).GetModerationLog(forumId, limit, since)
+	DealGetStatus(w, &actions, stat)
+}
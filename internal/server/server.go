@@ -1,82 +1,298 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/go-chi/chi"
 	"github.com/sergeychur/technopark_db/config"
+	"github.com/sergeychur/technopark_db/internal/blobstore"
 	"github.com/sergeychur/technopark_db/internal/database"
-	"log"
+	"github.com/sergeychur/technopark_db/internal/filter"
+	"github.com/sergeychur/technopark_db/internal/graphql"
+	"github.com/sergeychur/technopark_db/internal/idempotency"
+	"github.com/sergeychur/technopark_db/internal/logging"
+	"github.com/sergeychur/technopark_db/internal/metrics"
+	"github.com/sergeychur/technopark_db/internal/openapi"
+	"github.com/sergeychur/technopark_db/internal/ratelimit"
+	"github.com/sergeychur/technopark_db/internal/tracing"
+	"github.com/sergeychur/technopark_db/internal/traffic"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 type Server struct {
-	router *chi.Mux
-	db     *database.DB
-	config *config.Config
+	router   *chi.Mux
+	db       *database.DB
+	config   *config.Config
+	access   *Authorizer
+	limiter  *ratelimit.Limiter
+	replays  idempotency.Store
+	filters  *filter.Cache
+	blobs    blobstore.Store
+	recorder *traffic.Recorder
+	api      *openapi.Document
+	graph    *graphql.Schema
+	log      *slog.Logger
+	logLevel *slog.LevelVar
+	metrics  *metrics.Registry
+	tracer   *tracing.Tracer
+	tls      *tls.Config
+
+	httpMetrics *httpMetrics
+	draining    int32
+	configMu    sync.RWMutex
+	reloadMu    sync.Mutex
+	loadConfig  func() (*config.Config, error)
 }
 
-func NewServer(pathToConfig string) (*Server, error) {
+func NewServer(conf *config.Config) (*Server, error) {
 	server := new(Server)
+	api, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+	server.api = api
+	server.graph, err = newGraphQLSchema()
+	if err != nil {
+		return nil, err
+	}
+	server.metrics = metrics.NewRegistry()
+	server.httpMetrics = newHttpMetrics(server.metrics)
 	r := chi.NewRouter()
-	//r.Use(middleware.Logger)
+	r.Use(server.RequestID)
+	r.Use(server.Trace)
+	r.Use(server.AccessLog)
+	r.Use(server.Measure)
 	//r.Use(middleware.Recoverer)
 	slugPattern := "^(\\d|\\w|-|_)*(\\w|-|_)(\\d|\\w|-|_)*$"
 	idPattern := "^[0-9]+$"
 	nickPattern := "^[A-Za-z0-9_\\.-]+$"
 
 	subRouter := chi.NewRouter()
-	subRouter.Post("/forum/create", server.CreateForum)
-	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/create", slugPattern), server.CreateThread)
+	subRouter.Use(server.Negotiate)
+	subRouter.Use(server.RecordTraffic)
+	subRouter.Use(server.Authenticate)
+	subRouter.Use(server.RateLimit)
+	subRouter.Use(server.ValidateRequest)
+	subRouter.Get("/openapi.json", server.GetOpenAPI)
+	subRouter.With(server.Idempotent).Post("/forum/create", server.CreateForum)
+	subRouter.With(server.RequireAdmin).Post("/forum/import", server.ImportForum)
+	subRouter.With(server.Idempotent).Post(fmt.Sprintf("/forum/{slug:%s}/create", slugPattern), server.CreateThread)
 	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/details", slugPattern), server.GetForumInfo)
 	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/threads", slugPattern), server.GetForumThreads)
 	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/users", slugPattern), server.GetUsersByForum)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/moderators", slugPattern), server.GetForumModerators)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/moderators", slugPattern), server.AddForumModerator)
+	subRouter.Delete(fmt.Sprintf("/forum/{slug:%s}/moderators/{nickname:%s}", slugPattern, nickPattern),
+		server.RemoveForumModerator)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/bans", slugPattern), server.GetForumBans)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/bans", slugPattern), server.BanUser)
+	subRouter.Delete(fmt.Sprintf("/forum/{slug:%s}/bans/{nickname:%s}", slugPattern, nickPattern), server.UnbanUser)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/settings", slugPattern), server.GetForumSettings)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/settings", slugPattern), server.UpdateForumSettings)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/queue", slugPattern), server.GetModerationQueue)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/queue/{id:%s}/approve", slugPattern, idPattern), server.ApprovePendingPost)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/queue/{id:%s}/reject", slugPattern, idPattern), server.RejectPendingPost)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/reports", slugPattern), server.GetForumReports)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/reports/{kind:(post|thread)}/{id:%s}/resolve", slugPattern, idPattern),
+		server.ResolveReport)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/log", slugPattern), server.GetModerationLog)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/export", slugPattern), server.ExportForum)
+	subRouter.Get(fmt.Sprintf("/forum/{slug:%s}/filters", slugPattern), server.GetFilterRules)
+	subRouter.Post(fmt.Sprintf("/forum/{slug:%s}/filters", slugPattern), server.CreateFilterRule)
+	subRouter.Delete(fmt.Sprintf("/forum/{slug:%s}/filters/{id:%s}", slugPattern, idPattern), server.DeleteFilterRule)
 
 	subRouter.Get(fmt.Sprintf("/post/{id:%s}/details", idPattern), server.GetPostInfo)
 	subRouter.Post(fmt.Sprintf("/post/{id:%s}/details", idPattern), server.EditPost)
+	subRouter.Post(fmt.Sprintf("/post/{id:%s}/report", idPattern), server.ReportPost)
 
-	subRouter.Post("/service/clear", server.ClearDB)
+	subRouter.With(server.RequireAdmin).Post("/service/clear", server.ClearDB)
+	subRouter.With(server.RequireAdmin).Post("/service/reload", server.ReloadConfig)
 	subRouter.Get("/service/status", server.GetDBInfo)
 
-	subRouter.Post("/thread/{slug_or_id}/create", server.CreateNewThreadPosts)
+	subRouter.With(server.Idempotent).Post("/thread/{slug_or_id}/create", server.CreateNewThreadPosts)
 	subRouter.Get("/thread/{slug_or_id}/details", server.GetThreadInfo)
 	subRouter.Post("/thread/{slug_or_id}/details", server.UpdateThread)
 	subRouter.Get("/thread/{slug_or_id}/posts", server.GetThreadMessages)
-	subRouter.Post("/thread/{slug_or_id}/vote", server.Vote)
+	subRouter.With(server.Idempotent).Post("/thread/{slug_or_id}/vote", server.Vote)
+	subRouter.Post("/thread/{slug_or_id}/report", server.ReportThread)
 
-	subRouter.Post(fmt.Sprintf("/user/{nickname:%s}/create", nickPattern), server.CreateUser)
+	subRouter.With(server.Idempotent).Post(fmt.Sprintf("/user/{nickname:%s}/create", nickPattern), server.CreateUser)
 	subRouter.Get(fmt.Sprintf("/user/{nickname:%s}/profile", nickPattern), server.GetUserInfo)
 	subRouter.Post(fmt.Sprintf("/user/{nickname:%s}/profile", nickPattern), server.UpdateUser)
+	subRouter.Post(fmt.Sprintf("/user/{nickname:%s}/tokens", nickPattern), server.CreateUserToken)
+	subRouter.Get(fmt.Sprintf("/user/{nickname:%s}/tokens", nickPattern), server.GetUserTokens)
+	subRouter.Delete(fmt.Sprintf("/user/{nickname:%s}/tokens/{id:%s}", nickPattern, idPattern), server.DeleteUserToken)
+
+	subRouter.Post("/attachments", server.UploadAttachment)
+	subRouter.Get(fmt.Sprintf("/attachments/{id:%s}", idPattern), server.GetAttachment)
+	subRouter.Delete(fmt.Sprintf("/attachments/{id:%s}", idPattern), server.DeleteAttachment)
+
+	subRouter.Get("/graphql", server.GraphQL)
+	subRouter.Post("/graphql", server.GraphQL)
+	subRouter.Get("/graphql/schema", server.GetGraphQLSchema)
+
+	subRouter.Post("/user/login", server.Login)
+	subRouter.Post("/user/logout", server.Logout)
 
 	r.Mount("/api/", subRouter)
+	r.Get("/metrics", server.GetMetrics)
+	r.Get("/healthz", server.Healthz)
+	r.Get("/readyz", server.Readyz)
 	server.router = r
 
-	newConfig, err := config.NewConfig(pathToConfig)
+	server.config = conf
+	level, err := logging.ParseLevel(server.config.Log.Level)
 	if err != nil {
 		return nil, err
 	}
-	server.config = newConfig
-	dbPort, err := strconv.Atoi(server.config.DBPort)
+	server.logLevel = new(slog.LevelVar)
+	server.logLevel.Set(level)
+	server.log = logging.New(os.Stdout, server.logLevel)
+	slog.SetDefault(server.log)
+	exporter, err := tracing.NewExporter(server.config.Tracing.Exporter, server.config.Tracing.Path)
 	if err != nil {
 		return nil, err
 	}
+	if exporter != nil {
+		server.tracer = tracing.New(server.config.Tracing.Service, exporter)
+	}
+	if server.config.TLS.Enabled() {
+		server.tls, err = newTLSConfig(server.config.TLS, server.log)
+		if err != nil {
+			return nil, err
+		}
+	}
 	db := database.NewDB(server.config.DBUser, server.config.DBPass,
-		server.config.DBName, server.config.DBHost, uint16(dbPort))
+		server.config.DBName, server.config.DBHost, uint16(server.config.DBPort))
+	db.SetPoolLimits(server.config.DBMaxConnections,
+		time.Duration(server.config.DBAcquireTimeoutSeconds)*time.Second)
+	db.Instrument(server.metrics)
 	server.db = db
+	server.access = NewAuthorizer(db, server.config)
+	server.limiter = NewLimiter(db, server.config.RateLimits)
+	server.replays = NewIdempotencyStore(db, server.config.Idempotency)
+	server.filters = filter.NewCache(server.config.Filter.CacheSize,
+		time.Duration(server.config.Filter.CacheSeconds)*time.Second)
+	server.blobs, err = blobstore.New(server.config.Attachments.Store, server.config.Attachments.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if server.config.Recorder.Path != "" {
+		server.recorder, err = traffic.NewRecorder(server.config.Recorder.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return server, nil
 }
 
+// Run serves until SIGTERM or SIGINT, then stops accepting connections, lets
+// in-flight requests finish within the shutdown timeout and closes the pool.
+// SIGHUP reloads the config.
 func (serv *Server) Run() error {
 	err := serv.db.Start()
 	if err != nil {
-		log.Printf("Failed to connect to DB: %s", err.Error())
+		serv.log.Error("failed to connect to DB", "error", err.Error())
 		return err
 	}
 	defer serv.db.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go serv.CleanupAttachments(stop)
+	if serv.recorder != nil {
+		defer serv.recorder.Close()
+	}
+	defer serv.tracer.Close()
+
 	port := serv.config.Port
-	log.SetOutput(os.Stdout)
-	log.Printf("Running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, serv.router))
-	return nil
+	httpServer := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: serv.router, TLSConfig: serv.tls}
+	serveErr := make(chan error, 3)
+	go listen(httpServer, serveErr)
+	serv.log.Info("running", "port", port, "tls", serv.tls != nil)
+	servers := []*http.Server{httpServer}
+	if redirectPort := serv.config.TLS.RedirectPort; redirectPort != 0 {
+		redirectServer := &http.Server{Addr: ":" + strconv.Itoa(redirectPort), Handler: redirectToHTTPS(port)}
+		go listen(redirectServer, serveErr)
+		serv.log.Info("redirecting to https", "port", redirectPort)
+		servers = append(servers, redirectServer)
+	}
+	if grpcPort := serv.config.GRPC.Port; grpcPort != 0 {
+		grpcServer := serv.newGRPCServer(grpcPort)
+		go listen(grpcServer, serveErr)
+		serv.log.Info("serving grpc", "port", grpcPort)
+		servers = append(servers, grpcServer)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case err = <-serveErr:
+			serv.log.Error("server stopped", "error", err.Error())
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				_, err = serv.Reload()
+				if err != nil {
+					serv.log.Error("config reload failed", "error", err.Error())
+				}
+				continue
+			}
+			serv.log.Info("shutting down", "signal", sig.String())
+			return serv.shutdown(servers...)
+		}
+	}
+}
+
+// listen serves httpServer over TLS when it has a TLS config.
+func listen(httpServer *http.Server, serveErr chan<- error) {
+	if httpServer.TLSConfig != nil {
+		serveErr <- httpServer.ListenAndServeTLS("", "")
+		return
+	}
+	serveErr <- httpServer.ListenAndServe()
+}
+
+// shutdown marks the server not ready, keeps serving for the drain period so
+// that load balancers notice, then stops accepting connections and waits for
+// in-flight requests up to the shutdown timeout.
+func (serv *Server) shutdown(servers ...*http.Server) error {
+	atomic.StoreInt32(&serv.draining, 1)
+	drain := time.Duration(serv.conf().Shutdown.DrainSeconds) * time.Second
+	if drain > 0 {
+		serv.log.Info("draining before shutdown", "drain_seconds", drain.Seconds())
+		time.Sleep(drain)
+	}
+	timeout := time.Duration(serv.conf().Shutdown.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var failure error
+	for _, httpServer := range servers {
+		err := httpServer.Shutdown(ctx)
+		if err != nil {
+			serv.log.Warn("requests still running after shutdown timeout, closing their connections",
+				"timeout_seconds", timeout.Seconds())
+			err = httpServer.Close()
+		}
+		if err != nil && failure == nil {
+			failure = err
+		}
+	}
+	serv.log.Info("server stopped")
+	return failure
 }
@@ -1,22 +1,41 @@
 package server
 
 import (
+	"context"
+	"github.com/sergeychur/technopark_db/internal/logging"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"net/http"
 )
 
 func (serv *Server) ClearDB(w http.ResponseWriter, r *http.Request) {
-	err := serv.db.ClearDB()
+	err := serv.clearDB(r.Context())
 	if err != nil {
-		errorText := models.Error{Message: "error in database"}
-		WriteToResponse(w, http.StatusInternalServerError, errorText)
+		errText := models.Error{Message: "error in database"}
+		WriteToResponse(w, http.StatusInternalServerError, errText)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// clearDB empties the database and deletes the blobs of the attachments it
+// held. A blob that cannot be deleted is only logged: nothing refers to it
+// any more.
+func (serv *Server) clearDB(ctx context.Context) error {
+	keys, err := serv.storeFor(ctx).ClearDB()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = serv.blobs.Delete(key)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to delete blob", "key", key, "error", err.Error())
+		}
+	}
+	return nil
+}
+
 func (serv *Server) GetDBInfo(w http.ResponseWriter, r *http.Request) {
 	status := models.Status{}
-	status, stat := serv.db.GetDBInfo()
+	status, stat := serv.store(r).GetDBInfo()
 	DealGetStatus(w, &status, stat)
 }
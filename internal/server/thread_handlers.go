@@ -2,6 +2,7 @@ package server
 
 import (
 	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/database"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"net/http"
 )
@@ -14,19 +15,49 @@ func (serv *Server) CreateNewThreadPosts(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return
 	}
+	if !passes(w, serv.checkNewPosts(serv.store(r), ActingUser(r), posts)) {
+		return
+	}
+	var rejected *models.FilterRule
 	stat := 0
 	if slugOrId == slug {
-		posts, stat = serv.db.CreatePostsBySlug(threadId, posts)
-		DealCreateStatus(w, &posts, stat)
+		posts, stat = serv.store(r).CreatePostsBySlug(threadId, posts, serv.postsFilter(&rejected))
+	} else if slugOrId == id {
+		posts, stat = serv.store(r).CreatePostsById(threadId, posts, serv.postsFilter(&rejected))
+	} else {
+		errText := models.Error{Message: "Invalid url"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
 		return
 	}
-	if slugOrId == id {
-		posts, stat = serv.db.CreatePostsById(threadId, posts)
-		DealCreateStatus(w, &posts, stat)
+	if rejected != nil {
+		WriteRejected(w, rejected)
 		return
 	}
-	errText := models.Error{Message: "Invalid url"}
-	WriteToResponse(w, http.StatusBadRequest, errText)
+	DealCreateStatus(w, &posts, stat)
+}
+
+// checkNewPosts lets actor create posts written by themselves that attach
+// only unused uploads of their authors.
+func (serv *Server) checkNewPosts(store *database.DB, actor string, posts models.Posts) *refusal {
+	for _, post := range posts {
+		ref := serv.checkActingUser(actor, post.Author)
+		if ref != nil {
+			return ref
+		}
+	}
+	for _, post := range posts {
+		if len(post.Attachments) == 0 {
+			continue
+		}
+		ifFree, stat := store.AreAttachmentsFree(post.Author, post.Attachments)
+		if stat != database.OK {
+			return statusRefusal(stat)
+		}
+		if !ifFree {
+			return &refusal{status: http.StatusConflict, message: "Attachments must be unused uploads of " + post.Author}
+		}
+	}
+	return nil
 }
 
 func (serv *Server) GetThreadInfo(w http.ResponseWriter, r *http.Request) {
@@ -35,12 +66,14 @@ func (serv *Server) GetThreadInfo(w http.ResponseWriter, r *http.Request) {
 	thread := models.Thread{}
 	stat := 0
 	if slugOrId == slug {
-		thread, stat = serv.db.GetThreadBySlug(threadId)
+		thread, stat = serv.store(r).GetThreadBySlug(threadId)
+		StripThreadsHTML(r, &thread)
 		DealGetStatus(w, &thread, stat)
 		return
 	}
 	if slugOrId == id {
-		thread, stat = serv.db.GetThreadById(threadId)
+		thread, stat = serv.store(r).GetThreadById(threadId)
+		StripThreadsHTML(r, &thread)
 		DealGetStatus(w, &thread, stat)
 		return
 	}
@@ -60,12 +93,18 @@ func (serv *Server) UpdateThread(w http.ResponseWriter, r *http.Request) {
 	thread := models.Thread{}
 	stat := 0
 	if slugOrId == slug {
-		thread, stat = serv.db.UpdateThreadBySlug(threadId, threadUpdate)
+		if !serv.Authorize(w, r, serv.accessOf(r).CanEditThreadBySlug, threadId) {
+			return
+		}
+		thread, stat = serv.store(r).UpdateThreadBySlug(threadId, threadUpdate)
 		DealGetStatus(w, &thread, stat)
 		return
 	}
 	if slugOrId == id {
-		thread, stat = serv.db.UpdateThreadById(threadId, threadUpdate)
+		if !serv.Authorize(w, r, serv.accessOf(r).CanEditThreadById, threadId) {
+			return
+		}
+		thread, stat = serv.store(r).UpdateThreadById(threadId, threadUpdate)
 		DealGetStatus(w, &thread, stat)
 		return
 	}
@@ -105,12 +144,14 @@ func (serv *Server) GetThreadMessages(w http.ResponseWriter, r *http.Request) {
 	posts := models.Posts{}
 	stat := 0
 	if slugOrId == slug {
-		posts, stat = serv.db.GetPostsBySlug(threadId, limit, since, sort, desc)
+		posts, stat = serv.store(r).GetPostsBySlug(threadId, limit, since, sort, desc)
+		StripPostsHTML(r, posts...)
 		DealGetStatus(w, &posts, stat)
 		return
 	}
 	if slugOrId == id {
-		posts, stat = serv.db.GetPostsById(threadId, limit, since, sort, desc)
+		posts, stat = serv.store(r).GetPostsById(threadId, limit, since, sort, desc)
+		StripPostsHTML(r, posts...)
 		DealGetStatus(w, &posts, stat)
 		return
 	}
@@ -127,14 +168,17 @@ func (serv *Server) Vote(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
+	if !serv.CheckActingUser(w, r, vote.Nickname) {
+		return
+	}
 
 	if slugOrId == slug {
-		thread, stat := serv.db.VoteBySlug(threadId, vote)
+		thread, stat := serv.store(r).VoteBySlug(threadId, vote)
 		DealGetStatus(w, &thread, stat)
 		return
 	}
 	if slugOrId == id {
-		thread, stat := serv.db.VoteById(threadId, vote)
+		thread, stat := serv.store(r).VoteById(threadId, vote)
 		DealGetStatus(w, &thread, stat)
 		return
 	}
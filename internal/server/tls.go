@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/sergeychur/technopark_db/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certificateLoader serves the certificate from disk and loads it again when
+// the files change, checking at most once per interval. A pair that fails to
+// load, such as one caught half written, leaves the previous one in use.
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	log      *slog.Logger
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	checked  time.Time
+}
+
+func newCertificateLoader(conf config.TLS, logger *slog.Logger) (*certificateLoader, error) {
+	loader := &certificateLoader{
+		certFile: conf.CertFile,
+		keyFile:  conf.KeyFile,
+		interval: time.Duration(conf.CheckSeconds) * time.Second,
+		log:      logger,
+	}
+	modTimes, err := loader.stat()
+	if err != nil {
+		return nil, err
+	}
+	err = loader.load(modTimes)
+	if err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+func (l *certificateLoader) stat() ([2]time.Time, error) {
+	modTimes := [2]time.Time{}
+	for i, path := range []string{l.certFile, l.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (l *certificateLoader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	l.cert = &cert
+	l.modTimes = modTimes
+	return nil
+}
+
+func (l *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.interval > 0 && now.Sub(l.checked) >= l.interval {
+		l.checked = now
+		modTimes, err := l.stat()
+		if err == nil && modTimes != l.modTimes {
+			err = l.load(modTimes)
+			if err == nil {
+				l.log.Info("tls certificate reloaded", "cert_file", l.certFile)
+			}
+		}
+		if err != nil {
+			l.log.Error("tls certificate not reloaded, keeping the previous one", "error", err.Error())
+		}
+	}
+	return l.cert, nil
+}
+
+// newTLSConfig builds the listener config: TLS 1.2 or later, HTTP/2 offered
+// first, and client certificates verified against the client CA when given.
+func newTLSConfig(conf config.TLS, logger *slog.Logger) (*tls.Config, error) {
+	loader, err := newCertificateLoader(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: loader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(conf.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", conf.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// clientCertName returns the common name of the verified client certificate
+// of the request.
+func clientCertName(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	return name, name != ""
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS port,
+// keeping the method with 308.
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if host == "" {
+			http.Error(w, "Host header required", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/logging"
+	"github.com/sergeychur/technopark_db/internal/tracing"
+	"net/http"
+)
+
+// Trace opens the server span of every request, continuing the trace of the
+// caller when it sends a valid traceparent, and adds the trace id to the
+// request logger.
+func (serv *Server) Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serv.tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if remote, ok := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); ok {
+			ctx = tracing.ContextWithRemote(ctx, remote)
+		}
+		ctx, span := serv.tracer.Start(ctx, r.Method, tracing.KindServer)
+		defer span.End()
+		traceId := span.Context().TraceID.String()
+		ctx = logging.WithLogger(ctx, requestLogger(r).With("trace_id", traceId))
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		span.SetAttribute("request_id", logging.RequestID(ctx))
+
+		status := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(status, r.WithContext(ctx))
+		if status.status == 0 {
+			status.status = http.StatusOK
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttribute("http.route", rctx.RoutePattern())
+		}
+		span.SetAttribute("http.status_code", status.status)
+		if status.status >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(status.status))
+		}
+	})
+}
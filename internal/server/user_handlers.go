@@ -2,6 +2,7 @@ package server
 
 import (
 	"github.com/go-chi/chi"
+	"github.com/sergeychur/technopark_db/internal/auth"
 	"github.com/sergeychur/technopark_db/internal/database"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"net/http"
@@ -15,7 +16,11 @@ func (serv *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user.Nickname = userNick
-	users, stat := serv.db.CreateUser(user)
+	passwordHash, ref := serv.checkNewUser(user)
+	if !passes(w, ref) {
+		return
+	}
+	users, stat := serv.store(r).CreateUser(user, passwordHash)
 	if stat == database.Conflict {
 		DealCreateStatus(w, users, stat)
 		return
@@ -28,10 +33,26 @@ func (serv *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 	DealCreateStatus(w, nil, stat)
 }
 
+// checkNewUser keeps the nicknames of admins from being registered and
+// returns the hash of the password of the user, if they chose one.
+func (serv *Server) checkNewUser(user models.User) (string, *refusal) {
+	if serv.conf().HasAdmin(user.Nickname) {
+		return "", &refusal{status: http.StatusForbidden, message: "Nickname is reserved for an administrator"}
+	}
+	if user.Password == "" {
+		return "", nil
+	}
+	passwordHash, err := auth.HashPassword(user.Password)
+	if err != nil {
+		return "", &refusal{status: http.StatusInternalServerError, message: "Cannot hash password"}
+	}
+	return passwordHash, nil
+}
+
 func (serv *Server) GetUserInfo(w http.ResponseWriter, r *http.Request) {
 	userNick := chi.URLParam(r, "nickname")
 	user := models.User{}
-	user, stat := serv.db.GetUser(userNick)
+	user, stat := serv.store(r).GetUser(userNick)
 	DealGetStatus(w, &user, stat)
 }
 
@@ -42,6 +63,9 @@ func (serv *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	post, stat := serv.db.UpdateUser(userNick, userUpdate)
+	if !serv.Authorize(w, r, serv.accessOf(r).CanEditUser, userNick) {
+		return
+	}
+	post, stat := serv.store(r).UpdateUser(userNick, userUpdate)
 	DealGetStatus(w, &post, stat)
 }
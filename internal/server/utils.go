@@ -2,11 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sergeychur/technopark_db/internal/database"
 	"github.com/sergeychur/technopark_db/internal/models"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 )
@@ -24,13 +25,24 @@ var (
 	noLimit                   = fmt.Errorf("no limit")
 )
 
+// WriteToResponse writes v as JSON. Under Negotiate it also tags successful
+// GETs with an ETag, answers 304 to a matching If-None-Match and gzips large
+// bodies for clients that accept it.
 func WriteToResponse(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(status)
 	response, _ := json.Marshal(v)
+	if negotiating := negotiatorOf(w); negotiating != nil {
+		if negotiating.notModified(w.Header(), status, response) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		negotiating.compress(w.Header(), len(response))
+	}
+	w.WriteHeader(status)
 	_, err := w.Write(response)
 	if err != nil {
-		log.Println("heh, unable to write to response, starve")
+		slog.Warn("unable to write to response", "error", err.Error())
 	}
 }
 
@@ -39,13 +51,13 @@ func ReadFromBody(r *http.Request, w http.ResponseWriter, v interface{}) error {
 	if err != nil {
 		errText := models.Error{Message: "Cannot read body"}
 		WriteToResponse(w, http.StatusBadRequest, errText)
-		return fmt.Errorf(errText.Message)
+		return errors.New(errText.Message)
 	}
 	err = json.Unmarshal(body, v)
 	if err != nil {
 		errText := models.Error{Message: "Cannot unmarshal json"}
 		WriteToResponse(w, http.StatusBadRequest, errText)
-		return fmt.Errorf(errText.Message)
+		return errors.New(errText.Message)
 	}
 	return nil
 }
@@ -71,6 +83,11 @@ func DealCreateStatus(w http.ResponseWriter, v interface{}, stat int) {
 		WriteToResponse(w, http.StatusConflict, v)
 		return
 	}
+
+	if stat == database.Forbidden {
+		WriteForbidden(w, "Not allowed")
+		return
+	}
 }
 
 func DealGetStatus(w http.ResponseWriter, v interface{}, stat int) {
@@ -93,9 +110,62 @@ func DealGetStatus(w http.ResponseWriter, v interface{}, stat int) {
 	if stat == database.Conflict {
 		errText := models.Error{Message: "Conflict happened"}
 		WriteToResponse(w, http.StatusConflict, errText)
+		return
+	}
+
+	if stat == database.Forbidden {
+		WriteForbidden(w, "Not allowed")
 	}
 }
 
+// refusal is a check turning a request down, with the status and message the
+// REST API answers it with. The gRPC API maps the status to a gRPC code.
+type refusal struct {
+	status  int
+	message string
+	rule    *models.FilterRule
+}
+
+func (ref *refusal) write(w http.ResponseWriter) {
+	if ref.status == http.StatusUnauthorized {
+		WriteUnauthorized(w, ref.message)
+		return
+	}
+	errText := models.Error{Message: ref.message, Rule: ref.rule}
+	WriteToResponse(w, ref.status, errText)
+}
+
+// passes tells whether a check let the request through, answering it with
+// the refusal otherwise.
+func passes(w http.ResponseWriter, ref *refusal) bool {
+	if ref != nil {
+		ref.write(w)
+		return false
+	}
+	return true
+}
+
+// statusRefusal is what DealGetStatus answers a storage status other than OK
+// with, nil for OK.
+func statusRefusal(stat int) *refusal {
+	switch stat {
+	case database.OK:
+		return nil
+	case database.EmptyResult:
+		return &refusal{status: http.StatusNotFound, message: "No such item"}
+	case database.Conflict:
+		return &refusal{status: http.StatusConflict, message: "Conflict happened"}
+	case database.Forbidden:
+		return &refusal{status: http.StatusForbidden, message: "Not allowed"}
+	}
+	return &refusal{status: http.StatusInternalServerError, message: "Error in DB"}
+}
+
+func WriteForbidden(w http.ResponseWriter, message string) {
+	errText := models.Error{Message: message}
+	WriteToResponse(w, http.StatusForbidden, errText)
+}
+
 func SlugOrId(str string) int {
 	if idRegexp.MatchString(str) {
 		return id
@@ -117,7 +187,7 @@ func ParseParams(w http.ResponseWriter, r *http.Request,
 	if !idRegexp.MatchString(*limit) {
 		errText := models.Error{Message: "Limit incorrect"}
 		WriteToResponse(w, http.StatusNotFound, errText)
-		return fmt.Errorf(errText.Message)
+		return errors.New(errText.Message)
 	}
 
 	descs, ok := params["desc"]
@@ -133,7 +203,7 @@ func ParseParams(w http.ResponseWriter, r *http.Request,
 		default:
 			errText := models.Error{Message: "desc incorrect"}
 			WriteToResponse(w, http.StatusBadRequest, errText)
-			return fmt.Errorf(errText.Message)
+			return errors.New(errText.Message)
 		}
 	}
 	sinces, ok := params["since"]
@@ -143,3 +213,29 @@ func ParseParams(w http.ResponseWriter, r *http.Request,
 	*since = sinces[0]
 	return nil
 }
+
+// ParsePage reads the optional limit and since parameters of lists paged by id.
+func ParsePage(w http.ResponseWriter, r *http.Request, limit *string, since *string) error {
+	err := ParseLimit(w, r, limit)
+	if err != nil {
+		return err
+	}
+	*since = r.URL.Query().Get("since")
+	if *since != "" && !idRegexp.MatchString(*since) {
+		errText := models.Error{Message: "since incorrect"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return errors.New(errText.Message)
+	}
+	return nil
+}
+
+// ParseLimit reads the optional limit parameter of lists that are not paged.
+func ParseLimit(w http.ResponseWriter, r *http.Request, limit *string) error {
+	*limit = r.URL.Query().Get("limit")
+	if *limit != "" && !idRegexp.MatchString(*limit) {
+		errText := models.Error{Message: "Limit incorrect"}
+		WriteToResponse(w, http.StatusBadRequest, errText)
+		return errors.New(errText.Message)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Package stats summarizes latency samples for the command line tools.
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Summary struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// Summarize sorts samples in place and computes their summary.
+func Summarize(samples []time.Duration) Summary {
+	if len(samples) == 0 {
+		return Summary{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	total := time.Duration(0)
+	for _, sample := range samples {
+		total += sample
+	}
+	return Summary{
+		Count: len(samples),
+		Min:   samples[0],
+		Max:   samples[len(samples)-1],
+		Mean:  total / time.Duration(len(samples)),
+		P50:   Percentile(samples, 50),
+		P95:   Percentile(samples, 95),
+		P99:   Percentile(samples, 99),
+	}
+}
+
+// Percentile returns the nearest-rank percentile p of sorted samples.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("n=%d min=%s mean=%s p50=%s p95=%s p99=%s max=%s",
+		s.Count, round(s.Min), round(s.Mean), round(s.P50), round(s.P95), round(s.P99), round(s.Max))
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
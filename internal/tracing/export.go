@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type Exporter interface {
+	Export(span SpanData)
+	Close() error
+}
+
+// NewExporter builds the exporter named by kind: "stdout" writes a line of
+// OTLP/JSON per span to standard output, "file" appends them to path, where
+// an OpenTelemetry Collector can pick them up. "none" and the empty kind
+// return a nil exporter, meaning tracing is off.
+func NewExporter(kind string, path string) (Exporter, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return newWriterExporter(os.Stdout, nil), nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("tracing: file exporter needs a path")
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return newWriterExporter(file, file), nil
+	}
+	return nil, fmt.Errorf("tracing: unknown exporter %q", kind)
+}
+
+type writerExporter struct {
+	mu      sync.Mutex
+	buf     *bufio.Writer
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+func newWriterExporter(w io.Writer, closer io.Closer) *writerExporter {
+	buf := bufio.NewWriter(w)
+	return &writerExporter{buf: buf, encoder: json.NewEncoder(buf), closer: closer}
+}
+
+// Export writes span at once, so that a trace can be followed while the
+// server runs.
+func (e *writerExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.encoder.Encode(newOTLPRequest(span)) == nil {
+		e.buf.Flush()
+	}
+}
+
+func (e *writerExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.buf.Flush()
+	if e.closer != nil {
+		if closeErr := e.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
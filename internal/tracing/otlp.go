@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// The OTLP/JSON encoding of spans: an ExportTraceServiceRequest per span, as
+// the OpenTelemetry Collector's file exporter writes them and its
+// otlpjsonfile receiver reads them. Ids are hex, 64-bit integers decimal
+// strings and enums their numbers, as the OTLP/JSON mapping asks.
+
+const scopeName = "github.com/sergeychur/technopark_db/internal/tracing"
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// span kinds and status codes of OTLP
+var (
+	otlpKinds = map[string]int{
+		KindInternal: 1,
+		KindServer:   2,
+		KindClient:   3,
+	}
+	otlpStatusCodes = map[string]int{
+		StatusUnset: 0,
+		StatusError: 2,
+	}
+)
+
+func newOTLPRequest(span SpanData) otlpRequest {
+	attributes := make([]otlpKeyValue, 0, len(span.Attributes))
+	for key, value := range span.Attributes {
+		attributes = append(attributes, otlpKeyValue{Key: key, Value: newOTLPValue(value)})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Key < attributes[j].Key
+	})
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: newOTLPValue(span.Service)},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: scopeName},
+			Spans: []otlpSpan{{
+				TraceID:           span.TraceID,
+				SpanID:            span.SpanID,
+				ParentSpanID:      span.ParentSpanID,
+				Name:              span.Name,
+				Kind:              otlpKinds[span.Kind],
+				StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+				EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+				Attributes:        attributes,
+				Status:            otlpStatus{Code: otlpStatusCodes[span.Status], Message: span.StatusMessage},
+			}},
+		}},
+	}}}
+}
+
+func newOTLPValue(value interface{}) otlpAnyValue {
+	switch value := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &value}
+	case bool:
+		return otlpAnyValue{BoolValue: &value}
+	case int:
+		return otlpInt(int64(value))
+	case int32:
+		return otlpInt(int64(value))
+	case int64:
+		return otlpInt(value)
+	case float64:
+		return otlpAnyValue{DoubleValue: &value}
+	}
+	text := fmt.Sprint(value)
+	return otlpAnyValue{StringValue: &text}
+}
+
+func otlpInt(value int64) otlpAnyValue {
+	text := strconv.FormatInt(value, 10)
+	return otlpAnyValue{IntValue: &text}
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent reads a W3C traceparent header value:
+// version-traceid-parentid-flags, all lowercase hex. Versions above 00 may
+// append fields, which are ignored.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, false
+	}
+	version, ok := decodeHex(parts[0], 1)
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, false
+	}
+	traceId, ok := decodeHex(parts[1], len(sc.TraceID))
+	if !ok {
+		return sc, false
+	}
+	spanId, ok := decodeHex(parts[2], len(sc.SpanID))
+	if !ok {
+		return sc, false
+	}
+	flags, ok := decodeHex(parts[3], 1)
+	if !ok {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceId)
+	copy(sc.SpanID[:], spanId)
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+func decodeHex(value string, size int) ([]byte, bool) {
+	if len(value) != 2*size || strings.ToLower(value) != value {
+		return nil, false
+	}
+	decoded, err := hex.DecodeString(value)
+	return decoded, err == nil
+}
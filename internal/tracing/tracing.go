@@ -0,0 +1,269 @@
+// Package tracing records spans of requests, storage calls and SQL statements
+// and hands finished spans to an exporter. Trace and span ids follow W3C
+// Trace Context, so a trace started by a client that sends traceparent is
+// continued here. It is not the OpenTelemetry SDK, which is not in the build,
+// but spans carry the attribute names OpenTelemetry uses and are exported as
+// OTLP/JSON, so OpenTelemetry tools read them.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+const (
+	KindServer   = "server"
+	KindInternal = "internal"
+	KindClient   = "client"
+)
+
+const (
+	StatusUnset = "unset"
+	StatusError = "error"
+)
+
+// SpanData is a finished span as exporters see it.
+type SpanData struct {
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          string                 `json:"kind"`
+	Service       string                 `json:"service"`
+	Start         time.Time              `json:"start_time"`
+	End           time.Time              `json:"end_time"`
+	DurationMs    float64                `json:"duration_ms"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Status        string                 `json:"status"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// Tracer starts spans and exports them once they end. A nil *Tracer is
+// valid and records nothing.
+type Tracer struct {
+	service  string
+	exporter Exporter
+}
+
+func New(service string, exporter Exporter) *Tracer {
+	return &Tracer{service: service, exporter: exporter}
+}
+
+// Close flushes and closes the exporter.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.Close()
+}
+
+// Span is a unit of work in a trace. All methods are safe on a nil *Span, so
+// callers need not check whether tracing is on.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	name    string
+	kind    string
+	start   time.Time
+
+	mu            sync.Mutex
+	attributes    map[string]interface{}
+	status        string
+	statusMessage string
+	ended         bool
+}
+
+// Start begins a span under the span in ctx, or under the remote parent put
+// there by ContextWithRemote, or as the root of a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	var span *Span
+	if parent := SpanFromContext(ctx); parent != nil {
+		span = parent.startChild(name, kind)
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		span = t.newSpan(remote.TraceID, remote.SpanID, remote.Sampled, name, kind)
+	} else {
+		span = t.newSpan(newTraceID(), SpanID{}, true, name, kind)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Child begins a span under s, for code that carries a span but no context.
+func (s *Span) Child(name string, kind string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.startChild(name, kind)
+}
+
+func (s *Span) startChild(name string, kind string) *Span {
+	return s.tracer.newSpan(s.context.TraceID, s.context.SpanID, s.context.Sampled, name, kind)
+}
+
+func (t *Tracer) newSpan(traceId TraceID, parent SpanID, sampled bool, name string, kind string) *Span {
+	return &Span{
+		tracer:  t,
+		context: SpanContext{TraceID: traceId, SpanID: newSpanID(), Sampled: sampled},
+		parent:  parent,
+		name:    name,
+		kind:    kind,
+		start:   time.Now(),
+		status:  StatusUnset,
+	}
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetName renames the span, for names known only once the work is done.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = StatusError
+	s.statusMessage = message
+	s.mu.Unlock()
+}
+
+// End finishes the span and exports it if its trace is sampled. Only the
+// first call counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:       s.context.TraceID.String(),
+		SpanID:        s.context.SpanID.String(),
+		Name:          s.name,
+		Kind:          s.kind,
+		Service:       s.tracer.service,
+		Start:         s.start,
+		End:           end,
+		DurationMs:    float64(end.Sub(s.start).Microseconds()) / 1000,
+		Attributes:    s.attributes,
+		Status:        s.status,
+		StatusMessage: s.statusMessage,
+	}
+	s.mu.Unlock()
+	if s.parent.IsValid() {
+		data.ParentSpanID = s.parent.String()
+	}
+	if s.context.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// ContextWithRemote makes the next span started from ctx a child of a span
+// in another process.
+func ContextWithRemote(ctx context.Context, remote SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, remote)
+}
+
+func newTraceID() TraceID {
+	id := TraceID{}
+	for !id.IsValid() {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	id := SpanID{}
+	for !id.IsValid() {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func randomBytes(buf []byte) {
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("tracing: no randomness for ids: %v", err))
+	}
+}
@@ -0,0 +1,106 @@
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Diff compares two response bodies field by field and describes each
+// difference by its JSON path. Object keys in ignore are skipped at any depth,
+// so that ids and timestamps assigned by the server do not count. Bodies that
+// are not JSON are compared as text.
+func Diff(expected string, actual string, ignore map[string]bool) []string {
+	expectedValue, expectedErr := decode(expected)
+	actualValue, actualErr := decode(actual)
+	if expectedErr != nil || actualErr != nil {
+		if expected == actual {
+			return nil
+		}
+		return []string{fmt.Sprintf("$: body %s, want %s", shorten(actual), shorten(expected))}
+	}
+	diffs := make([]string, 0)
+	diffValues("$", expectedValue, actualValue, ignore, &diffs)
+	return diffs
+}
+
+func decode(body string) (interface{}, error) {
+	if body == "" {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+func diffValues(path string, expected interface{}, actual interface{}, ignore map[string]bool, diffs *[]string) {
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(want)+len(got))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		for key := range got {
+			if _, ok := want[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if ignore[key] {
+				continue
+			}
+			wantField, wantOk := want[key]
+			gotField, gotOk := got[key]
+			fieldPath := path + "." + key
+			switch {
+			case !gotOk:
+				*diffs = append(*diffs, fmt.Sprintf("%s: missing, want %s", fieldPath, show(wantField)))
+			case !wantOk:
+				*diffs = append(*diffs, fmt.Sprintf("%s: unexpected %s", fieldPath, show(gotField)))
+			default:
+				diffValues(fieldPath, wantField, gotField, ignore, diffs)
+			}
+		}
+		return
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(got) != len(want) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %d elements, want %d", path, len(got), len(want)))
+		}
+		for i := 0; i < len(want) && i < len(got); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), want[i], got[i], ignore, diffs)
+		}
+		return
+	default:
+		if expected == actual {
+			return
+		}
+	}
+	*diffs = append(*diffs, fmt.Sprintf("%s: %s, want %s", path, show(actual), show(expected)))
+}
+
+func show(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return shorten(string(encoded))
+}
+
+func shorten(s string) string {
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+// Package traffic records API exchanges as JSONL for later replay.
+package traffic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Exchange is one recorded request and its response. Bodies longer than the
+// recorder limit are cut, and marked truncated.
+type Exchange struct {
+	Time     string   `json:"time"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+	Duration float64  `json:"durationMs"`
+}
+
+type Request struct {
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+type Response struct {
+	Status    int               `json:"status"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// Recorder appends exchanges to a file; it is safe for concurrent use.
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	out  *bufio.Writer
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file, out: bufio.NewWriter(file)}, nil
+}
+
+// Record writes the exchange as a line and flushes it, so that a crash loses
+// at most the exchange in flight.
+func (r *Recorder) Record(exchange Exchange) error {
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.out.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return r.out.Flush()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.out.Flush()
+	closeErr := r.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Reader reads recorded exchanges one by one.
+type Reader struct {
+	in   *bufio.Reader
+	line int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{in: bufio.NewReader(r)}
+}
+
+// Next returns the next exchange, or io.EOF after the last one.
+func (r *Reader) Next() (Exchange, error) {
+	for {
+		line, err := r.in.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return Exchange{}, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return Exchange{}, err
+		}
+		r.line++
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			continue
+		}
+		exchange := Exchange{}
+		err = json.Unmarshal(line, &exchange)
+		if err != nil {
+			return Exchange{}, fmt.Errorf("line %d: %s", r.line, err.Error())
+		}
+		return exchange, nil
+	}
+}